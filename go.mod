@@ -4,7 +4,15 @@ go 1.23.0
 
 require (
 	github.com/lxn/win v0.0.0-20210218163916-a377121e959e
+	github.com/pion/dtls/v2 v2.2.7
+	golang.org/x/crypto v0.11.0
 	golang.org/x/image v0.20.0
 	golang.org/x/sys v0.25.0
 	gopkg.in/Knetic/govaluate.v3 v3.0.0
+	software.sslmate.com/src/go-pkcs12 v0.4.0
+)
+
+require (
+	github.com/pion/logging v0.2.2 // indirect
+	github.com/pion/transport/v2 v2.2.1 // indirect
 )
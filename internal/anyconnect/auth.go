@@ -0,0 +1,464 @@
+package anyconnect
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"snixconnect/internal/backend"
+)
+
+const (
+	userAgent        = "AnyConnect Windows 4.10.07061"
+	maxRedirects     = 5
+	maxAuthRounds    = 10
+	maxLoginRetries  = 3
+	maxResponseBytes = 1 << 20
+	webvpnCookie     = "webvpn"
+)
+
+const (
+	InputText     = "text"
+	InputPassword = "password"
+	InputSelect   = "select"
+	InputCheckbox = "checkbox"
+	InputHidden   = "hidden"
+)
+
+type FormInput struct {
+	Type    string
+	Name    string
+	Label   string
+	Value   string
+	Options []backend.GroupSelect
+}
+
+// AuthForm is a single auth-request sent by the server, one login
+// may take several rounds (group change, challenge/response).
+type AuthForm struct {
+	ID      string
+	Title   string
+	Message string
+	Banner  string
+	Error   string
+	Action  string
+	Inputs  []FormInput
+
+	// Groups is parsed from the group_list select and GroupField holds
+	// the name of the select, Group is the currently selected group.
+	Groups     []backend.GroupSelect
+	GroupField string
+	Group      string
+
+	opaque *xmlOpaque
+}
+
+type Session struct {
+	Cookie         string
+	SessionID      string
+	Banner         string
+	ServerCertHash string
+}
+
+type Client struct {
+	// CheckServer is called before a redirect moves the login to
+	// another server, an error stops the login.
+	CheckServer func(server *url.URL) error
+
+	server     *url.URL
+	httpClient *http.Client
+	groupURL   string
+}
+
+func NewClient(server string, httpClient *http.Client) (*Client, error) {
+	u, err := parseServer(server)
+	if err != nil {
+		return nil, err
+	}
+
+	if httpClient == nil {
+		httpClient = new(http.Client)
+	}
+	hc := *httpClient
+	if hc.Jar == nil {
+		if hc.Jar, err = cookiejar.New(nil); err != nil {
+			return nil, err
+		}
+	}
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	c := &Client{server: u, httpClient: &hc, groupURL: u.String()}
+	return c, nil
+}
+
+// parseServer returns the url of a server address, https is assumed when
+// it has no scheme.
+func parseServer(server string) (*url.URL, error) {
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid server address %s", server)
+	}
+	return u, nil
+}
+
+func (c *Client) Server() *url.URL { u := *c.server; return &u }
+
+// Init sends the config-auth init request and returns the first login form.
+func (c *Client) Init(ctx context.Context) (*AuthForm, error) {
+	req := c.newReply(typeInit)
+	req.GroupAccess = c.groupURL
+	resp, err := c.post(ctx, c.server.Path, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Type != typeAuthRequest {
+		return nil, fmt.Errorf("unexpected config-auth type %q from server", resp.Type)
+	}
+	return parseAuthForm(resp), nil
+}
+
+// SelectGroup asks the server for the login form of another group.
+func (c *Client) SelectGroup(ctx context.Context, form *AuthForm, group string) (*AuthForm, error) {
+	req := c.newReply(typeAuthReply)
+	req.Opaque = form.opaque
+	req.GroupSelect = group
+	resp, err := c.post(ctx, form.Action, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Type != typeAuthRequest {
+		return nil, fmt.Errorf("unexpected config-auth type %q from server", resp.Type)
+	}
+	return parseAuthForm(resp), nil
+}
+
+// Submit posts the answers of form, either the next form or the
+// session is returned once the server completes the login.
+func (c *Client) Submit(ctx context.Context, form *AuthForm, answers map[string]string) (*AuthForm, *Session, error) {
+	req := c.newReply(typeAuthReply)
+	req.Opaque = form.opaque
+	req.Auth = new(xmlReplyAuth)
+	for _, in := range form.Inputs {
+		if in.Type == InputSelect && in.Name == form.GroupField {
+			continue
+		}
+		value, ok := answers[in.Name]
+		if !ok {
+			value = in.Value
+		}
+		answer := xmlAnswer{XMLName: xml.Name{Local: in.Name}, Value: value}
+		req.Auth.Answers = append(req.Auth.Answers, answer)
+	}
+	if len(form.GroupField) > 0 {
+		req.GroupSelect = answers[form.GroupField]
+		if len(req.GroupSelect) == 0 {
+			req.GroupSelect = form.Group
+		}
+	}
+
+	resp, err := c.post(ctx, form.Action, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch resp.Type {
+	case typeAuthRequest:
+		next := parseAuthForm(resp)
+		if len(next.Error) > 0 {
+			return next, nil, backend.NewError(backend.ErrAuthFailed, errors.New(next.Error))
+		}
+		return next, nil, nil
+	case typeComplete:
+		return nil, c.newSession(resp), nil
+	}
+	return nil, nil, fmt.Errorf("unexpected config-auth type %q from server", resp.Type)
+}
+
+// Authenticate runs the whole config-auth exchange, the prompter is asked
+// for answers on every round the server sends a form. A form refused with
+// an error, e.g. for a wrong password, is shown again with the message of
+// the server up to maxLoginRetries times.
+func (c *Client) Authenticate(ctx context.Context, prompt backend.Prompter) (*Session, error) {
+	form, err := c.Init(ctx)
+	if err != nil {
+		return nil, connFailed(err)
+	}
+
+	retries := 0
+	for i := 0; i < maxAuthRounds; i++ {
+		answers, ok := prompt.Credential(form.Prompt())
+		if !ok {
+			return nil, backend.NewError(backend.ErrCanceled, nil)
+		}
+
+		group := answers[form.GroupField]
+		if len(form.GroupField) > 0 && len(group) > 0 && group != form.Group {
+			form, err = c.SelectGroup(ctx, form, group)
+			if err != nil {
+				return nil, connFailed(err)
+			}
+			// the form of another group may ask for different inputs,
+			// the user is asked again with the answers given so far
+			if !form.fill(answers) {
+				continue
+			}
+		}
+
+		next, session, err := c.Submit(ctx, form, answers)
+		if err != nil && next != nil && backend.KindOf(err) == backend.ErrAuthFailed &&
+			retries < maxLoginRetries {
+			retries++
+			form = next
+			continue
+		}
+		if err != nil {
+			return nil, connFailed(err)
+		}
+		if session != nil {
+			if len(session.Banner) > 0 {
+				prompt.Banner(session.Banner)
+			}
+			return session, nil
+		}
+		form = next
+	}
+
+	return nil, backend.NewError(backend.ErrAuthFailed,
+		errors.New("too many authentication rounds"))
+}
+
+func (c *Client) newReply(t string) *configAuthReply {
+	return &configAuthReply{
+		Client: "vpn", Type: t, AggVersion: aggregateAuthVersion,
+		Version:  xmlVersion{Who: "vpn", Value: clientVersion},
+		DeviceID: deviceID,
+	}
+}
+
+func (c *Client) newSession(resp *configAuth) *Session {
+	s := &Session{
+		Cookie:         resp.SessionToken,
+		SessionID:      resp.SessionID,
+		Banner:         strings.TrimSpace(resp.Auth.Banner),
+		ServerCertHash: resp.Config.VpnBaseConfig.ServerCertHash,
+	}
+	for _, cookie := range c.httpClient.Jar.Cookies(c.server) {
+		if cookie.Name == webvpnCookie && len(cookie.Value) > 0 {
+			s.Cookie = cookie.Value
+		}
+	}
+	return s
+}
+
+func (c *Client) post(ctx context.Context, action string, body *configAuthReply) (*configAuth, error) {
+	buf := bytes.NewBufferString(xml.Header)
+	if err := xml.NewEncoder(buf).Encode(body); err != nil {
+		return nil, err
+	}
+	payload := buf.Bytes()
+
+	target, err := c.server.Parse(action)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < maxRedirects; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			target.String(), bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		setRequestHeaders(req.Header)
+		req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case resp.StatusCode >= 300 && resp.StatusCode < 400:
+			location, err := resp.Location()
+			if err != nil {
+				return nil, err
+			}
+			if err := c.checkRedirect(target, location); err != nil {
+				return nil, err
+			}
+			if location.Host != c.server.Host {
+				c.server = location
+			}
+			target = location
+			continue
+
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			return nil, backend.NewError(backend.ErrRejected,
+				fmt.Errorf("server returned %s", resp.Status))
+
+		case resp.StatusCode != http.StatusOK:
+			return nil, fmt.Errorf("server returned %s", resp.Status)
+		}
+
+		result := new(configAuth)
+		if err := xml.Unmarshal(data, result); err != nil {
+			return nil, fmt.Errorf("invalid config-auth response: %v", err)
+		}
+		return result, nil
+	}
+
+	return nil, errors.New("too many redirects from server")
+}
+
+// checkRedirect returns an error when the login can't follow a redirect
+// from target to location.
+func (c *Client) checkRedirect(target, location *url.URL) error {
+	if location.Scheme != "https" && location.Scheme != "http" {
+		return fmt.Errorf("refusing redirect to %s", location.Redacted())
+	}
+	if target.Scheme == "https" && location.Scheme != "https" {
+		return fmt.Errorf("refusing redirect from https to %s", location.Redacted())
+	}
+	if len(location.Hostname()) == 0 || location.User != nil {
+		return fmt.Errorf("invalid redirect to %s", location.Redacted())
+	}
+	if location.Host == c.server.Host || c.CheckServer == nil {
+		return nil
+	}
+	return c.CheckServer(location)
+}
+
+// connFailed wraps errors which are not already a backend error.
+func connFailed(err error) error {
+	var e *backend.Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return backend.NewError(backend.ErrConnFailed, err)
+}
+
+func setRequestHeaders(h http.Header) {
+	h.Set("User-Agent", userAgent)
+	h.Set("X-Transcend-Version", "1")
+	h.Set("X-Aggregate-Auth", "1")
+	h.Set("X-AnyConnect-Platform", "win")
+	h.Set("X-Support-HTTP-Auth", "true")
+}
+
+func parseAuthForm(resp *configAuth) *AuthForm {
+	form := &AuthForm{
+		ID:      resp.Auth.ID,
+		Title:   strings.TrimSpace(resp.Auth.Title),
+		Message: strings.TrimSpace(resp.Auth.Message.Value),
+		Banner:  strings.TrimSpace(resp.Auth.Banner),
+		Action:  resp.Auth.Form.Action,
+		opaque:  resp.Opaque,
+	}
+	if resp.Auth.Error != nil {
+		form.Error = strings.TrimSpace(resp.Auth.Error.Value)
+		if len(form.Error) == 0 {
+			form.Error = "login failed"
+		}
+	}
+
+	for _, in := range resp.Auth.Form.Inputs {
+		form.Inputs = append(form.Inputs, FormInput{
+			Type: in.Type, Name: in.Name, Label: in.Label, Value: in.Value,
+		})
+	}
+
+	for _, sel := range resp.Auth.Form.Selects {
+		input := FormInput{Type: InputSelect, Name: sel.Name, Label: sel.Label}
+		for _, opt := range sel.Options {
+			g := backend.GroupSelect{
+				Name:         strings.TrimSpace(opt.Value),
+				FriendlyName: strings.TrimSpace(opt.Text),
+			}
+			if len(g.Name) == 0 {
+				g.Name = g.FriendlyName
+			}
+			if opt.Selected == "true" || len(input.Value) == 0 {
+				input.Value = g.Name
+			}
+			input.Options = append(input.Options, g)
+		}
+		form.Inputs = append(form.Inputs, input)
+
+		if len(form.GroupField) == 0 && sel.Name == "group_list" {
+			form.GroupField = sel.Name
+			form.Groups = input.Options
+			form.Group = input.Value
+		}
+	}
+
+	return form
+}
+
+// Prompt describes the visible inputs of form for the prompter, the
+// group select goes first so it is shown above the other fields.
+func (form *AuthForm) Prompt() *backend.Form {
+	p := &backend.Form{Title: form.Title, Message: form.Message, Banner: form.Banner}
+	if len(form.Error) > 0 {
+		p.Banner = strings.TrimSpace(form.Error + "\n" + p.Banner)
+	}
+
+	for _, in := range form.Inputs {
+		field := backend.FormField{Name: in.Name, Label: in.Label, Value: in.Value, Options: in.Options}
+		switch in.Type {
+		case InputText:
+			field.Type = backend.FieldText
+		case InputPassword:
+			field.Type = backend.FieldPassword
+		case InputSelect:
+			field.Type = backend.FieldSelect
+		case InputCheckbox:
+			field.Type = backend.FieldCheckbox
+		default:
+			continue
+		}
+
+		if in.Name == form.GroupField {
+			p.Fields = append([]backend.FormField{field}, p.Fields...)
+			continue
+		}
+		p.Fields = append(p.Fields, field)
+	}
+	return p
+}
+
+// fill uses answers as default values of the inputs, it reports
+// whether every visible input of the form has an answer.
+func (form *AuthForm) fill(answers map[string]string) bool {
+	complete := true
+	for i, in := range form.Inputs {
+		if in.Type == InputHidden {
+			continue
+		}
+		value, ok := answers[in.Name]
+		if !ok {
+			complete = false
+			continue
+		}
+		form.Inputs[i].Value = value
+	}
+	return complete
+}
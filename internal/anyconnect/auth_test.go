@@ -0,0 +1,303 @@
+package anyconnect
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"snixconnect/internal/backend"
+	"snixconnect/internal/tlsconf"
+)
+
+const (
+	testCookie   = "3D4F1A2B"
+	testPassword = "secret"
+)
+
+// authReply is a config-auth request as the server decodes it, the
+// answers are elements named by the inputs of the form.
+type authReply struct {
+	Type        string     `xml:"type,attr"`
+	GroupAccess string     `xml:"group-access"`
+	Opaque      *xmlOpaque `xml:"opaque"`
+	GroupSelect string     `xml:"group-select"`
+	Auth        *struct {
+		Answers []xmlAnswer `xml:",any"`
+	} `xml:"auth"`
+}
+
+// ocserv answers the config-auth exchange like ocserv does: a group_list
+// select on init, a form per group and a webvpn cookie once logged in.
+type ocserv struct {
+	t        *testing.T
+	requests []authReply
+}
+
+func (s *ocserv) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req authReply
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.requests = append(s.requests, req)
+	if r.Header.Get("X-Aggregate-Auth") != "1" || r.Header.Get("User-Agent") != userAgent {
+		s.t.Errorf("request without anyconnect headers: %v", r.Header)
+	}
+
+	group := "employees"
+	if req.Opaque != nil && strings.Contains(req.Opaque.Inner, "contractors") {
+		group = "contractors"
+	}
+	if len(req.GroupSelect) > 0 {
+		group = req.GroupSelect
+	}
+
+	switch {
+	case req.Type == typeInit:
+		if req.GroupAccess == "" {
+			s.t.Errorf("init without group-access")
+		}
+		s.form(w, group, "")
+	case req.Auth == nil:
+		s.form(w, group, "")
+	default:
+		answers := make(map[string]string)
+		for _, a := range req.Auth.Answers {
+			answers[a.XMLName.Local] = a.Value
+		}
+		if answers["username"] != "alice" || answers["password"] != testPassword {
+			s.form(w, group, "Login failed.")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: webvpnCookie, Value: testCookie, Path: "/"})
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<config-auth client="vpn" type="complete" aggregate-auth-version="2">
+<version who="sg">0.1(1)</version>
+<auth id="success"><banner>Welcome to %s</banner><message id="0">Success</message></auth>
+<session-token>ignored</session-token>
+<config client="vpn" type="private"><vpn-base-config><server-cert-hash>AB12</server-cert-hash></vpn-base-config></config>
+</config-auth>`, group)
+	}
+}
+
+func (s *ocserv) form(w http.ResponseWriter, group, failure string) {
+	selected := func(g string) string {
+		if g == group {
+			return ` selected="true"`
+		}
+		return ""
+	}
+	var errXML string
+	if len(failure) > 0 {
+		errXML = fmt.Sprintf(`<error id="main" param1="" param2="">%s</error>`, failure)
+	}
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<config-auth client="vpn" type="auth-request" aggregate-auth-version="2">
+<opaque is-for="sg"><tunnel-group>%s</tunnel-group></opaque>
+<auth id="main">
+<title>Login</title>
+<message>Please enter your username and password.</message>
+<banner>Authorised use only</banner>
+%s
+<form method="post" action="/auth">
+<input type="text" name="username" label="Username:"></input>
+<input type="password" name="password" label="Password:"></input>
+<select name="group_list" label="GROUP:">
+<option value="employees"%s>Employees</option>
+<option value="contractors"%s>Contractors</option>
+</select>
+</form></auth>
+</config-auth>`, group, errXML, selected("employees"), selected("contractors"))
+}
+
+type testPrompter struct {
+	answers []map[string]string
+	forms   []*backend.Form
+	banner  string
+}
+
+func (p *testPrompter) Credential(form *backend.Form) (map[string]string, bool) {
+	p.forms = append(p.forms, form)
+	if len(p.answers) == 0 {
+		return nil, false
+	}
+	a := p.answers[0]
+	p.answers = p.answers[1:]
+	return a, true
+}
+
+func (p *testPrompter) Banner(banner string) { p.banner = banner }
+
+func (p *testPrompter) TrustCertificate(string, []*x509.Certificate, error) (tlsconf.Pin, bool) {
+	return tlsconf.Pin{}, false
+}
+
+func newTestClient(t *testing.T, h http.Handler) (*Client, *httptest.Server) {
+	srv := httptest.NewTLSServer(h)
+	t.Cleanup(srv.Close)
+	c, err := NewClient(srv.URL+"/", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, srv
+}
+
+func TestInitGroupList(t *testing.T) {
+	c, _ := newTestClient(t, &ocserv{t: t})
+	form, err := c.Init(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Title != "Login" || form.Banner != "Authorised use only" || form.Action != "/auth" {
+		t.Errorf("unexpected form %+v", form)
+	}
+	if form.GroupField != "group_list" || form.Group != "employees" {
+		t.Errorf("group field %q selects %q", form.GroupField, form.Group)
+	}
+	want := []backend.GroupSelect{{Name: "employees", FriendlyName: "Employees"},
+		{Name: "contractors", FriendlyName: "Contractors"}}
+	if fmt.Sprint(form.Groups) != fmt.Sprint(want) {
+		t.Errorf("groups %v, want %v", form.Groups, want)
+	}
+	prompt := form.Prompt()
+	if len(prompt.Fields) != 3 || prompt.Fields[0].Name != "group_list" {
+		t.Errorf("group select is not the first of the fields %+v", prompt.Fields)
+	}
+}
+
+func TestSubmitFormError(t *testing.T) {
+	c, _ := newTestClient(t, &ocserv{t: t})
+	form, err := c.Init(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, session, err := c.Submit(context.Background(), form,
+		map[string]string{"username": "alice", "password": "wrong"})
+	if !errors.Is(err, backend.ErrAuthFailed) {
+		t.Fatalf("got error %v, want authentication failed", err)
+	}
+	if session != nil || next == nil || next.Error != "Login failed." {
+		t.Errorf("got session %v and form %+v", session, next)
+	}
+	if !strings.HasPrefix(next.Prompt().Banner, "Login failed.\n") {
+		t.Errorf("error is not shown in the banner: %q", next.Prompt().Banner)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	server := &ocserv{t: t}
+	c, _ := newTestClient(t, server)
+	prompt := &testPrompter{answers: []map[string]string{
+		{"group_list": "contractors", "username": "alice", "password": testPassword},
+	}}
+	session, err := c.Authenticate(context.Background(), prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Cookie != testCookie {
+		t.Errorf("cookie %q, want the webvpn cookie %q", session.Cookie, testCookie)
+	}
+	if session.ServerCertHash != "AB12" {
+		t.Errorf("server cert hash %q", session.ServerCertHash)
+	}
+	if prompt.banner != "Welcome to contractors" {
+		t.Errorf("banner %q", prompt.banner)
+	}
+	// the answers fill the form of the new group, the user is asked once
+	if len(prompt.forms) != 1 {
+		t.Errorf("user asked %d times", len(prompt.forms))
+	}
+	last := server.requests[len(server.requests)-1]
+	if last.GroupSelect != "contractors" || last.Opaque == nil {
+		t.Errorf("login not submitted for the selected group: %+v", last)
+	}
+}
+
+func TestAuthenticateWrongPassword(t *testing.T) {
+	c, _ := newTestClient(t, &ocserv{t: t})
+	prompt := &testPrompter{answers: []map[string]string{
+		{"username": "alice", "password": "wrong"},
+		{"username": "alice", "password": testPassword},
+	}}
+	session, err := c.Authenticate(context.Background(), prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Cookie != testCookie {
+		t.Errorf("cookie %q, want %q", session.Cookie, testCookie)
+	}
+	if len(prompt.forms) != 2 {
+		t.Fatalf("user asked %d times, want 2", len(prompt.forms))
+	}
+	if !strings.HasPrefix(prompt.forms[1].Banner, "Login failed.\n") {
+		t.Errorf("form shown again without the server error: %q", prompt.forms[1].Banner)
+	}
+}
+
+func TestAuthenticateRetriesExhausted(t *testing.T) {
+	c, _ := newTestClient(t, &ocserv{t: t})
+	prompt := new(testPrompter)
+	for i := 0; i < maxLoginRetries+2; i++ {
+		prompt.answers = append(prompt.answers, map[string]string{"username": "alice", "password": "wrong"})
+	}
+	_, err := c.Authenticate(context.Background(), prompt)
+	if !errors.Is(err, backend.ErrAuthFailed) {
+		t.Errorf("got error %v, want authentication failed", err)
+	}
+	if len(prompt.forms) != maxLoginRetries+1 {
+		t.Errorf("user asked %d times, want %d", len(prompt.forms), maxLoginRetries+1)
+	}
+}
+
+func TestAuthenticateCanceled(t *testing.T) {
+	c, _ := newTestClient(t, &ocserv{t: t})
+	_, err := c.Authenticate(context.Background(), new(testPrompter))
+	if !errors.Is(err, backend.ErrCanceled) {
+		t.Errorf("got error %v, want canceled", err)
+	}
+}
+
+func redirectTo(location string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		http.Redirect(w, r, location, http.StatusFound)
+	})
+}
+
+func TestRedirectToPlainHTTP(t *testing.T) {
+	c, srv := newTestClient(t, redirectTo("http://vpn.example.com/"))
+	_, err := c.Init(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "refusing redirect") {
+		t.Errorf("got error %v, want the redirect refused", err)
+	}
+	if c.Server().String() != srv.URL+"/" {
+		t.Errorf("server changed to %s", c.Server())
+	}
+}
+
+func TestRedirectCheckServer(t *testing.T) {
+	c, srv := newTestClient(t, redirectTo("https://other.example.com/login"))
+	var checked *url.URL
+	denied := errors.New("not allowed")
+	c.CheckServer = func(u *url.URL) error {
+		checked = u
+		return denied
+	}
+	if _, err := c.Init(context.Background()); !errors.Is(err, denied) {
+		t.Errorf("got error %v, want %v", err, denied)
+	}
+	if checked == nil || checked.Host != "other.example.com" {
+		t.Errorf("checked server %v", checked)
+	}
+	if c.Server().String() != srv.URL+"/" {
+		t.Errorf("server changed to %s", c.Server())
+	}
+}
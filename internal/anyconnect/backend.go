@@ -0,0 +1,303 @@
+package anyconnect
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"snixconnect/internal/backend"
+	"snixconnect/internal/dnsconf"
+	"snixconnect/internal/route"
+	"snixconnect/internal/tlsconf"
+	"snixconnect/internal/tun"
+)
+
+const (
+	Name              = "anyconnect"
+	tunnelDeviceName  = "SnixConnect"
+	httpClientTimeout = 30 * time.Second
+)
+
+func init() {
+	backend.Register(Name, func() backend.Backend { return new(anyConnect) })
+}
+
+type anyConnect struct{}
+
+func (*anyConnect) Connect(ctx context.Context, conf *backend.Config, events chan<- backend.Event) error {
+	send := func(status backend.Status, stats *backend.ConnectionStats) {
+		select {
+		case events <- backend.Event{Status: status, Stats: stats}:
+		case <-ctx.Done():
+		}
+	}
+
+	send(backend.StatusConnecting, nil)
+	server, err := parseServer(conf.Server)
+	if err != nil {
+		return connFailed(err)
+	}
+	verifier := tlsconf.NewVerifier(server.Hostname(), conf.Pins)
+	verifier.SkipVerify = conf.SkipTLSVerify
+	tlsConfig := verifier.Config(nil)
+	if err := conf.TLS.Apply(tlsConfig, verifier); err != nil {
+		return connFailed(err)
+	}
+	if conf.ClientCert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*conf.ClientCert}
+	}
+	httpClient := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, DialContext: conf.Dial},
+		Timeout:   httpClientTimeout,
+	}
+
+	client, err := NewClient(conf.Server, httpClient)
+	if err != nil {
+		return connFailed(err)
+	}
+	client.CheckServer = func(u *url.URL) error {
+		if conf.AllowServer != nil {
+			if err := conf.AllowServer(u.String()); err != nil {
+				return err
+			}
+		}
+		if len(conf.TLS.ServerName) == 0 {
+			verifier.SetHost(u.Hostname())
+		}
+		conf.Logger.Printf("login redirected to %s", u.Host)
+		return nil
+	}
+
+	session, err := authenticate(ctx, client, verifier, conf.Prompt)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	conf.Logger.Printf("authenticated to %s, opening cstp channel", client.Server().Host)
+
+	dialer := &Dialer{
+		Server: client.Server(), Cookie: session.Cookie,
+		TLSConfig: tlsConfig, Dial: conf.Dial, DisableDTLS: conf.DisableDTLS,
+		Liveness: conf.Liveness,
+	}
+	ch, err := dialer.Connect(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return connFailed(err)
+	}
+
+	openDevice := conf.OpenDevice
+	if openDevice == nil {
+		openDevice = func(mtu int) (tun.Device, error) {
+			return tun.Open(tunnelDeviceName, conf.TunnelGUID, mtu)
+		}
+	}
+	dev, err := openDevice(ch.Config.MTU)
+	if err != nil {
+		ch.Close()
+		return connFailed(err)
+	}
+	defer dev.Close()
+
+	tunnel := NewTunnel(dialer, dev, conf.Logger)
+	tunnel.Redial = conf.Redial
+	gateway := ch.RemoteAddr()
+	connectedSince := time.Now()
+	stats, err := configureDevice(dev, ch.Config, gateway, conf)
+	if err != nil {
+		ch.Close()
+		return connFailed(err)
+	}
+	applied := ch.Config
+
+	var ipv6Disabled []string
+	if conf.DisableIPv6 {
+		if ipv6Disabled, err = tun.DisableIPv6(conf.TunnelGUID); err != nil {
+			ch.Close()
+			return connFailed(err)
+		}
+		defer func() {
+			if err := tun.RestoreIPv6(); err != nil {
+				conf.Logger.Print(err)
+			}
+		}()
+		if len(ipv6Disabled) > 0 {
+			conf.Logger.Printf("ipv6 disabled on %s while connected", strings.Join(ipv6Disabled, ", "))
+		}
+	}
+
+	// status reports the link to the gui, the device is configured again
+	// only when a new channel comes with other network settings.
+	status := func(s backend.Status, config *TunnelConfig) error {
+		if s != backend.StatusConnected {
+			send(s, nil)
+			return nil
+		}
+		if !config.sameNetwork(applied) {
+			conf.Logger.Printf("server pushed new network settings, configuring tunnel device")
+			if stats, err = configureDevice(dev, config, gateway, conf); err != nil {
+				return fmt.Errorf("error configuring tunnel device: %v", err)
+			}
+			applied = config
+		}
+		current := *stats
+		if addr, ok := gateway.(*net.TCPAddr); ok {
+			current.Gateway = addr.IP.String()
+		}
+		current.ConnectedSince = connectedSince
+		current.RX, current.TX = tunnel.RX, tunnel.TX
+		current.DataChannel = tunnel.ActiveChannel
+		current.IPv6DisabledOn = ipv6Disabled
+		conf.Logger.Printf("cstp channel to %s established, link is up", current.Gateway)
+		send(s, &current)
+		return nil
+	}
+
+	if err := status(backend.StatusConnected, ch.Config); err != nil {
+		ch.Close()
+		return connFailed(err)
+	}
+	return tunnel.Run(ctx, ch, status)
+}
+
+// authenticate runs the login, when the server certificate is not trusted
+// the user may pin it and the login is started over.
+func authenticate(ctx context.Context, client *Client, verifier *tlsconf.Verifier,
+	prompt backend.Prompter) (*Session, error) {
+	for {
+		session, err := client.Authenticate(ctx, prompt)
+		var untrusted *tlsconf.UntrustedError
+		if !errors.As(err, &untrusted) || ctx.Err() != nil {
+			return session, err
+		}
+		pin, ok := prompt.TrustCertificate(untrusted.Host, untrusted.Chain, untrusted.Err)
+		if !ok {
+			return nil, backend.NewError(backend.ErrCanceled, err)
+		}
+		verifier.AddPin(pin)
+	}
+}
+
+// configureDevice applies the address pushed by the server and the routes
+// and name resolution compiled from the server settings and the ones of
+// conf, the returned stats describe what has been applied.
+func configureDevice(dev tun.Device, config *TunnelConfig, gateway net.Addr,
+	conf *backend.Config) (*backend.ConnectionStats, error) {
+	stats := config.Stats()
+	if d, ok := dev.(interface{ LUID() uint64 }); ok {
+		stats.TunnelLUID = d.LUID()
+	}
+	addresses, err := config.addresses()
+	if err != nil {
+		return stats, err
+	}
+	if err := dev.SetAddresses(addresses); err != nil {
+		return stats, err
+	}
+
+	var local []netip.Prefix
+	if conf.Routes.LocalLAN {
+		networks, err := tun.LocalNetworks()
+		if err != nil {
+			return stats, fmt.Errorf("can not find local networks: %v", err)
+		}
+		// the tunnel device is up and has networks of its own
+		for _, p := range networks {
+			if !overlapsAny(p, addresses) {
+				local = append(local, p)
+			}
+		}
+	}
+	var gatewayIP netip.Addr
+	if tcpAddr, ok := gateway.(*net.TCPAddr); ok {
+		gatewayIP, _ = netip.AddrFromSlice(tcpAddr.IP)
+	}
+	server := route.Table{
+		Include: parsePrefixes(config.SplitInclude),
+		Exclude: parsePrefixes(config.SplitExclude),
+	}
+	table := route.Compile(conf.Routes, server, local, gatewayIP, len(config.AddressIPv6) > 0)
+	stats.Routes = route.Strings(table.Include)
+	stats.ExcludedRoutes = route.Strings(table.Exclude)
+	if err := dev.SetRoutes(table.Include, table.Exclude); err != nil {
+		return stats, err
+	}
+
+	var servers []netip.Addr
+	for _, s := range config.DNS {
+		if ip, err := netip.ParseAddr(s); err == nil {
+			servers = append(servers, ip)
+		}
+	}
+	domains := strings.FieldsFunc(config.DefaultDomain, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	dns := dnsconf.Compile(conf.DNS, servers, config.SplitDNS, domains)
+	stats.SplitDNS, stats.DNSSuffixes = dns.Domains, dns.Suffixes
+	if len(dns.Domains) == 0 {
+		if err := dev.SetSplitDNS(nil, nil); err != nil {
+			return stats, err
+		}
+		return stats, dev.SetDNS(dns.Servers, dns.Suffixes)
+	}
+
+	// only names in the split domains go to the tunnel nameservers
+	if err := dev.SetDNS(nil, dns.Suffixes); err != nil {
+		return stats, err
+	}
+	return stats, dev.SetSplitDNS(dns.Servers, dns.Domains)
+}
+
+// addresses returns the ipv4 and ipv6 addresses of the tunnel.
+func (c *TunnelConfig) addresses() ([]netip.Prefix, error) {
+	var result []netip.Prefix
+	if len(c.Address) > 0 {
+		addr, err := netip.ParseAddr(c.Address)
+		if err != nil {
+			return nil, err
+		}
+		bits, size := net.IPMask(net.ParseIP(c.Netmask).To4()).Size()
+		if size == 0 {
+			bits = 32
+		}
+		result = append(result, netip.PrefixFrom(addr, bits))
+	}
+	if len(c.AddressIPv6) > 0 {
+		p, err := netip.ParsePrefix(c.AddressIPv6)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+func overlapsAny(p netip.Prefix, list []netip.Prefix) bool {
+	for _, q := range list {
+		if p.Overlaps(q) {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePrefixes(routes []string) []netip.Prefix {
+	result := make([]netip.Prefix, 0, len(routes))
+	for _, r := range routes {
+		if p, err := netip.ParsePrefix(r); err == nil {
+			result = append(result, p.Masked())
+		}
+	}
+	return result
+}
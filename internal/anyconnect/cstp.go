@@ -0,0 +1,358 @@
+package anyconnect
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"snixconnect/internal/backend"
+	"snixconnect/internal/proxy"
+)
+
+const (
+	cstpConnectPath = "/CSTP/CONNECT"
+	defaultBaseMTU  = 1406
+	defaultMTU      = 1300
+)
+
+// Rekey methods of X-CSTP-Rekey-Method, a method not known is none.
+const (
+	RekeyNone      = ""
+	RekeyNewTunnel = "new-tunnel"
+	RekeySSL       = "ssl"
+)
+
+// TunnelConfig holds the X-CSTP-* settings the server pushed on CONNECT.
+type TunnelConfig struct {
+	Address       string
+	Netmask       string
+	AddressIPv6   string
+	DNS           []string
+	MTU           int
+	DefaultDomain string
+	SplitInclude  []string
+	SplitExclude  []string
+	SplitDNS      []string
+	Banner        string
+	Keepalive     time.Duration
+	DPD           time.Duration
+	RekeyTime     time.Duration
+	RekeyMethod   string
+	SessionID     string
+	DTLS          *DTLSConfig
+}
+
+// sameNetwork reports whether c and o configure the tunnel device alike.
+func (c *TunnelConfig) sameNetwork(o *TunnelConfig) bool {
+	return c.Address == o.Address && c.Netmask == o.Netmask && c.AddressIPv6 == o.AddressIPv6 &&
+		c.DefaultDomain == o.DefaultDomain && equalStrings(c.DNS, o.DNS) &&
+		equalStrings(c.SplitInclude, o.SplitInclude) && equalStrings(c.SplitExclude, o.SplitExclude) &&
+		equalStrings(c.SplitDNS, o.SplitDNS)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *TunnelConfig) Stats() *backend.ConnectionStats {
+	return &backend.ConnectionStats{
+		TunIPv4:      c.Address,
+		Netmask:      c.Netmask,
+		TunIPv6:      c.AddressIPv6,
+		DNS:          append([]string(nil), c.DNS...),
+		MTU:          uint16(c.MTU),
+		SplitInclude: append([]string(nil), c.SplitInclude...),
+		SplitExclude: append([]string(nil), c.SplitExclude...),
+	}
+}
+
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Dialer opens cstp channels for an authenticated session.
+type Dialer struct {
+	Server    *url.URL
+	Cookie    string
+	TLSConfig *tls.Config
+	Dial      DialFunc
+	BaseMTU   int
+
+	DisableDTLS bool
+
+	// Liveness replaces the dpd and keepalive intervals of the server.
+	Liveness backend.Liveness
+}
+
+// Channel is an established cstp channel, reader must be used for
+// reading since it may hold buffered tunnel data.
+type Channel struct {
+	Config *TunnelConfig
+	conn   *tls.Conn
+	reader *bufio.Reader
+}
+
+func (c *Channel) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+func (c *Channel) Close() error         { return c.conn.Close() }
+
+func (d *Dialer) Connect(ctx context.Context) (*Channel, error) {
+	addr := d.Server.Host
+	if len(d.Server.Port()) == 0 {
+		addr = net.JoinHostPort(d.Server.Hostname(), "443")
+	}
+
+	dial := d.Dial
+	if dial == nil {
+		dial = new(net.Dialer).DialContext
+	}
+	raw, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := new(tls.Config)
+	if d.TLSConfig != nil {
+		tlsConfig = d.TLSConfig.Clone()
+	}
+	if len(tlsConfig.ServerName) == 0 {
+		tlsConfig.ServerName = d.Server.Hostname()
+	}
+	tlsConfig.Renegotiation = tls.RenegotiateFreelyAsClient
+
+	conn := tls.Client(raw, tlsConfig)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	// udp to the remote address would go to the proxy
+	_, proxied := raw.(*proxy.Conn)
+	cc, err := d.connect(conn, !d.DisableDTLS && !proxied)
+	close(done)
+	<-stopped
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return cc, nil
+}
+
+func (d *Dialer) connect(conn *tls.Conn, useDTLS bool) (*Channel, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: cstpConnectPath},
+		Host:   d.Server.Host,
+		Header: make(http.Header),
+	}
+
+	baseMTU := d.BaseMTU
+	if baseMTU == 0 {
+		baseMTU = defaultBaseMTU
+	}
+	hostname, _ := os.Hostname()
+	setRequestHeaders(req.Header)
+	req.Header.Set("Cookie", webvpnCookie+"="+d.Cookie)
+	req.Header.Set("X-CSTP-Version", "1")
+	req.Header.Set("X-CSTP-Hostname", hostname)
+	req.Header.Set("X-CSTP-Base-MTU", strconv.Itoa(baseMTU))
+	req.Header.Set("X-CSTP-MTU", strconv.Itoa(baseMTU))
+	req.Header.Set("X-CSTP-Address-Type", "IPv6,IPv4")
+	req.Header.Set("X-CSTP-Full-IPv6-Capability", "true")
+	if useDTLS {
+		req.Header.Set("X-DTLS-CipherSuite", dtlsPSKNegotiate)
+		req.Header.Set("X-DTLS-Accept-Encoding", "identity")
+	}
+
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, backend.NewError(backend.ErrRejected,
+			fmt.Errorf("cstp connect: server returned %s", resp.Status))
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("cstp connect: server returned %s", resp.Status)
+	}
+
+	config, err := parseTunnelConfig(resp.Header)
+	if err != nil {
+		return nil, err
+	}
+	if !useDTLS {
+		config.DTLS = nil
+	}
+	config.override(d.Liveness)
+	return &Channel{Config: config, conn: conn, reader: reader}, nil
+}
+
+// override replaces the dpd and keepalive intervals of the cstp
+// and dtls channels with the ones set in l.
+func (c *TunnelConfig) override(l backend.Liveness) {
+	if l.DPD > 0 {
+		c.DPD = l.DPD
+		if c.DTLS != nil {
+			c.DTLS.DPD = l.DPD
+		}
+	}
+	if l.Keepalive > 0 {
+		c.Keepalive = l.Keepalive
+		if c.DTLS != nil {
+			c.DTLS.Keepalive = l.Keepalive
+		}
+	}
+}
+
+func parseTunnelConfig(h http.Header) (*TunnelConfig, error) {
+	c := &TunnelConfig{
+		Address:       h.Get("X-CSTP-Address"),
+		Netmask:       h.Get("X-CSTP-Netmask"),
+		DNS:           h.Values("X-CSTP-DNS"),
+		DefaultDomain: h.Get("X-CSTP-Default-Domain"),
+		SplitInclude:  h.Values("X-CSTP-Split-Include"),
+		SplitExclude:  h.Values("X-CSTP-Split-Exclude"),
+		SplitDNS:      h.Values("X-CSTP-Split-DNS"),
+		Banner:        h.Get("X-CSTP-Banner"),
+		RekeyMethod:   h.Get("X-CSTP-Rekey-Method"),
+		SessionID:     h.Get("X-CSTP-Session-ID"),
+		MTU:           defaultMTU,
+	}
+
+	var err error
+	if c.AddressIPv6, err = parseAddressIPv6(h.Get("X-CSTP-Address-IP6")); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(c.Address) == 0 && len(c.AddressIPv6) > 0:
+		c.Netmask = ""
+	case net.ParseIP(c.Address).To4() == nil:
+		return nil, fmt.Errorf("invalid X-CSTP-Address %q from server", c.Address)
+	case len(c.Netmask) == 0:
+		c.Netmask = "255.255.255.255"
+	}
+	c.DNS = append(c.DNS, h.Values("X-CSTP-DNS-IP6")...)
+	c.SplitInclude = append(c.SplitInclude, h.Values("X-CSTP-Split-Include-IP6")...)
+	c.SplitExclude = append(c.SplitExclude, h.Values("X-CSTP-Split-Exclude-IP6")...)
+
+	if v := h.Get("X-CSTP-MTU"); len(v) > 0 {
+		if c.MTU, err = strconv.Atoi(v); err != nil || c.MTU < 576 || c.MTU > cstpMaxLen {
+			return nil, fmt.Errorf("invalid X-CSTP-MTU %q from server", v)
+		}
+	}
+
+	if c.Keepalive, err = headerSeconds(h, "X-CSTP-Keepalive"); err != nil {
+		return nil, err
+	}
+	if c.DPD, err = headerSeconds(h, "X-CSTP-DPD"); err != nil {
+		return nil, err
+	}
+	if c.RekeyTime, err = headerSeconds(h, "X-CSTP-Rekey-Time"); err != nil {
+		return nil, err
+	}
+	switch c.RekeyMethod {
+	case RekeyNewTunnel, RekeySSL:
+	default:
+		c.RekeyMethod, c.RekeyTime = RekeyNone, 0
+	}
+
+	c.SplitInclude = normalizeRoutes(c.SplitInclude)
+	c.SplitExclude = normalizeRoutes(c.SplitExclude)
+
+	if c.DTLS, err = parseDTLSConfig(h); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseAddressIPv6 returns the ipv6 tunnel address in cidr notation,
+// an address without prefix length is a single host.
+func parseAddressIPv6(v string) (string, error) {
+	if len(v) == 0 {
+		return "", nil
+	}
+	cidr := strings.TrimSpace(v)
+	if !strings.Contains(cidr, "/") {
+		cidr += "/128"
+	}
+	p, err := netip.ParsePrefix(cidr)
+	if err != nil || !p.Addr().Is6() || p.Addr().Is4In6() {
+		return "", fmt.Errorf("invalid X-CSTP-Address-IP6 %q from server", v)
+	}
+	return p.String(), nil
+}
+
+func headerSeconds(h http.Header, key string) (time.Duration, error) {
+	v := h.Get(key)
+	if len(v) == 0 {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q from server", key, v)
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+// normalizeRoutes converts addr/netmask entries to cidr notation,
+// entries which can't be parsed are dropped.
+func normalizeRoutes(routes []string) []string {
+	result := make([]string, 0, len(routes))
+	for _, r := range routes {
+		addr, mask, ok := strings.Cut(strings.TrimSpace(r), "/")
+		ip := net.ParseIP(addr)
+		if !ok || ip == nil {
+			continue
+		}
+
+		if bits, err := strconv.Atoi(mask); err == nil {
+			result = append(result, fmt.Sprintf("%s/%d", ip, bits))
+			continue
+		}
+
+		m := net.ParseIP(mask).To4()
+		if m == nil {
+			continue
+		}
+		ones, bits := net.IPv4Mask(m[0], m[1], m[2], m[3]).Size()
+		if bits == 0 {
+			continue
+		}
+		result = append(result, fmt.Sprintf("%s/%d", ip, ones))
+	}
+	return result
+}
@@ -0,0 +1,248 @@
+package anyconnect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"snixconnect/internal/backend"
+	"snixconnect/internal/tlsconf"
+	"snixconnect/internal/tun"
+)
+
+type testLogger struct{ t *testing.T }
+
+func (l testLogger) Printf(format string, v ...any) { l.t.Logf(format, v...) }
+func (l testLogger) Print(v ...any)                 { l.t.Log(v...) }
+
+// gateway answers the cstp connect of a logged in session and echoes
+// the data packets back like a peer on the vpn would, or drops the
+// channel right away when hangUp is set.
+type gateway struct {
+	t            *testing.T
+	done         chan struct{}
+	hangUp       bool
+	disconnected atomic.Bool
+}
+
+func (g *gateway) serveCSTP(w http.ResponseWriter, r *http.Request) {
+	defer close(g.done)
+	if cookie, err := r.Cookie(webvpnCookie); err != nil || cookie.Value != testCookie {
+		g.t.Errorf("cstp connect with cookie %v", r.Header.Get("Cookie"))
+		http.Error(w, "invalid cookie", http.StatusUnauthorized)
+		return
+	}
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		g.t.Error(err)
+		return
+	}
+	defer conn.Close()
+	fmt.Fprint(rw, "HTTP/1.1 200 CONNECTED\r\n"+
+		"X-CSTP-Version: 1\r\n"+
+		"X-CSTP-Address: 10.10.0.2\r\n"+
+		"X-CSTP-Netmask: 255.255.255.0\r\n"+
+		"X-CSTP-DNS: 10.10.0.1\r\n"+
+		"X-CSTP-Split-Include: 10.20.0.0/255.255.0.0\r\n"+
+		"X-CSTP-MTU: 1400\r\n"+
+		"X-CSTP-DPD: 30\r\n"+
+		"X-CSTP-Keepalive: 20\r\n\r\n")
+	if err := rw.Flush(); err != nil || g.hangUp {
+		return
+	}
+
+	buf := make([]byte, cstpMaxLen)
+	for {
+		typ, payload, err := ReadPacket(rw.Reader, buf)
+		if err != nil {
+			return
+		}
+		switch typ {
+		case PacketData:
+			if _, err := conn.Write(EncodePacket(nil, PacketData, payload)); err != nil {
+				return
+			}
+		case PacketDPDReq:
+			conn.Write(EncodePacket(nil, PacketDPDResp, payload))
+		case PacketDisconnect:
+			g.disconnected.Store(true)
+			return
+		}
+	}
+}
+
+// countingDevice counts how often the addresses of the device are set.
+type countingDevice struct {
+	*tun.Memory
+	configured atomic.Int32
+}
+
+func (d *countingDevice) SetAddresses(addrs []netip.Prefix) error {
+	d.configured.Add(1)
+	return d.Memory.SetAddresses(addrs)
+}
+
+func TestConnectLoopback(t *testing.T) {
+	gw := &gateway{t: t, done: make(chan struct{})}
+	auth := &ocserv{t: t}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			gw.serveCSTP(w, r)
+			return
+		}
+		auth.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	dev, peer := tun.NewMemoryPipe(1400)
+	device := &countingDevice{Memory: dev}
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	conf := &backend.Config{
+		Server:      srv.URL,
+		TLS:         tlsconf.Options{CABundle: string(ca)},
+		DisableDTLS: true,
+		Prompt: &testPrompter{answers: []map[string]string{
+			{"username": "alice", "password": testPassword},
+		}},
+		Logger:     testLogger{t},
+		OpenDevice: func(mtu int) (tun.Device, error) { return device, nil },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan backend.Event)
+	errc := make(chan error, 1)
+	go func() { errc <- new(anyConnect).Connect(ctx, conf, events) }()
+
+	var stats *backend.ConnectionStats
+	for stats == nil {
+		select {
+		case e := <-events:
+			if e.Status == backend.StatusConnected {
+				stats = e.Stats
+			}
+		case err := <-errc:
+			t.Fatalf("connect returned %v", err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("tunnel not connected")
+		}
+	}
+
+	if stats.TunIPv4 != "10.10.0.2" || stats.Gateway != "127.0.0.1" || stats.MTU != 1400 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if fmt.Sprint(stats.Routes) != "[10.20.0.0/16]" {
+		t.Errorf("routes %v", stats.Routes)
+	}
+	if addrs := dev.Addresses(); fmt.Sprint(addrs) != "[10.10.0.2/24]" {
+		t.Errorf("device addresses %v", addrs)
+	}
+	if servers, _ := dev.DNS(); fmt.Sprint(servers) != "[10.10.0.1]" {
+		t.Errorf("device dns servers %v", servers)
+	}
+
+	packet := []byte{0x45, 0x00, 0x00, 0x14, 1, 2, 3, 4}
+	if _, err := peer.Write(packet); err != nil {
+		t.Fatal(err)
+	}
+	echo := make([]byte, 1400)
+	n, err := peer.Read(echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(echo[:n], packet) {
+		t.Errorf("got %x back, want %x", echo[:n], packet)
+	}
+	if n := device.configured.Load(); n != 1 {
+		t.Errorf("device configured %d times", n)
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("connect returned %v after cancel", err)
+	}
+	if stats.TX() != uint64(len(packet)) || stats.RX() != uint64(len(packet)) {
+		t.Errorf("counted %d bytes sent and %d received", stats.TX(), stats.RX())
+	}
+	select {
+	case <-gw.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cstp channel not closed")
+	}
+	if !gw.disconnected.Load() {
+		t.Error("gateway got no disconnect packet")
+	}
+}
+
+func TestDialerRejected(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid cookie", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	server, err := parseServer(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Dialer{Server: server, Cookie: "expired", TLSConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig}
+	if _, err := d.Connect(context.Background()); !errors.Is(err, backend.ErrRejected) {
+		t.Errorf("got error %v, want session rejected", err)
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	var stream []byte
+	stream = EncodePacket(stream, PacketData, []byte("payload"))
+	stream = EncodePacket(stream, PacketKeepalive, nil)
+	r := bufio.NewReader(bytes.NewReader(stream))
+	buf := make([]byte, 16)
+
+	typ, payload, err := ReadPacket(r, buf)
+	if err != nil || typ != PacketData || string(payload) != "payload" {
+		t.Errorf("got %#x %q %v", typ, payload, err)
+	}
+	typ, payload, err = ReadPacket(r, buf)
+	if err != nil || typ != PacketKeepalive || len(payload) != 0 {
+		t.Errorf("got %#x %q %v", typ, payload, err)
+	}
+
+	bad := append([]byte("HTTP"), stream[4:]...)
+	if _, _, err := ReadPacket(bytes.NewReader(bad), buf); err == nil {
+		t.Error("packet with invalid magic accepted")
+	}
+}
+
+func TestParseTunnelConfigRekey(t *testing.T) {
+	for _, test := range []struct {
+		method, time string
+		want         string
+		rekey        time.Duration
+	}{
+		{"new-tunnel", "3600", RekeyNewTunnel, time.Hour},
+		{"ssl", "120", RekeySSL, 2 * time.Minute},
+		{"", "3600", RekeyNone, 0},
+		{"none", "3600", RekeyNone, 0},
+		{"new-tunnel", "", RekeyNewTunnel, 0},
+	} {
+		h := http.Header{}
+		h.Set("X-CSTP-Address", "10.10.0.2")
+		h.Set("X-CSTP-Rekey-Method", test.method)
+		h.Set("X-CSTP-Rekey-Time", test.time)
+		c, err := parseTunnelConfig(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.RekeyMethod != test.want || c.RekeyTime != test.rekey {
+			t.Errorf("rekey %q every %q: got %q every %s", test.method, test.time, c.RekeyMethod, c.RekeyTime)
+		}
+	}
+}
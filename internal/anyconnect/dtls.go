@@ -0,0 +1,127 @@
+package anyconnect
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pion/dtls/v2"
+)
+
+const (
+	dtlsPSKNegotiate   = "PSK-NEGOTIATE"
+	dtlsPSKIdentity    = "psk"
+	dtlsExporterLabel  = "EXPORTER-openconnect-psk"
+	dtlsPSKLen         = 32
+	dtlsHandshakeLimit = 10 * time.Second
+	dtlsRetryInterval  = 30 * time.Second
+)
+
+const (
+	ChannelTLS  = "TLS"
+	ChannelDTLS = "DTLS"
+)
+
+// DTLSConfig holds the X-DTLS-* settings the server pushed on CONNECT.
+type DTLSConfig struct {
+	Port        int
+	AppID       []byte
+	CipherSuite string
+	MTU         int
+	Keepalive   time.Duration
+	DPD         time.Duration
+	RekeyTime   time.Duration
+}
+
+func parseDTLSConfig(h http.Header) (*DTLSConfig, error) {
+	port := h.Get("X-DTLS-Port")
+	if len(port) == 0 {
+		return nil, nil
+	}
+
+	c := &DTLSConfig{CipherSuite: h.Get("X-DTLS-CipherSuite")}
+	var err error
+	if c.Port, err = strconv.Atoi(port); err != nil || c.Port <= 0 || c.Port > 0xffff {
+		return nil, fmt.Errorf("invalid X-DTLS-Port %q from server", port)
+	}
+
+	appID := h.Get("X-DTLS-App-ID")
+	if len(appID) == 0 {
+		appID = h.Get("X-DTLS-Session-ID")
+	}
+	if c.AppID, err = hex.DecodeString(appID); err != nil {
+		return nil, fmt.Errorf("invalid X-DTLS-App-ID %q from server", appID)
+	}
+
+	if v := h.Get("X-DTLS-MTU"); len(v) > 0 {
+		if c.MTU, err = strconv.Atoi(v); err != nil || c.MTU <= 0 {
+			return nil, fmt.Errorf("invalid X-DTLS-MTU %q from server", v)
+		}
+	}
+	if c.Keepalive, err = headerSeconds(h, "X-DTLS-Keepalive"); err != nil {
+		return nil, err
+	}
+	if c.DPD, err = headerSeconds(h, "X-DTLS-DPD"); err != nil {
+		return nil, err
+	}
+	if c.RekeyTime, err = headerSeconds(h, "X-DTLS-Rekey-Time"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// appIDStore makes the dtls client hello carry the app id as session id,
+// the server uses it to match the udp channel to the cstp session.
+type appIDStore struct{ id []byte }
+
+func (s *appIDStore) Set([]byte, dtls.Session) error { return nil }
+func (s *appIDStore) Del([]byte) error               { return nil }
+func (s *appIDStore) Get([]byte) (dtls.Session, error) {
+	return dtls.Session{ID: s.id, Secret: make([]byte, 48)}, nil
+}
+
+// dialDTLS runs the PSK-NEGOTIATE handshake, the pre-shared key is
+// exported from the tls session of cstp channel.
+func dialDTLS(ctx context.Context, ch *Channel) (*dtls.Conn, error) {
+	config := ch.Config.DTLS
+	if config.CipherSuite != dtlsPSKNegotiate {
+		return nil, fmt.Errorf("unsupported dtls cipher suite %q", config.CipherSuite)
+	}
+
+	state := ch.conn.ConnectionState()
+	psk, err := state.ExportKeyingMaterial(dtlsExporterLabel, nil, dtlsPSKLen)
+	if err != nil {
+		return nil, err
+	}
+
+	tcpAddr, ok := ch.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("invalid cstp remote address %v", ch.RemoteAddr())
+	}
+	raddr := &net.UDPAddr{IP: tcpAddr.IP, Port: config.Port, Zone: tcpAddr.Zone}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	dtlsConfig := &dtls.Config{
+		PSK:             func([]byte) ([]byte, error) { return psk, nil },
+		PSKIdentityHint: []byte(dtlsPSKIdentity),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_GCM_SHA256},
+		SessionStore:    &appIDStore{id: config.AppID},
+		ServerName:      state.ServerName,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dtlsHandshakeLimit)
+	defer cancel()
+	dconn, err := dtls.ClientWithContext(ctx, conn, dtlsConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return dconn, nil
+}
@@ -0,0 +1,54 @@
+package anyconnect
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	PacketData       byte = 0x00
+	PacketDPDReq     byte = 0x03
+	PacketDPDResp    byte = 0x04
+	PacketDisconnect byte = 0x05
+	PacketKeepalive  byte = 0x07
+	PacketTerminate  byte = 0x09
+)
+
+const (
+	cstpHeaderLen = 8
+	cstpMaxLen    = 0xffff
+)
+
+var cstpMagic = [4]byte{'S', 'T', 'F', 0x01}
+
+// EncodePacket appends a framed cstp packet to dst.
+func EncodePacket(dst []byte, typ byte, payload []byte) []byte {
+	var hdr [cstpHeaderLen]byte
+	copy(hdr[:], cstpMagic[:])
+	binary.BigEndian.PutUint16(hdr[4:], uint16(len(payload)))
+	hdr[6] = typ
+	dst = append(dst, hdr[:]...)
+	return append(dst, payload...)
+}
+
+// ReadPacket reads one framed cstp packet, the payload is stored in
+// buf which must be large enough for any packet the peer may send.
+func ReadPacket(r io.Reader, buf []byte) (typ byte, payload []byte, err error) {
+	var hdr [cstpHeaderLen]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+	if [4]byte(hdr[:4]) != cstpMagic {
+		return 0, nil, fmt.Errorf("invalid cstp packet header %x", hdr)
+	}
+
+	size := int(binary.BigEndian.Uint16(hdr[4:]))
+	if size > len(buf) {
+		return 0, nil, fmt.Errorf("cstp packet length %d exceeds buffer", size)
+	}
+	if _, err = io.ReadFull(r, buf[:size]); err != nil {
+		return
+	}
+	return hdr[6], buf[:size], nil
+}
@@ -0,0 +1,473 @@
+package anyconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"snixconnect/internal/backend"
+	"snixconnect/internal/tun"
+
+	"github.com/pion/dtls/v2"
+)
+
+const (
+	dpdMissedLimit   = 3
+	disconnectReason = 0xb0
+)
+
+var (
+	errServerDisconnect = errors.New("server has terminated the session")
+	errDeadPeer         = errors.New("dead peer detected, no response from server")
+	errRekey            = errors.New("tunnel rekey time reached")
+)
+
+// Tunnel moves packets between the device and the cstp channel, the
+// channel is dialed again on rekey or when the link to server is lost.
+type Tunnel struct {
+	// Redial is asked after a failed dial of a lost channel, see
+	// backend.Config.
+	Redial func(attempt int, err error) (time.Duration, bool)
+
+	dialer   *Dialer
+	device   tun.Device
+	logger   backend.Logger
+	outbound chan []byte
+	devErr   chan error
+	channel  atomic.Value
+	rx, tx   atomic.Uint64
+}
+
+func NewTunnel(d *Dialer, dev tun.Device, logger backend.Logger) *Tunnel {
+	return &Tunnel{dialer: d, device: dev, logger: logger,
+		outbound: make(chan []byte, 64), devErr: make(chan error, 1)}
+}
+
+func (t *Tunnel) RX() uint64 { return t.rx.Load() }
+func (t *Tunnel) TX() uint64 { return t.tx.Load() }
+
+// ActiveChannel returns ChannelTLS or ChannelDTLS.
+func (t *Tunnel) ActiveChannel() string {
+	if c, ok := t.channel.Load().(string); ok {
+		return c
+	}
+	return ChannelTLS
+}
+
+// Run takes ownership of ch and returns when ctx is done or the tunnel
+// can not be recovered, status is called whenever the link changes and
+// an error returned by it ends the tunnel.
+func (t *Tunnel) Run(ctx context.Context, ch *Channel, status func(backend.Status, *TunnelConfig) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go t.readDevice(ctx)
+
+	for {
+		err := t.runChannel(ctx, ch)
+		if ctx.Err() != nil {
+			return nil
+		}
+		// the device may fail while the channel is lost, it is not
+		// dialed again for a dead device
+		if err := t.deviceErr(); err != nil {
+			return err
+		}
+
+		switch {
+		case errors.Is(err, errRekey) && ch.Config.RekeyMethod == RekeySSL:
+			// the tls client can't start a renegotiation, a new channel
+			// gets fresh keys as well
+			t.logger.Printf("rekey interval reached, establishing a new cstp channel instead of renegotiating tls")
+		case errors.Is(err, errRekey):
+			t.logger.Printf("rekey interval reached, establishing a new cstp channel")
+		case errors.Is(err, errServerDisconnect):
+			return backend.NewError(backend.ErrRejected, err)
+		default:
+			t.logger.Printf("cstp channel lost: %v", err)
+			if err := status(backend.StatusReconnecting, nil); err != nil {
+				return err
+			}
+		}
+
+		if ch, err = t.redial(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if backend.KindOf(err) == backend.ErrRejected {
+				// the session has expired, the handler logs in again
+				return backend.NewError(backend.ErrConnFailed,
+					fmt.Errorf("session cookie refused on redial: %v", err))
+			}
+			return connFailed(err)
+		}
+		if err := status(backend.StatusConnected, ch.Config); err != nil {
+			ch.Close()
+			return connFailed(err)
+		}
+	}
+}
+
+// redial dials a channel with the session cookie, failed dials are
+// tried again as long as Redial allows. A refused cookie is returned
+// right away, logging in again is left to the caller.
+func (t *Tunnel) redial(ctx context.Context) (*Channel, error) {
+	for attempt := 1; ; attempt++ {
+		ch, err := t.dialer.Connect(ctx)
+		if err == nil || ctx.Err() != nil || backend.KindOf(err) == backend.ErrRejected {
+			return ch, err
+		}
+		t.logger.Printf("cstp channel redial failed: %v", err)
+		if t.Redial == nil {
+			return nil, err
+		}
+		delay, ok := t.Redial(attempt, err)
+		if !ok {
+			return nil, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		if err := t.deviceErr(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// deviceErr returns the error reading the device failed with, nil
+// while it is read from.
+func (t *Tunnel) deviceErr() error {
+	select {
+	case err := <-t.devErr:
+		t.devErr <- err
+		return err
+	default:
+		return nil
+	}
+}
+
+func (t *Tunnel) readDevice(ctx context.Context) {
+	defer close(t.outbound)
+	mtu := t.device.MTU()
+	if mtu <= 0 {
+		mtu = cstpMaxLen
+	}
+	for {
+		packet := make([]byte, mtu)
+		n, err := t.device.Read(packet)
+		if err != nil {
+			if ctx.Err() == nil {
+				t.devErr <- err
+			}
+			return
+		}
+		select {
+		case t.outbound <- packet[:n]:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type dtlsLink struct {
+	conn     *dtls.Conn
+	lastRecv atomic.Int64
+	lastSend time.Time
+	lastDPD  time.Time
+	dpdSent  atomic.Int64
+	errc     chan error
+}
+
+func newDTLSLink(conn *dtls.Conn) *dtlsLink {
+	now := time.Now()
+	l := &dtlsLink{conn: conn, lastSend: now, lastDPD: now, errc: make(chan error, 1)}
+	l.lastRecv.Store(now.UnixNano())
+	return l
+}
+
+func (l *dtlsLink) write(typ byte, payload []byte) error {
+	buf := make([]byte, 1+len(payload))
+	buf[0] = typ
+	copy(buf[1:], payload)
+	_, err := l.conn.Write(buf)
+	return err
+}
+
+func (t *Tunnel) readDTLS(l *dtlsLink) {
+	buf := make([]byte, cstpMaxLen)
+	for {
+		n, err := l.conn.Read(buf)
+		if err != nil {
+			l.errc <- err
+			return
+		}
+		if n == 0 {
+			continue
+		}
+		l.lastRecv.Store(time.Now().UnixNano())
+
+		switch buf[0] {
+		case PacketData:
+			t.rx.Add(uint64(n - 1))
+			if _, err := t.device.Write(buf[1:n]); err != nil && !errors.Is(err, tun.ErrClosed) {
+				t.logger.Printf("error writing packet to tunnel device: %v", err)
+			}
+		case PacketDPDReq:
+			if err := l.write(PacketDPDResp, buf[1:n]); err != nil {
+				l.errc <- err
+				return
+			}
+		case PacketDPDResp:
+			t.logDPD(ChannelDTLS, &l.dpdSent)
+		case PacketDisconnect, PacketTerminate:
+			l.errc <- errServerDisconnect
+			return
+		}
+	}
+}
+
+func (t *Tunnel) runChannel(ctx context.Context, ch *Channel) error {
+	defer ch.Close()
+	ctx, cancel := context.WithCancel(ctx)
+
+	var (
+		wmutex   sync.Mutex
+		lastRecv atomic.Int64
+		lastSend = time.Now()
+		lastDPD  = time.Now()
+		dpdSent  atomic.Int64
+		errc     = make(chan error, 1)
+
+		udp        *dtlsLink
+		udpErrc    chan error
+		udpReady   = make(chan *dtls.Conn, 1)
+		udpPending bool
+		udpRetry   <-chan time.Time
+		udpRekey   <-chan time.Time
+	)
+
+	t.channel.Store(ChannelTLS)
+	defer func() {
+		cancel()
+		if udp != nil {
+			udp.conn.Close()
+		}
+		if udpPending {
+			go func() {
+				if conn := <-udpReady; conn != nil {
+					conn.Close()
+				}
+			}()
+		}
+	}()
+
+	lastRecv.Store(time.Now().UnixNano())
+	write := func(typ byte, payload []byte) error {
+		wmutex.Lock()
+		defer wmutex.Unlock()
+		buf := make([]byte, 0, cstpHeaderLen+len(payload))
+		_, err := ch.conn.Write(EncodePacket(buf, typ, payload))
+		return err
+	}
+
+	startDTLS := func() {
+		udpPending, udpRetry = true, nil
+		go func() {
+			conn, err := dialDTLS(ctx, ch)
+			if err != nil && ctx.Err() == nil {
+				t.logger.Printf("dtls handshake failed, using tls data channel: %v", err)
+			}
+			udpReady <- conn
+		}()
+	}
+
+	fallbackTLS := func(reason error) {
+		udp.conn.Close()
+		udp, udpErrc, udpRekey = nil, nil, nil
+		t.channel.Store(ChannelTLS)
+		t.logger.Printf("dtls data channel is down, falling back to tls: %v", reason)
+		udpRetry = time.After(dtlsRetryInterval)
+	}
+
+	if ch.Config.DTLS != nil {
+		startDTLS()
+	}
+
+	go func() {
+		buf := make([]byte, cstpMaxLen)
+		for {
+			typ, payload, err := ReadPacket(ch.reader, buf)
+			if err != nil {
+				errc <- err
+				return
+			}
+			lastRecv.Store(time.Now().UnixNano())
+
+			switch typ {
+			case PacketData:
+				t.rx.Add(uint64(len(payload)))
+				if _, err := t.device.Write(payload); err != nil && !errors.Is(err, tun.ErrClosed) {
+					t.logger.Printf("error writing packet to tunnel device: %v", err)
+				}
+			case PacketDPDReq:
+				if err := write(PacketDPDResp, payload); err != nil {
+					errc <- err
+					return
+				}
+			case PacketDPDResp:
+				t.logDPD(ChannelTLS, &dpdSent)
+			case PacketDisconnect, PacketTerminate:
+				errc <- errServerDisconnect
+				return
+			}
+		}
+	}()
+
+	config := ch.Config
+	var rekey <-chan time.Time
+	if config.RekeyTime > 0 && config.RekeyMethod != RekeyNone {
+		timer := time.NewTimer(config.RekeyTime)
+		defer timer.Stop()
+		rekey = timer.C
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			ch.conn.SetWriteDeadline(time.Now().Add(time.Second))
+			write(PacketDisconnect, []byte{disconnectReason})
+			return ctx.Err()
+
+		case err := <-errc:
+			return err
+
+		case <-rekey:
+			return errRekey
+
+		case conn := <-udpReady:
+			udpPending = false
+			if conn == nil {
+				udpRetry = time.After(dtlsRetryInterval)
+				continue
+			}
+			udp = newDTLSLink(conn)
+			udpErrc = udp.errc
+			if config.DTLS.RekeyTime > 0 {
+				udpRekey = time.After(config.DTLS.RekeyTime)
+			}
+			go t.readDTLS(udp)
+			t.channel.Store(ChannelDTLS)
+			t.logger.Printf("dtls data channel established, switched from tls to dtls")
+
+		case err := <-udpErrc:
+			if errors.Is(err, errServerDisconnect) {
+				return err
+			}
+			fallbackTLS(err)
+
+		case <-udpRetry:
+			startDTLS()
+
+		case <-udpRekey:
+			udp.conn.Close()
+			udp, udpErrc, udpRekey = nil, nil, nil
+			t.channel.Store(ChannelTLS)
+			t.logger.Printf("dtls rekey interval reached, establishing a new dtls channel")
+			startDTLS()
+
+		case packet, ok := <-t.outbound:
+			if !ok {
+				return tun.ErrClosed
+			}
+			if udp != nil {
+				if err := udp.write(PacketData, packet); err == nil {
+					t.tx.Add(uint64(len(packet)))
+					udp.lastSend = time.Now()
+					continue
+				} else {
+					fallbackTLS(err)
+				}
+			}
+			if err := write(PacketData, packet); err != nil {
+				return err
+			}
+			t.tx.Add(uint64(len(packet)))
+			lastSend = time.Now()
+
+		case now := <-ticker.C:
+			idle := now.Sub(time.Unix(0, lastRecv.Load()))
+			if config.DPD > 0 && idle >= t.missedLimit()*config.DPD {
+				return fmt.Errorf("%w for %s", errDeadPeer, idle.Round(time.Second))
+			}
+			if config.DPD > 0 && idle >= config.DPD && now.Sub(lastDPD) >= config.DPD {
+				if err := write(PacketDPDReq, nil); err != nil {
+					return err
+				}
+				lastSend, lastDPD = now, now
+				dpdSent.Store(now.UnixNano())
+			}
+			if config.Keepalive > 0 && now.Sub(lastSend) >= config.Keepalive {
+				if err := write(PacketKeepalive, nil); err != nil {
+					return err
+				}
+				lastSend = now
+			}
+
+			if udp != nil {
+				if err := t.checkDTLS(udp, config.DTLS, now); err != nil {
+					fallbackTLS(err)
+				}
+			}
+		}
+	}
+}
+
+// checkDTLS sends dpd and keepalive probes over the dtls link, an
+// error is returned once the link is considered dead.
+func (t *Tunnel) checkDTLS(l *dtlsLink, config *DTLSConfig, now time.Time) error {
+	idle := now.Sub(time.Unix(0, l.lastRecv.Load()))
+	if config.DPD > 0 && idle >= t.missedLimit()*config.DPD {
+		return fmt.Errorf("no response for %s", idle.Round(time.Second))
+	}
+	if config.DPD > 0 && idle >= config.DPD && now.Sub(l.lastDPD) >= config.DPD {
+		if err := l.write(PacketDPDReq, nil); err != nil {
+			return err
+		}
+		l.lastSend, l.lastDPD = now, now
+		l.dpdSent.Store(now.UnixNano())
+	}
+	if config.Keepalive > 0 && now.Sub(l.lastSend) >= config.Keepalive {
+		if err := l.write(PacketKeepalive, nil); err != nil {
+			return err
+		}
+		l.lastSend = now
+	}
+	return nil
+}
+
+// missedLimit is the number of dpd intervals without
+// any data from server after which the peer is dead.
+func (t *Tunnel) missedLimit() time.Duration {
+	if n := t.dialer.Liveness.MaxMissed; n > 0 {
+		return time.Duration(n)
+	}
+	return dpdMissedLimit
+}
+
+// logDPD logs the round trip time of the dpd request sent at the
+// time held by sent, responses without a pending request are ignored.
+func (t *Tunnel) logDPD(channel string, sent *atomic.Int64) {
+	if at := sent.Swap(0); at != 0 {
+		rtt := time.Since(time.Unix(0, at))
+		t.logger.Printf("dpd response over %s in %s", channel, rtt.Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,143 @@
+package anyconnect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"snixconnect/internal/backend"
+	"snixconnect/internal/tun"
+)
+
+// newTestDialer returns a dialer for a server which hands the n-th cstp
+// connect, counted from 1, to serve.
+func newTestDialer(t *testing.T, serve func(n int32, w http.ResponseWriter, r *http.Request)) *Dialer {
+	var connects atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serve(connects.Add(1), w, r)
+	}))
+	t.Cleanup(srv.Close)
+	server, err := parseServer(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Dialer{Server: server, Cookie: testCookie, DisableDTLS: true,
+		TLSConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig}
+}
+
+// dropFirst drops the channel of the first connect, answers the following
+// ones up to the n-th with status and connects all after.
+func dropFirst(t *testing.T, status, n int32, connects *atomic.Int32) func(int32, http.ResponseWriter, *http.Request) {
+	return func(i int32, w http.ResponseWriter, r *http.Request) {
+		connects.Store(i)
+		if i > 1 && i <= n {
+			http.Error(w, http.StatusText(int(status)), int(status))
+			return
+		}
+		gw := &gateway{t: t, done: make(chan struct{}), hangUp: i == 1}
+		gw.serveCSTP(w, r)
+	}
+}
+
+// runTunnel runs a tunnel from the first channel of d until it ends or
+// the link is up again, which cancels it.
+func runTunnel(t *testing.T, d *Dialer, dev tun.Device, redial func(int, error) (time.Duration, bool)) (bool, error) {
+	ch, err := d.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var up bool
+	status := func(s backend.Status, _ *TunnelConfig) error {
+		if s == backend.StatusConnected {
+			up = true
+			cancel()
+		}
+		return nil
+	}
+	tunnel := NewTunnel(d, dev, testLogger{t})
+	tunnel.Redial = redial
+	return up, tunnel.Run(ctx, ch, status)
+}
+
+func TestTunnelDeviceFailed(t *testing.T) {
+	var connects atomic.Int32
+	d := newTestDialer(t, func(n int32, w http.ResponseWriter, r *http.Request) {
+		connects.Store(n)
+		gw := &gateway{t: t, done: make(chan struct{})}
+		gw.serveCSTP(w, r)
+	})
+	dev, _ := tun.NewMemoryPipe(1400)
+	dev.Close()
+
+	up, err := runTunnel(t, d, dev, nil)
+	if !errors.Is(err, tun.ErrClosed) || up {
+		t.Errorf("got error %v, link up %v, want the device error", err, up)
+	}
+	if n := connects.Load(); n != 1 {
+		t.Errorf("channel dialed %d times", n)
+	}
+}
+
+func TestTunnelRedial(t *testing.T) {
+	var connects atomic.Int32
+	d := newTestDialer(t, dropFirst(t, http.StatusServiceUnavailable, 3, &connects))
+	dev, _ := tun.NewMemoryPipe(1400)
+	defer dev.Close()
+
+	var attempts []int
+	up, err := runTunnel(t, d, dev, func(attempt int, err error) (time.Duration, bool) {
+		attempts = append(attempts, attempt)
+		return time.Millisecond, true
+	})
+	if err != nil || !up {
+		t.Fatalf("got error %v, link up %v", err, up)
+	}
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Errorf("redial asked for attempts %v, want [1 2]", attempts)
+	}
+	if n := connects.Load(); n != 4 {
+		t.Errorf("channel dialed %d times, want 4", n)
+	}
+}
+
+func TestTunnelRedialGivesUp(t *testing.T) {
+	var connects atomic.Int32
+	d := newTestDialer(t, dropFirst(t, http.StatusServiceUnavailable, 10, &connects))
+	dev, _ := tun.NewMemoryPipe(1400)
+	defer dev.Close()
+
+	up, err := runTunnel(t, d, dev, func(attempt int, err error) (time.Duration, bool) {
+		return 0, attempt < 2
+	})
+	if up || backend.KindOf(err) != backend.ErrConnFailed {
+		t.Errorf("got error %v, link up %v, want connection failed", err, up)
+	}
+	if n := connects.Load(); n != 3 {
+		t.Errorf("channel dialed %d times, want 3", n)
+	}
+}
+
+func TestTunnelRedialRejected(t *testing.T) {
+	var connects atomic.Int32
+	d := newTestDialer(t, dropFirst(t, http.StatusUnauthorized, 10, &connects))
+	dev, _ := tun.NewMemoryPipe(1400)
+	defer dev.Close()
+
+	up, err := runTunnel(t, d, dev, func(attempt int, err error) (time.Duration, bool) {
+		t.Errorf("redial asked after a refused cookie: %v", err)
+		return 0, true
+	})
+	// a connection failure makes the handler log in again
+	if up || backend.KindOf(err) != backend.ErrConnFailed {
+		t.Errorf("got error %v, link up %v, want connection failed", err, up)
+	}
+	if n := connects.Load(); n != 2 {
+		t.Errorf("channel dialed %d times, want 2", n)
+	}
+}
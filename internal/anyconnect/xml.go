@@ -0,0 +1,103 @@
+package anyconnect
+
+import "encoding/xml"
+
+const (
+	aggregateAuthVersion = "2"
+	clientVersion        = "v9.12"
+	deviceID             = "win"
+)
+
+const (
+	typeInit        = "init"
+	typeAuthReply   = "auth-reply"
+	typeAuthRequest = "auth-request"
+	typeComplete    = "complete"
+)
+
+type xmlVersion struct {
+	Who   string `xml:"who,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlOpaque struct {
+	IsFor string `xml:"is-for,attr,omitempty"`
+	Inner string `xml:",innerxml"`
+}
+
+type xmlAnswer struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type xmlReplyAuth struct {
+	Answers []xmlAnswer
+}
+
+// configAuthReply is what the client sends, both init and auth-reply.
+type configAuthReply struct {
+	XMLName     xml.Name      `xml:"config-auth"`
+	Client      string        `xml:"client,attr"`
+	Type        string        `xml:"type,attr"`
+	AggVersion  string        `xml:"aggregate-auth-version,attr"`
+	Version     xmlVersion    `xml:"version"`
+	DeviceID    string        `xml:"device-id"`
+	GroupAccess string        `xml:"group-access,omitempty"`
+	Opaque      *xmlOpaque    `xml:"opaque,omitempty"`
+	Auth        *xmlReplyAuth `xml:"auth,omitempty"`
+	GroupSelect string        `xml:"group-select,omitempty"`
+}
+
+type xmlOption struct {
+	Value    string `xml:"value,attr"`
+	Selected string `xml:"selected,attr"`
+	Text     string `xml:",chardata"`
+}
+
+type xmlInput struct {
+	Type    string      `xml:"type,attr"`
+	Name    string      `xml:"name,attr"`
+	Label   string      `xml:"label,attr"`
+	Value   string      `xml:"value,attr"`
+	Options []xmlOption `xml:"option"`
+}
+
+type xmlForm struct {
+	Method  string     `xml:"method,attr"`
+	Action  string     `xml:"action,attr"`
+	Inputs  []xmlInput `xml:"input"`
+	Selects []xmlInput `xml:"select"`
+}
+
+type xmlMessage struct {
+	ID    string `xml:"id,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlAuth struct {
+	ID      string      `xml:"id,attr"`
+	Title   string      `xml:"title"`
+	Message xmlMessage  `xml:"message"`
+	Banner  string      `xml:"banner"`
+	Error   *xmlMessage `xml:"error"`
+	Form    xmlForm     `xml:"form"`
+}
+
+type xmlVpnBaseConfig struct {
+	ServerCertHash string `xml:"server-cert-hash"`
+}
+
+type xmlConfig struct {
+	VpnBaseConfig xmlVpnBaseConfig `xml:"vpn-base-config"`
+}
+
+// configAuth is what the server sends back, auth-request or complete.
+type configAuth struct {
+	XMLName      xml.Name   `xml:"config-auth"`
+	Type         string     `xml:"type,attr"`
+	Opaque       *xmlOpaque `xml:"opaque"`
+	Auth         xmlAuth    `xml:"auth"`
+	SessionID    string     `xml:"session-id"`
+	SessionToken string     `xml:"session-token"`
+	Config       xmlConfig  `xml:"config"`
+}
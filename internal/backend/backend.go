@@ -0,0 +1,126 @@
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"snixconnect/internal/dnsconf"
+	"snixconnect/internal/route"
+	"snixconnect/internal/tlsconf"
+	"snixconnect/internal/tun"
+)
+
+// Backend is implemented by every vpn library that drives the gui, Connect
+// blocks until the session ends, status changes are sent to events and the
+// returned error describes why the session has ended (nil on user request).
+type Backend interface {
+	Connect(ctx context.Context, conf *Config, events chan<- Event) error
+}
+
+// Prompter is provided by the gui so a backend can interact with the user,
+// Credential shows form and returns the answers keyed by field name.
+// TrustCertificate asks the user whether to pin the certificate chain
+// of host which failed validation with reason.
+type Prompter interface {
+	Credential(form *Form) (map[string]string, bool)
+	Banner(banner string)
+	TrustCertificate(host string, chain []*x509.Certificate, reason error) (tlsconf.Pin, bool)
+}
+
+type Logger interface {
+	Printf(string, ...any)
+	Print(...any)
+}
+
+type Config struct {
+	Server        string
+	SkipTLSVerify bool
+	Pins          []tlsconf.Pin
+	TLS           tlsconf.Options
+	ClientCert    *tls.Certificate
+	DisableDTLS   bool
+	Liveness      Liveness
+	Routes        route.Options
+	DNS           dnsconf.Options
+	TunnelGUID    [16]byte
+	Prompt        Prompter
+	Logger        Logger
+
+	// Dial opens the tcp connections to the gateway, e.g. through
+	// a proxy, nil dials directly.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// DisableIPv6 unbinds ipv6 from the physical adapters while
+	// connected, so ipv6 traffic can't leak outside of the tunnel.
+	DisableIPv6 bool
+
+	// AllowServer returns an error when the server may not be connected
+	// to, it is asked before following a redirect to another server.
+	AllowServer func(server string) error
+
+	// OpenDevice overrides the platform tunnel device, e.g. with
+	// an in-memory device when the data path runs under test.
+	OpenDevice func(mtu int) (tun.Device, error)
+
+	// Redial tells whether and after which delay a lost data channel is
+	// dialed again with the session, attempt counts from 1. Nil gives
+	// up once the first dial failed.
+	Redial func(attempt int, err error) (time.Duration, bool)
+}
+
+// Liveness overrides the dead peer detection and keepalive intervals the
+// server pushed, zero keeps the server value. The link is considered dead
+// once nothing was received for MaxMissed dpd intervals.
+type Liveness struct {
+	DPD       time.Duration
+	Keepalive time.Duration
+	MaxMissed int
+}
+
+type Factory func() Backend
+
+var registry = struct {
+	sync.RWMutex
+	factories map[string]Factory
+}{factories: make(map[string]Factory)}
+
+// Register makes a backend available by name, it panics if the
+// same name is registered twice or factory is nil.
+func Register(name string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+	if factory == nil {
+		panic("backend: register factory is nil")
+	}
+	if _, dup := registry.factories[name]; dup {
+		panic("backend: register called twice for backend " + name)
+	}
+	registry.factories[name] = factory
+}
+
+func New(name string) (Backend, error) {
+	registry.RLock()
+	factory, ok := registry.factories[name]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown vpn backend %q", name)
+	}
+	return factory(), nil
+}
+
+func Names() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,62 @@
+package backend
+
+import "errors"
+
+type ErrorKind byte
+
+const (
+	ErrConnFailed ErrorKind = iota
+	ErrAuthFailed
+	ErrRejected
+	ErrCanceled
+)
+
+func (k ErrorKind) Error() string {
+	switch k {
+	case ErrAuthFailed:
+		return "authentication failed"
+	case ErrRejected:
+		return "session rejected by server"
+	case ErrCanceled:
+		return "canceled by user"
+	}
+	return "connection failed"
+}
+
+// Error is returned by backends, errors.Is(err, ErrAuthFailed) and
+// friends can be used to find out what went wrong.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func NewError(kind ErrorKind, err error) error {
+	return &Error{Kind: kind, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error()
+	}
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (e *Error) Is(target error) bool {
+	kind, ok := target.(ErrorKind)
+	return ok && kind == e.Kind
+}
+
+// KindOf returns ErrConnFailed for errors not created by NewError.
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	var kind ErrorKind
+	if errors.As(err, &kind) {
+		return kind
+	}
+	return ErrConnFailed
+}
@@ -0,0 +1,45 @@
+package backend
+
+type FieldType byte
+
+const (
+	FieldText FieldType = iota
+	FieldPassword
+	FieldSelect
+	FieldCheckbox
+)
+
+const (
+	CheckboxOn  = "true"
+	CheckboxOff = "false"
+)
+
+// FormField is a single input of a credential form, Value is the
+// default answer and Options is only used by FieldSelect.
+type FormField struct {
+	Name    string
+	Label   string
+	Type    FieldType
+	Value   string
+	Options []GroupSelect
+}
+
+// Form describes what the server asks from the user, one login may
+// need several forms (group change, challenge/response). Answers are
+// keyed by field name, checkbox answers are CheckboxOn or CheckboxOff.
+type Form struct {
+	Title   string
+	Message string
+	Banner  string
+	Fields  []FormField
+}
+
+// Field returns the first field of type t or nil.
+func (f *Form) Field(t FieldType) *FormField {
+	for i := range f.Fields {
+		if f.Fields[i].Type == t {
+			return &f.Fields[i]
+		}
+	}
+	return nil
+}
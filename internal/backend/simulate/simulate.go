@@ -0,0 +1,26 @@
+package simulate
+
+import (
+	"context"
+	"snixconnect/internal/backend"
+)
+
+const Name = "simulate"
+
+func init() {
+	backend.Register(Name, func() backend.Backend { return new(simulator) })
+}
+
+// simulator never connects, it is here for building the gui without
+// a real vpn library.
+type simulator struct{}
+
+func (*simulator) Connect(ctx context.Context, conf *backend.Config, events chan<- backend.Event) error {
+	select {
+	case events <- backend.Event{Status: backend.StatusConnecting}:
+	case <-ctx.Done():
+		return nil
+	}
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,60 @@
+package backend
+
+import "time"
+
+type Status byte
+
+const (
+	StatusConnecting Status = iota
+	StatusConnected
+	StatusReconnecting
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusConnecting:
+		return "connecting"
+	case StatusConnected:
+		return "connected"
+	case StatusReconnecting:
+		return "reconnecting"
+	}
+	return "unknown"
+}
+
+// Event is sent by a backend whenever the session status changes,
+// Stats is only set when Status is StatusConnected.
+type Event struct {
+	Status Status
+	Stats  *ConnectionStats
+}
+
+type ConnectionStats struct {
+	ConnectedSince   time.Time
+	Gateway          string
+	MTU              uint16
+	DNS              []string
+	TunIPv4, Netmask string
+	TunIPv6          string
+	SplitInclude     []string
+	SplitExclude     []string
+	Routes           []string
+	ExcludedRoutes   []string
+	SplitDNS         []string
+	DNSSuffixes      []string
+	RX, TX           func() uint64
+	DataChannel      func() string
+
+	// TunnelLUID identifies the network interface
+	// of the tunnel device, zero when unknown.
+	TunnelLUID uint64
+
+	// IPv6DisabledOn names the physical adapters ipv6
+	// is unbound from while the tunnel is up.
+	IPv6DisabledOn []string
+}
+
+type GroupSelect struct {
+	Name         string
+	FriendlyName string
+}
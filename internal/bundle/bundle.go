@@ -0,0 +1,309 @@
+package bundle
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"snixconnect/internal/dnsconf"
+	"snixconnect/internal/route"
+	"snixconnect/internal/tlsconf"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	fileFormat  = "snixconnect-bundle"
+	fileVersion = 1
+
+	// signContext is prepended to the payload when it is signed so a
+	// signature made for something else doesn't verify as a bundle.
+	signContext = "snixconnect-bundle-v1\n"
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	keyLen  = 32
+)
+
+var (
+	ErrPassphraseRequired = errors.New("the bundle is encrypted, enter its passphrase")
+	ErrPassphrase         = errors.New("wrong passphrase or damaged bundle")
+	ErrSignature          = errors.New("the signature of the bundle doesn't match, it has been changed after signing")
+)
+
+// Profile is a server as it is handed out in a bundle, credentials other
+// than the username are never part of it.
+type Profile struct {
+	Name     string
+	Server   string
+	Group    string `json:",omitempty"`
+	Username string `json:",omitempty"`
+	Backend  string `json:",omitempty"`
+	TLS      tlsconf.Options
+	Pins     []tlsconf.Pin `json:",omitempty"`
+	Routes   route.Options
+	DNS      dnsconf.Options
+}
+
+// Bundle holds profiles with the ca certificates and pins trusted for
+// all of them, see Resolve.
+type Bundle struct {
+	Profiles []Profile
+
+	// CACertificates are pem certificates added to the CA bundle of
+	// every profile.
+	CACertificates string `json:",omitempty"`
+
+	// Pins are added to the profiles whose server host they are for.
+	Pins []tlsconf.Pin `json:",omitempty"`
+}
+
+func (b *Bundle) Validate() error {
+	if len(b.Profiles) == 0 {
+		return errors.New("the bundle holds no profiles")
+	}
+	names := make(map[string]bool)
+	for _, p := range b.Profiles {
+		if len(strings.TrimSpace(p.Name)) == 0 || len(strings.TrimSpace(p.Server)) == 0 {
+			return errors.New("every profile of the bundle needs a name and a server")
+		}
+		if names[strings.ToLower(p.Name)] {
+			return fmt.Errorf("the bundle holds profile %q twice", p.Name)
+		}
+		names[strings.ToLower(p.Name)] = true
+		if err := p.TLS.Validate(); err != nil {
+			return fmt.Errorf("profile %q: %v", p.Name, err)
+		}
+	}
+	if len(b.CACertificates) > 0 {
+		if _, _, err := tlsconf.ParseCABundle(b.CACertificates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resolve returns the profiles with the ca certificates and pins of the
+// bundle merged in.
+func (b *Bundle) Resolve() []Profile {
+	profiles := make([]Profile, len(b.Profiles))
+	for i, p := range b.Profiles {
+		if len(b.CACertificates) > 0 && !strings.Contains(p.TLS.CABundle, b.CACertificates) {
+			p.TLS.CABundle = joinPEM(p.TLS.CABundle, b.CACertificates)
+		}
+		p.Pins = append([]tlsconf.Pin(nil), p.Pins...)
+		host := serverHost(p.Server)
+		for _, pin := range b.Pins {
+			if strings.EqualFold(pin.Host, host) && !hasPin(p.Pins, pin) {
+				p.Pins = append(p.Pins, pin)
+			}
+		}
+		profiles[i] = p
+	}
+	return profiles
+}
+
+type file struct {
+	Format     string      `json:"format"`
+	Version    int         `json:"version"`
+	Encryption *encryption `json:"encryption,omitempty"`
+	Signature  *signature  `json:"signature,omitempty"`
+
+	// Payload is the json encoded bundle, sealed when Encryption is set.
+	Payload []byte `json:"payload"`
+}
+
+// encryption derives an aes-256-gcm key from the passphrase with scrypt.
+type encryption struct {
+	KDF   string `json:"kdf"`
+	Salt  []byte `json:"salt"`
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	Nonce []byte `json:"nonce"`
+}
+
+// signature is an ed25519 signature over signContext and the payload as
+// stored, so it is checked before the payload is decrypted.
+type signature struct {
+	PublicKey []byte `json:"publicKey"`
+	Signature []byte `json:"signature"`
+}
+
+// Encode returns b as a bundle file. An empty passphrase leaves it in the
+// clear and a nil key leaves it unsigned.
+func Encode(b *Bundle, passphrase string, key ed25519.PrivateKey) ([]byte, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	f := file{Format: fileFormat, Version: fileVersion, Payload: payload}
+	if len(passphrase) > 0 {
+		if f.Encryption, f.Payload, err = seal(payload, passphrase); err != nil {
+			return nil, err
+		}
+	}
+	if key != nil {
+		f.Signature = &signature{
+			PublicKey: key.Public().(ed25519.PublicKey),
+			Signature: ed25519.Sign(key, signedMessage(f.Payload)),
+		}
+	}
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// Decode verifies and opens a bundle file, signer is nil when the bundle
+// isn't signed. Whether the signer is trusted is up to the caller.
+func Decode(data []byte, passphrase string) (b *Bundle, signer ed25519.PublicKey, err error) {
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil || f.Format != fileFormat {
+		return nil, nil, errors.New("not a snixconnect profile bundle")
+	}
+	if f.Version != fileVersion {
+		return nil, nil, fmt.Errorf("unsupported bundle version %d", f.Version)
+	}
+	if f.Signature != nil {
+		if len(f.Signature.PublicKey) != ed25519.PublicKeySize ||
+			!ed25519.Verify(f.Signature.PublicKey, signedMessage(f.Payload), f.Signature.Signature) {
+			return nil, nil, ErrSignature
+		}
+		signer = f.Signature.PublicKey
+	}
+	payload := f.Payload
+	if f.Encryption != nil {
+		if len(passphrase) == 0 {
+			return nil, nil, ErrPassphraseRequired
+		}
+		if payload, err = open(f.Encryption, f.Payload, passphrase); err != nil {
+			return nil, nil, err
+		}
+	}
+	b = new(Bundle)
+	if err := json.Unmarshal(payload, b); err != nil {
+		return nil, nil, fmt.Errorf("invalid bundle: %v", err)
+	}
+	if err := b.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return b, signer, nil
+}
+
+func signedMessage(payload []byte) []byte {
+	return append([]byte(signContext), payload...)
+}
+
+func seal(plain []byte, passphrase string) (*encryption, []byte, error) {
+	e := &encryption{KDF: "scrypt", Salt: make([]byte, 16), N: scryptN, R: scryptR, P: scryptP}
+	if _, err := rand.Read(e.Salt); err != nil {
+		return nil, nil, err
+	}
+	aead, err := e.aead(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return nil, nil, err
+	}
+	return e, aead.Seal(nil, e.Nonce, plain, nil), nil
+}
+
+func open(e *encryption, sealed []byte, passphrase string) ([]byte, error) {
+	if e.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported bundle key derivation %q", e.KDF)
+	}
+	aead, err := e.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != aead.NonceSize() {
+		return nil, ErrPassphrase
+	}
+	plain, err := aead.Open(nil, e.Nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	return plain, nil
+}
+
+func (e *encryption) aead(passphrase string) (cipher.AEAD, error) {
+	// keep a crafted file from making the import hang or run out of memory
+	if e.N > 1<<18 || e.R > 8 || e.P > 4 {
+		return nil, errors.New("bundle key derivation parameters are too large")
+	}
+	key, err := scrypt.Key([]byte(passphrase), e.Salt, e.N, e.R, e.P, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle key derivation: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ParseSigningKey returns the ed25519 key of a pem PKCS#8 private key,
+// as written by openssl genpkey -algorithm ed25519.
+func ParseSigningKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no pem private key found in signing key file")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %v", err)
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("the signing key is not an ed25519 key")
+	}
+	return ed, nil
+}
+
+// KeyFingerprint is the hex encoded sha256 digest of a public key, it is
+// what trusted signers are kept by.
+func KeyFingerprint(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
+
+func joinPEM(a, b string) string {
+	if len(a) == 0 {
+		return b
+	}
+	return strings.TrimRight(a, "\n") + "\n" + b
+}
+
+func hasPin(pins []tlsconf.Pin, pin tlsconf.Pin) bool {
+	for _, p := range pins {
+		if p.Type == pin.Type && strings.EqualFold(p.SHA256, pin.SHA256) {
+			return true
+		}
+	}
+	return false
+}
+
+func serverHost(server string) string {
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
@@ -0,0 +1,141 @@
+package bundle
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"snixconnect/internal/tlsconf"
+)
+
+func testBundle() *Bundle {
+	return &Bundle{
+		Profiles: []Profile{
+			{Name: "Office", Server: "vpn.example.com", Group: "employees", Username: "alice"},
+			{Name: "Lab", Server: "https://lab.example.com:8443/", Pins: []tlsconf.Pin{
+				{Host: "lab.example.com", Type: tlsconf.PinPublicKey, SHA256: "AA"},
+			}},
+		},
+		Pins: []tlsconf.Pin{
+			{Host: "vpn.example.com", Type: tlsconf.PinCertificate, SHA256: "01"},
+			{Host: "LAB.example.com", Type: tlsconf.PinPublicKey, SHA256: "aa"},
+		},
+	}
+}
+
+func TestEncodeSigned(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Encode(testBundle(), "correct horse", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("vpn.example.com")) {
+		t.Error("encrypted bundle holds the server in the clear")
+	}
+
+	b, signer, err := Decode(data, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signer.Equal(pub) {
+		t.Errorf("signer %x, want %x", signer, pub)
+	}
+	if len(b.Profiles) != 2 || b.Profiles[0].Name != "Office" || b.Profiles[0].Username != "alice" {
+		t.Errorf("unexpected profiles %+v", b.Profiles)
+	}
+	if KeyFingerprint(signer) != KeyFingerprint(pub) || len(KeyFingerprint(pub)) != 64 {
+		t.Errorf("fingerprint %q", KeyFingerprint(signer))
+	}
+}
+
+func TestDecodePassphrase(t *testing.T) {
+	data, err := Encode(testBundle(), "correct horse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(data, ""); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("got error %v without passphrase, want %v", err, ErrPassphraseRequired)
+	}
+	if _, _, err := Decode(data, "battery staple"); !errors.Is(err, ErrPassphrase) {
+		t.Errorf("got error %v with wrong passphrase, want %v", err, ErrPassphrase)
+	}
+	b, signer, err := Decode(data, "correct horse")
+	if err != nil || signer != nil || len(b.Profiles) != 2 {
+		t.Errorf("got bundle %+v signed by %x, error %v", b, signer, err)
+	}
+}
+
+func TestDecodeTampered(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Encode(testBundle(), "", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	f.Payload = bytes.Replace(f.Payload, []byte("vpn.example.com"), []byte("vpn.example.net"), 1)
+	tampered, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(tampered, ""); !errors.Is(err, ErrSignature) {
+		t.Errorf("got error %v for a changed payload, want %v", err, ErrSignature)
+	}
+
+	// a valid signature of another key over the changed payload still
+	// decodes, trusting the signer is left to the caller
+	pub, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Signature = &signature{PublicKey: pub, Signature: ed25519.Sign(other, signedMessage(f.Payload))}
+	resigned, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, signer, err := Decode(resigned, ""); err != nil || !signer.Equal(pub) {
+		t.Errorf("got signer %x and error %v", signer, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, b := range []*Bundle{
+		{},
+		{Profiles: []Profile{{Name: "Office"}}},
+		{Profiles: []Profile{{Name: "Office", Server: "a.example.com"}, {Name: "office", Server: "b.example.com"}}},
+		{Profiles: []Profile{{Name: "Office", Server: "a.example.com"}}, CACertificates: "not a certificate"},
+	} {
+		if err := b.Validate(); err == nil {
+			t.Errorf("bundle %+v accepted", b)
+		}
+		if _, err := Encode(b, "", nil); err == nil {
+			t.Errorf("bundle %+v encoded", b)
+		}
+	}
+}
+
+func TestResolvePins(t *testing.T) {
+	b := testBundle()
+	profiles := b.Resolve()
+	if len(profiles[0].Pins) != 1 || profiles[0].Pins[0].SHA256 != "01" {
+		t.Errorf("office pins %+v", profiles[0].Pins)
+	}
+	// the lab pin is in the profile already, only differing in case
+	if len(profiles[1].Pins) != 1 {
+		t.Errorf("lab pins %+v", profiles[1].Pins)
+	}
+	if len(b.Profiles[0].Pins) != 0 {
+		t.Error("resolve changed the pins of the bundle")
+	}
+}
@@ -0,0 +1,80 @@
+package bundle
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"snixconnect/internal/tlsconf"
+)
+
+// Diff lists the settings of old which new changes, one line each.
+func Diff(old, new Profile) []string {
+	var lines []string
+	change := func(name, from, to string) {
+		if from == to {
+			return
+		}
+		if len(from) == 0 {
+			from = "(none)"
+		}
+		if len(to) == 0 {
+			to = "(none)"
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s -> %s", name, from, to))
+	}
+
+	change("Server", old.Server, new.Server)
+	change("Group", old.Group, new.Group)
+	change("Username", old.Username, new.Username)
+	change("VPN backend", old.Backend, new.Backend)
+	change("CA bundle", caSummary(old.TLS.CABundle), caSummary(new.TLS.CABundle))
+	change("Minimum TLS version", old.TLS.MinVersion, new.TLS.MinVersion)
+	change("Cipher suites", strings.Join(old.TLS.CipherSuites, ", "), strings.Join(new.TLS.CipherSuites, ", "))
+	change("Server name", old.TLS.ServerName, new.TLS.ServerName)
+	change("Revocation check", onOff(old.TLS.CheckRevocation), onOff(new.TLS.CheckRevocation))
+	change("Pinned certificates", pinSummary(old.Pins), pinSummary(new.Pins))
+	change("Included routes", prefixes(old.Routes.Include), prefixes(new.Routes.Include))
+	change("Excluded routes", prefixes(old.Routes.Exclude), prefixes(new.Routes.Exclude))
+	change("Local LAN access", onOff(old.Routes.LocalLAN), onOff(new.Routes.LocalLAN))
+	change("Split DNS domains", strings.Join(old.DNS.Domains, ", "), strings.Join(new.DNS.Domains, ", "))
+	change("DNS suffixes", strings.Join(old.DNS.Suffixes, ", "), strings.Join(new.DNS.Suffixes, ", "))
+	return lines
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func caSummary(bundle string) string {
+	if len(bundle) == 0 {
+		return ""
+	}
+	if _, n, err := tlsconf.ParseCABundle(bundle); err == nil {
+		return fmt.Sprintf("%d certificates", n)
+	}
+	return "invalid"
+}
+
+func pinSummary(pins []tlsconf.Pin) string {
+	s := make([]string, len(pins))
+	for i, p := range pins {
+		fp := tlsconf.FormatFingerprint(p.SHA256)
+		if len(fp) > 11 {
+			fp = fp[:11]
+		}
+		s[i] = p.Host + " " + fp
+	}
+	return strings.Join(s, ", ")
+}
+
+func prefixes(p []netip.Prefix) string {
+	s := make([]string, len(p))
+	for i := range p {
+		s[i] = p[i].String()
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,101 @@
+package dnsconf
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Options are the dns settings of a server, Domains are resolved by the
+// tunnel nameservers in addition to the split dns domains the server
+// pushed and Suffixes are added to its default domain.
+type Options struct {
+	Domains  []string
+	Suffixes []string
+}
+
+func (o *Options) IsZero() bool {
+	return len(o.Domains) == 0 && len(o.Suffixes) == 0
+}
+
+// Config is the name resolution of the tunnel, names in Domains and below
+// go to Servers. Without Domains every query goes to Servers. Suffixes are
+// the connection specific search suffixes, the first one is the primary.
+type Config struct {
+	Servers  []netip.Addr
+	Domains  []string
+	Suffixes []string
+}
+
+// Compile merges the nameservers, split dns domains and default domains
+// pushed by the server with opts.
+func Compile(opts Options, servers []netip.Addr, serverDomains, serverSuffixes []string) Config {
+	config := Config{
+		Servers:  servers,
+		Domains:  merge(serverDomains, opts.Domains),
+		Suffixes: merge(serverSuffixes, opts.Suffixes),
+	}
+	if len(servers) == 0 {
+		config.Domains = nil
+	}
+	return config
+}
+
+// ParseDomains parses a list of domain names separated by commas,
+// semicolons or white space. A leading "*." or "." is dropped since
+// every name below a domain matches.
+func ParseDomains(s string) ([]string, error) {
+	var result []string
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\r' || r == '\n'
+	}) {
+		domain := normalize(field)
+		if !validDomain(domain) {
+			return nil, fmt.Errorf("invalid domain name %q", field)
+		}
+		result = append(result, domain)
+	}
+	return merge(result), nil
+}
+
+func normalize(domain string) string {
+	domain = strings.TrimPrefix(strings.TrimSpace(domain), "*")
+	return strings.ToLower(strings.Trim(domain, "."))
+}
+
+func validDomain(domain string) bool {
+	if len(domain) == 0 || len(domain) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// merge returns the valid normalized domains of all lists in
+// order of appearance and without duplicates.
+func merge(lists ...[]string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, d := range list {
+			d = normalize(d)
+			if !validDomain(d) || seen[d] {
+				continue
+			}
+			seen[d] = true
+			result = append(result, d)
+		}
+	}
+	return result
+}
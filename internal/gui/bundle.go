@@ -0,0 +1,100 @@
+package gui
+
+import (
+	"fmt"
+	"strings"
+
+	"snixconnect/internal/bundle"
+	"snixconnect/internal/tlsconf"
+)
+
+// bundleProfile returns p with the options saved for its server as it
+// is written to a bundle.
+func bundleProfile(p *Profile, conf *UserAppConfig) bundle.Profile {
+	bp := bundle.Profile{
+		Name:     p.Name,
+		Server:   p.ServerAddress,
+		Group:    p.Group,
+		Username: p.Username,
+	}
+	if options, ok := conf.Servers[p.ServerAddress]; ok {
+		bp.Backend = options.Backend
+		bp.TLS = options.TLS
+		bp.Pins = options.Pins
+		bp.Routes = options.Routes
+		bp.DNS = options.DNS
+	}
+	return bp
+}
+
+func exportBundle(c *userCredential, conf *UserAppConfig) *bundle.Bundle {
+	b := new(bundle.Bundle)
+	for i := range c.Profiles {
+		b.Profiles = append(b.Profiles, bundleProfile(&c.Profiles[i], conf))
+	}
+	return b
+}
+
+// replacedProfile returns what importing p overwrites, the profile of
+// the same name or else the options saved for its server.
+func replacedProfile(c *userCredential, conf *UserAppConfig, p bundle.Profile) (bundle.Profile, bool) {
+	if existing := c.profile(p.Name); existing != nil {
+		return bundleProfile(existing, conf), true
+	}
+	server, err := bundleServer(p)
+	if err != nil {
+		return bundle.Profile{}, false
+	}
+	if _, ok := conf.Servers[server]; !ok {
+		return bundle.Profile{}, false
+	}
+	return bundleProfile(&Profile{Name: p.Name, ServerAddress: server}, conf), true
+}
+
+func bundleServer(p bundle.Profile) (string, error) {
+	urladdr, err := parseRawURL(strings.TrimSpace(p.Server))
+	if err != nil {
+		return "", fmt.Errorf("profile %q: %v", p.Name, err)
+	}
+	return urladdr.String(), nil
+}
+
+// importProfile saves p to c and conf, overwriting the profile of the
+// same name. The cached password is kept while server and username
+// stay the same.
+func importProfile(c *userCredential, conf *UserAppConfig, p bundle.Profile) error {
+	server, err := bundleServer(p)
+	if err != nil {
+		return err
+	}
+	profile := c.profile(p.Name)
+	if profile == nil {
+		profile = c.newProfile(strings.TrimSpace(p.Name), server)
+	}
+	if profile.ServerAddress != server || profile.Username != p.Username {
+		profile.Password = ""
+	}
+	profile.ServerAddress = server
+	profile.Group, profile.Username = p.Group, p.Username
+	if strings.EqualFold(c.LastProfile, profile.Name) {
+		c.selectProfile(profile.Name)
+	}
+
+	options := conf.Server(server)
+	options.Backend = p.Backend
+	options.TLS = p.TLS
+	options.TLS.CipherSuites = append([]string(nil), p.TLS.CipherSuites...)
+	options.Pins = append([]tlsconf.Pin(nil), p.Pins...)
+	options.Routes = p.Routes
+	options.DNS = p.DNS
+	return nil
+}
+
+func (c *UserAppConfig) trustsSigner(fingerprint string) bool {
+	for _, s := range c.BundleSigners {
+		if strings.EqualFold(s, fingerprint) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,12 +2,27 @@ package gui
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"time"
 	"unsafe"
 
+	"snixconnect/internal/backend"
+	"snixconnect/internal/dnsconf"
+	"snixconnect/internal/killswitch"
+	"snixconnect/internal/proxy"
+	"snixconnect/internal/quota"
+	"snixconnect/internal/retry"
+	"snixconnect/internal/route"
+	"snixconnect/internal/tlsconf"
+	"snixconnect/internal/trustnet"
 	"snixconnect/pkg/walk"
 
 	"golang.org/x/sys/windows"
@@ -19,13 +34,26 @@ const (
 	credentialFileName = "credentials.json"
 	tunDeviceGuid      = "tunnel-guid.bin"
 	crashReportFile    = "crash-report.txt"
+	clientCertDir      = "client-certs\\"
+	dataUsageFileName  = "data-usage.json"
 	filePerm           = 0600
 )
 
 type userCredential struct {
+	SchemaVersion int `json:"schemaVersion"`
+
 	ServerAddress string
 	UserCredential
 	LastConnected bool
+
+	// OTPSecrets holds the otpauth uris keyed by server address,
+	// protected with dpapi.
+	OTPSecrets map[string][]byte
+
+	// Profiles are the saved servers, LastProfile is the name of the
+	// one used last. The fields above mirror it.
+	Profiles    []Profile
+	LastProfile string
 }
 
 type UserCredential struct {
@@ -35,8 +63,253 @@ type UserCredential struct {
 }
 
 type UserAppConfig struct {
+	SchemaVersion int `json:"schemaVersion"`
+
 	SkipTLSVerify   bool
 	CredentialCache bool
+	DisableDTLS     bool
+	AllowPlainHTTP  bool
+	Backend         string
+
+	// Servers holds per server options keyed by server address.
+	Servers map[string]*ServerOptions
+
+	Proxy ProxyOptions
+
+	// KillSwitch blocks the traffic outside of the tunnel.
+	KillSwitch killswitch.Mode
+
+	// TrustedNetwork connects or disconnects by the network in use.
+	TrustedNetwork trustnet.Options
+
+	// Reconnect is the reconnect policy, nil uses the defaults.
+	Reconnect *ReconnectOptions
+
+	// Quota caps the traffic to all servers.
+	Quota quota.Limits
+
+	// BundleSigners are the fingerprints of the keys trusted to sign
+	// profile bundles.
+	BundleSigners []string
+}
+
+type ReconnectOptions struct {
+	// MaxAttempts is the number of retries, zero disables reconnecting.
+	MaxAttempts         int
+	InitialDelaySeconds float64
+	BackoffFactor       float64
+	JitterPercent       float64
+	RetryAuthFailed     bool
+}
+
+func (c *UserAppConfig) ReconnectPolicy() retry.Policy {
+	if c.Reconnect == nil {
+		return retry.DefaultPolicy()
+	}
+	r := c.Reconnect
+	return retry.Policy{
+		MaxAttempts:     r.MaxAttempts,
+		InitialDelay:    time.Duration(r.InitialDelaySeconds * float64(time.Second)),
+		Factor:          r.BackoffFactor,
+		Jitter:          r.JitterPercent / 100,
+		RetryAuthFailed: r.RetryAuthFailed,
+	}
+}
+
+type ProxyOptions struct {
+	Mode     proxy.Mode
+	Address  string
+	Username string
+
+	// Password is protected with dpapi.
+	Password []byte
+}
+
+// Config returns the proxy settings with the password unprotected.
+func (p *ProxyOptions) Config() (proxy.Config, error) {
+	config := proxy.Config{Mode: p.Mode, Address: p.Address, Username: p.Username}
+	if len(p.Password) == 0 {
+		return config, nil
+	}
+	password, err := dpapiUnprotect(p.Password, "proxy password")
+	if err != nil {
+		return config, fmt.Errorf("can not read proxy password: %v", err)
+	}
+	config.Password = string(password)
+	return config, nil
+}
+
+type ServerOptions struct {
+	// ClientCert is the file name of the imported client
+	// certificate in client-certs directory.
+	ClientCert string
+
+	// Pins are the certificates or public keys the user has
+	// trusted for this server after validation failed.
+	Pins []tlsconf.Pin
+
+	// TLS holds the ca bundle and hardening options of the server.
+	TLS tlsconf.Options
+
+	// DPD overrides the dead peer detection pushed by the server.
+	DPD DPDOptions
+
+	// Routes are the split tunnel settings of the server.
+	Routes route.Options
+
+	// DisableIPv6 unbinds ipv6 from the physical adapters while connected.
+	DisableIPv6 bool
+
+	// DNS holds the split dns domains and search suffixes of the server.
+	DNS dnsconf.Options
+
+	// Quota caps the traffic to this server.
+	Quota quota.Limits
+
+	// Backend is the name of the vpn backend, empty uses the global one.
+	Backend string
+}
+
+// DPDOptions are in seconds, zero keeps the server value
+// and the default limit of missed probes.
+type DPDOptions struct {
+	IntervalSeconds  int
+	KeepaliveSeconds int
+	MaxMissed        int
+}
+
+func (o DPDOptions) Liveness() backend.Liveness {
+	return backend.Liveness{
+		DPD:       time.Duration(o.IntervalSeconds) * time.Second,
+		Keepalive: time.Duration(o.KeepaliveSeconds) * time.Second,
+		MaxMissed: o.MaxMissed,
+	}
+}
+
+// Server returns the options of server, a new entry is added if
+// there is none yet.
+func (c *UserAppConfig) Server(server string) *ServerOptions {
+	if c.Servers == nil {
+		c.Servers = make(map[string]*ServerOptions)
+	}
+	if _, ok := c.Servers[server]; !ok {
+		c.Servers[server] = new(ServerOptions)
+	}
+	return c.Servers[server]
+}
+
+// clone returns a copy of c which shares no server options with c.
+func (c *UserAppConfig) clone() *UserAppConfig {
+	config := *c
+	config.Servers = make(map[string]*ServerOptions, len(c.Servers))
+	for k, v := range c.Servers {
+		options := *v
+		options.Pins = append([]tlsconf.Pin(nil), v.Pins...)
+		options.TLS.CipherSuites = append([]string(nil), v.TLS.CipherSuites...)
+		options.Routes.Include = append([]netip.Prefix(nil), v.Routes.Include...)
+		options.Routes.Exclude = append([]netip.Prefix(nil), v.Routes.Exclude...)
+		options.DNS.Domains = append([]string(nil), v.DNS.Domains...)
+		options.DNS.Suffixes = append([]string(nil), v.DNS.Suffixes...)
+		options.Quota.Thresholds = append([]int(nil), v.Quota.Thresholds...)
+		config.Servers[k] = &options
+	}
+	config.TrustedNetwork.Rules = append([]trustnet.Rule(nil), c.TrustedNetwork.Rules...)
+	config.Quota.Thresholds = append([]int(nil), c.Quota.Thresholds...)
+	config.BundleSigners = append([]string(nil), c.BundleSigners...)
+	if c.Reconnect != nil {
+		reconnect := *c.Reconnect
+		config.Reconnect = &reconnect
+	}
+	return &config
+}
+
+// configMigrations upgrade app-config.json and credentialMigrations
+// credentials.json, the one at index i from schema version i to i+1.
+var (
+	configMigrations = []migration{
+		// 1: files from before versioning have the same layout
+		func(map[string]json.RawMessage) error { return nil },
+	}
+	credentialMigrations = []migration{
+		// 1: the single server becomes a profile
+		migrateCredentialProfiles,
+		// 2: totp tokens are protected with dpapi
+		migrateCredentialOTPSecrets,
+	}
+)
+
+// legacyCredential is the single server layout of credentials.json
+// before profiles.
+type legacyCredential struct {
+	ServerAddress string
+	Username      string
+	Password      string
+	Group         string
+	LastConnected bool
+}
+
+// migrateCredentialProfiles only reads the keys of the single server
+// layout, the rest of the file may hold fields of any later layout.
+func migrateCredentialProfiles(doc map[string]json.RawMessage) error {
+	if raw, ok := doc["Profiles"]; ok {
+		var profiles []json.RawMessage
+		if err := json.Unmarshal(raw, &profiles); err == nil && len(profiles) > 0 {
+			return nil
+		}
+	}
+	owned := make(map[string]json.RawMessage)
+	for _, key := range []string{"ServerAddress", "Username", "Password", "Group", "LastConnected"} {
+		if raw, ok := doc[key]; ok {
+			owned[key] = raw
+		}
+	}
+	data, err := json.Marshal(owned)
+	if err != nil {
+		return err
+	}
+	var c legacyCredential
+	if err := json.Unmarshal(data, &c); err != nil {
+		return err
+	}
+	if len(c.ServerAddress) == 0 {
+		return nil
+	}
+	profile := struct {
+		Name string
+		legacyCredential
+	}{profileName(c.ServerAddress), c}
+	if doc["Profiles"], err = json.Marshal([]interface{}{profile}); err != nil {
+		return err
+	}
+	doc["LastProfile"], err = json.Marshal(profile.Name)
+	return err
+}
+
+// migrateCredentialOTPSecrets protects the otpauth uris, which files
+// before schema version 2 keep in the clear.
+func migrateCredentialOTPSecrets(doc map[string]json.RawMessage) error {
+	raw, ok := doc["OTPSecrets"]
+	if !ok {
+		return nil
+	}
+	var plain map[string]string
+	if err := json.Unmarshal(raw, &plain); err != nil {
+		return err
+	}
+	protected := make(map[string][]byte, len(plain))
+	for server, uri := range plain {
+		if len(uri) == 0 {
+			continue
+		}
+		data, err := dpapiProtect([]byte(uri))
+		if err != nil {
+			return fmt.Errorf("can not protect totp token of %s: %v", server, err)
+		}
+		protected[server] = data
+	}
+	var err error
+	doc["OTPSecrets"], err = json.Marshal(protected)
+	return err
 }
 
 const guidStructLen = int(unsafe.Sizeof(windows.GUID{}))
@@ -135,19 +408,8 @@ func loadUserCerdential() (u *userCredential, err error) {
 		}
 	}()
 
-	path, err := mkdirLocalAppConfig(localAppDirByCmd)
-	if err != nil {
-		return nil, err
-	}
-
-	f, err := os.OpenFile(path+credentialFileName, os.O_RDONLY, filePerm)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
 	var user = new(userCredential)
-	return user, json.NewDecoder(f).Decode(user)
+	return user, loadJSONFile(credentialFileName, user, credentialMigrations)
 }
 
 func loadUserAppConfig() (u *UserAppConfig, err error) {
@@ -157,20 +419,8 @@ func loadUserAppConfig() (u *UserAppConfig, err error) {
 		}
 	}()
 
-	path, err := mkdirLocalAppConfig(localAppDirByCmd)
-	if err != nil {
-		return nil, err
-	}
-
-	f, err := os.OpenFile(path+appConfigFileName, os.O_RDONLY, filePerm)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
 	var config = new(UserAppConfig)
-	err = json.NewDecoder(f).Decode(config)
-	return config, err
+	return config, loadJSONFile(appConfigFileName, config, configMigrations)
 }
 
 func saveUserAppConfig(appconf *UserAppConfig) (err error) {
@@ -180,22 +430,35 @@ func saveUserAppConfig(appconf *UserAppConfig) (err error) {
 		}
 	}()
 
-	path, err := mkdirLocalAppConfig(localAppDirByCmd)
-	if err != nil {
-		return err
-	}
+	appconf.SchemaVersion = len(configMigrations)
+	return saveJSONFile(appConfigFileName, appconf)
+}
 
-	flag := os.O_RDWR | os.O_CREATE | os.O_TRUNC
-	f, err := os.OpenFile(path+appConfigFileName, flag, filePerm)
-	if err != nil {
-		return err
+func loadDataUsage() (usage quota.Usage, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error: loading data usage: %v", err)
+		}
+	}()
+
+	err = loadJSONFile(dataUsageFileName, &usage, nil)
+	if os.IsNotExist(err) {
+		return make(quota.Usage), nil
 	}
-	defer f.Close()
-	err = json.NewEncoder(f).Encode(appconf)
-	if err != nil {
-		return
+	if usage == nil {
+		usage = make(quota.Usage)
 	}
-	return f.Sync()
+	return usage, err
+}
+
+func saveDataUsage(usage quota.Usage) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error: saving data usage: %v", err)
+		}
+	}()
+
+	return saveJSONFile(dataUsageFileName, usage)
 }
 
 func mkdirLocalAppConfig(dirPath string) (string, error) {
@@ -219,32 +482,160 @@ func saveUserCredential(user *userCredential) (err error) {
 			err = fmt.Errorf("error: saving credentials: %v", err)
 		}
 	}()
-	path, err := mkdirLocalAppConfig(localAppDirByCmd)
+	user.SchemaVersion = len(credentialMigrations)
+	return saveJSONFile(credentialFileName, user)
+}
+
+func removeUserCerdential() error {
+	empty := new(userCredential)
+	cre, err := loadUserCerdential()
 	if err != nil {
-		return err
+		return saveUserCredential(empty)
 	}
 
-	flag := os.O_RDWR | os.O_CREATE | os.O_TRUNC
-	f, err := os.OpenFile(path+credentialFileName, flag, filePerm)
+	empty.ServerAddress = cre.ServerAddress
+	empty.OTPSecrets = cre.OTPSecrets
+	empty.Profiles = cre.Profiles
+	empty.LastProfile = cre.LastProfile
+	for i := range empty.Profiles {
+		empty.Profiles[i].Password = ""
+	}
+	return saveUserCredential(empty)
+}
+
+// saveOTPSecret stores the otpauth uri of server in credentials file,
+// an empty uri removes it. The cached password is left as it is.
+func saveOTPSecret(server, uri string) error {
+	cre, err := loadUserCerdential()
 	if err != nil {
+		cre = new(userCredential)
+	}
+	if err := cre.setOTPSecret(server, uri); err != nil {
 		return err
 	}
-	defer f.Close()
-	err = json.NewEncoder(f).Encode(user)
+	return saveUserCredential(cre)
+}
+
+// otpSecret returns the otpauth uri saved for server.
+func (c *userCredential) otpSecret(server string) (uri string, ok bool, err error) {
+	protected, ok := c.OTPSecrets[server]
+	if !ok {
+		return "", false, nil
+	}
+	data, err := dpapiUnprotect(protected, "totp token")
 	if err != nil {
-		return
+		return "", true, fmt.Errorf("can not read totp token of %s: %v", server, err)
 	}
+	return string(data), true, nil
+}
 
-	return f.Sync()
+// setOTPSecret protects uri and keeps it for server, an empty uri
+// removes the token of server.
+func (c *userCredential) setOTPSecret(server, uri string) error {
+	if len(uri) == 0 {
+		delete(c.OTPSecrets, server)
+		return nil
+	}
+	protected, err := dpapiProtect([]byte(uri))
+	if err != nil {
+		return fmt.Errorf("can not save totp token: %v", err)
+	}
+	if c.OTPSecrets == nil {
+		c.OTPSecrets = make(map[string][]byte)
+	}
+	c.OTPSecrets[server] = protected
+	return nil
 }
 
-func removeUserCerdential() error {
-	empty := new(userCredential)
-	cre, err := loadUserCerdential()
+// saveClientCert stores cert for server, the pem encoded chain and key
+// are protected with DPAPI so the file is useless on other machines.
+func saveClientCert(server string, cert *tls.Certificate) (name string, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error: saving client certificate: %v", err)
+		}
+	}()
+
+	path, err := mkdirLocalAppConfig(localAppDirByCmd)
 	if err != nil {
-		return saveUserCredential(empty)
+		return "", err
+	}
+	if err = os.MkdirAll(path+clientCertDir, filePerm); err != nil {
+		return "", err
 	}
 
-	empty.ServerAddress = cre.ServerAddress
-	return saveUserCredential(empty)
+	data, err := tlsconf.EncodePEM(cert)
+	if err != nil {
+		return "", err
+	}
+	if data, err = dpapiProtect(data); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(server))
+	name = hex.EncodeToString(sum[:8]) + ".cert"
+	return name, os.WriteFile(path+clientCertDir+name, data, filePerm)
+}
+
+func loadClientCert(name string) (cert *tls.Certificate, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error: loading client certificate: %v", err)
+		}
+	}()
+
+	path, err := mkdirLocalAppConfig(localAppDirByCmd)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path + clientCertDir + filepath.Base(name))
+	if err != nil {
+		return nil, err
+	}
+	if data, err = dpapiUnprotect(data, "certificate file"); err != nil {
+		return nil, err
+	}
+	return tlsconf.DecodePEM(data)
+}
+
+func removeClientCert(name string) error {
+	path, err := mkdirLocalAppConfig(localAppDirByCmd)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path + clientCertDir + filepath.Base(name))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error: removing client certificate: %v", err)
+	}
+	return nil
+}
+
+func dpapiProtect(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	out := windows.DataBlob{}
+	err := windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...), nil
+}
+
+// dpapiUnprotect returns the data protected by dpapiProtect, what names
+// the secret in the error when there is nothing to unprotect.
+func dpapiUnprotect(data []byte, what string) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty %s", what)
+	}
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	out := windows.DataBlob{}
+	err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...), nil
 }
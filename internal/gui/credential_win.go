@@ -6,6 +6,7 @@ import (
 	"strings"
 	"sync"
 
+	"snixconnect/internal/backend"
 	"snixconnect/pkg/walk"
 
 	"github.com/lxn/win"
@@ -18,15 +19,17 @@ const (
 
 type winCredProperty struct {
 	c                *userCredential
+	answers          map[string]string
 	credentialDialog *walk.Dialog
 	credIsOpen       bool
 	mutex            sync.Mutex
 }
 
-type GroupSelect struct {
-	Name         string
-	FriendlyName string
-}
+type (
+	GroupSelect    = backend.GroupSelect
+	CredentialForm = backend.Form
+	FormField      = backend.FormField
+)
 
 type groupSelectModel struct {
 	walk.ListModelBase
@@ -38,12 +41,20 @@ func (m *groupSelectModel) Value(index int) interface{} {
 	return m.items[index].FriendlyName
 }
 
-func (g *winCredProperty) newCredentialDialog(rch chan int, glist []GroupSelect, banner string) {
+// formInput is a widget created for a form field, value
+// returns the answer to the field.
+type formInput struct {
+	name   string
+	widget walk.Widget
+	value  func() string
+}
+
+func (g *winCredProperty) newCredentialDialog(rch chan int, form *CredentialForm) {
 	g.closeDialog(walk.DlgCmdAbort)
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 	go func() {
-		err := g.showCredentialDialog(rch, glist, banner)
+		err := g.showCredentialDialog(rch, form)
 		if err == nil {
 			return
 		}
@@ -52,7 +63,7 @@ func (g *winCredProperty) newCredentialDialog(rch chan int, glist []GroupSelect,
 	}()
 }
 
-func (g *winCredProperty) showCredentialDialog(rch chan int, list []GroupSelect, banner string) (err error) {
+func (g *winCredProperty) showCredentialDialog(rch chan int, form *CredentialForm) (err error) {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
@@ -75,13 +86,16 @@ func (g *winCredProperty) showCredentialDialog(rch chan int, list []GroupSelect,
 	setIconForWidget(g.credentialDialog, appCredentialIconName,
 		g.credentialDialog.DPI(), iconSize32x32)
 
-	if err := preLoginBanner(g.credentialDialog, banner); err != nil {
+	if err := preLoginBanner(g.credentialDialog, form.Banner); err != nil {
 		return err
 	}
 
 	vbox := walk.NewVBoxLayout()
 	vbox.SetMargins(walk.Margins{HNear: 9, VNear: 9, VFar: 9, HFar: 9})
 	g.credentialDialog.SetTitle("Credentials")
+	if len(form.Title) > 0 {
+		g.credentialDialog.SetTitle(form.Title)
+	}
 	g.credentialDialog.SetLayout(vbox)
 
 	groupBox, err := walk.NewGroupBox(g.credentialDialog)
@@ -95,48 +109,30 @@ func (g *winCredProperty) showCredentialDialog(rch chan int, list []GroupSelect,
 	groupBox.SetLayout(vboxgr)
 	groupBox.SetTitle("Connection Credentials")
 
-	gSelect, err := g.setupGroupList(groupBox, list)
-	if err != nil {
-		return
-	}
-
-	lbUser, err := walk.NewLabel(groupBox)
-	if err != nil {
-		return
-	}
-
-	userLine, err := walk.NewLineEdit(groupBox)
-	if err != nil {
-		return
-	}
-
-	vSpace, err := walk.NewVSpacer(groupBox)
-	if err != nil {
-		return
-	}
-
-	lbPass, err := walk.NewLabel(groupBox)
-	if err != nil {
-		return
+	if len(form.Message) > 0 {
+		message, err := walk.NewTextLabel(groupBox)
+		if err != nil {
+			return err
+		}
+		message.SetText(form.Message)
+		message.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{Width: 250})
+		if err := formSpacer(groupBox); err != nil {
+			return err
+		}
 	}
 
-	passLine, err := walk.NewLineEdit(groupBox)
-	if err != nil {
-		return
+	inputs := make([]formInput, 0, len(form.Fields))
+	for _, field := range form.Fields {
+		in, err := newFormInput(groupBox, field)
+		if err != nil {
+			return err
+		}
+		if in.widget == nil {
+			continue
+		}
+		inputs = append(inputs, in)
 	}
 
-	lbUser.SetText("Username:")
-	lbPass.SetText("Password:")
-	vSpace.SetMinMaxSize(walk.Size{Height: 5}, walk.Size{})
-	userLine.SetText(g.c.Username)
-	passLine.SetText(g.c.Password)
-	passLine.SetPasswordMode(true)
-	passLine.SetMaxLength(passwordMaxLen)
-	userLine.SetMaxLength(usernameMaxLen)
-
-	userLine.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{})
-	passLine.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{})
-
 	buttonComposite, err := walk.NewComposite(g.credentialDialog)
 	if err != nil {
 		return
@@ -158,9 +154,10 @@ func (g *winCredProperty) showCredentialDialog(rch chan int, list []GroupSelect,
 	}
 
 	okHandler := func() {
-		g.c.Username = strings.TrimSpace(userLine.Text())
-		g.c.Password = strings.TrimSpace(passLine.Text())
-		g.c.Group = gSelect()
+		g.answers = make(map[string]string, len(inputs))
+		for _, in := range inputs {
+			g.answers[in.name] = in.value()
+		}
 		g.credentialDialog.Accept()
 	}
 
@@ -170,10 +167,21 @@ func (g *winCredProperty) showCredentialDialog(rch chan int, list []GroupSelect,
 	buttonCancel.Clicked().Attach(g.credentialDialog.Cancel)
 	buttonOK.SetFocus()
 	onButtonPressEnter(buttonCancel.KeyUp(), g.credentialDialog.Cancel)
-	onButtonPressEnter(userLine.KeyUp(), func() { passLine.SetFocus() })
-	onButtonPressEnter(passLine.KeyUp(), func() { buttonOK.SetFocus() })
 	onButtonPressEnter(buttonOK.KeyUp(), okHandler)
 
+	// enter on a line edit moves to the next input, the last one to OK
+	for i, in := range inputs {
+		line, ok := in.widget.(*walk.LineEdit)
+		if !ok {
+			continue
+		}
+		var next walk.Window = buttonOK
+		if i+1 < len(inputs) {
+			next = inputs[i+1].widget
+		}
+		onButtonPressEnter(line.KeyUp(), func() { next.SetFocus() })
+	}
+
 	g.credentialDialog.Synchronize(func() {
 		g.credIsOpen = true
 		winAdjustPos(g.credentialDialog, 1.8)
@@ -184,53 +192,99 @@ func (g *winCredProperty) showCredentialDialog(rch chan int, list []GroupSelect,
 	return
 }
 
-func (g *winCredProperty) setupGroupList(p walk.Container, list []GroupSelect) (func() string, error) {
-	model := &groupSelectModel{items: []GroupSelect{}}
-	selectIndex := 0
+func newFormInput(p walk.Container, field FormField) (formInput, error) {
+	in := formInput{name: field.Name}
+	label := field.Label
+	if len(label) == 0 {
+		label = field.Name
+	}
+	if !strings.HasSuffix(label, ":") && field.Type != backend.FieldCheckbox {
+		label += ":"
+	}
 
-	for _, v := range list {
-		if len(v.Name) == 0 {
-			continue
+	switch field.Type {
+	case backend.FieldText, backend.FieldPassword:
+		lb, err := walk.NewLabel(p)
+		if err != nil {
+			return in, err
+		}
+		line, err := walk.NewLineEdit(p)
+		if err != nil {
+			return in, err
 		}
-		if len(v.FriendlyName) == 0 {
-			v.FriendlyName = v.Name
+		lb.SetText(label)
+		line.SetText(field.Value)
+		line.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{})
+		line.SetMaxLength(usernameMaxLen)
+		if field.Type == backend.FieldPassword {
+			line.SetPasswordMode(true)
+			line.SetMaxLength(passwordMaxLen)
 		}
-		model.items = append(model.items, v)
-		if v.Name == g.c.Group {
-			selectIndex = len(model.items) - 1
+		in.widget = line
+		in.value = func() string { return strings.TrimSpace(line.Text()) }
+
+	case backend.FieldSelect:
+		model := &groupSelectModel{items: []GroupSelect{}}
+		selectIndex := 0
+		for _, v := range field.Options {
+			if len(v.Name) == 0 {
+				continue
+			}
+			if len(v.FriendlyName) == 0 {
+				v.FriendlyName = v.Name
+			}
+			model.items = append(model.items, v)
+			if v.Name == field.Value {
+				selectIndex = len(model.items) - 1
+			}
+		}
+		if len(model.items) < 1 {
+			return in, nil
 		}
-	}
 
-	if len(model.items) < 1 {
-		return func() (s string) { return }, nil
-	}
+		lb, err := walk.NewLabel(p)
+		if err != nil {
+			return in, err
+		}
+		box, err := walk.NewDropDownBox(p)
+		if err != nil {
+			return in, err
+		}
+		lb.SetText(label)
+		box.SetModel(model)
+		box.SetCurrentIndex(selectIndex)
+		in.widget = box
+		in.value = func() string { return model.items[box.CurrentIndex()].Name }
+
+	case backend.FieldCheckbox:
+		check, err := walk.NewCheckBox(p)
+		if err != nil {
+			return in, err
+		}
+		check.SetText(label)
+		check.SetChecked(field.Value == backend.CheckboxOn)
+		in.widget = check
+		in.value = func() string {
+			if check.Checked() {
+				return backend.CheckboxOn
+			}
+			return backend.CheckboxOff
+		}
 
-	lbGroup, err := walk.NewLabel(p)
-	if err != nil {
-		return nil, err
+	default:
+		return in, nil
 	}
 
-	lbGroup.SetText("Group:")
-
-	groups, err := walk.NewDropDownBox(p)
-	if err != nil {
-		return nil, err
-	}
+	return in, formSpacer(p)
+}
 
+func formSpacer(p walk.Container) error {
 	spacer, err := walk.NewVSpacer(p)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	spacer.SetMinMaxSize(walk.Size{Height: 5}, walk.Size{})
-
-	groups.SetModel(model)
-	f := func() string {
-		return model.items[groups.CurrentIndex()].Name
-	}
-
-	groups.SetCurrentIndex(selectIndex)
-	return f, nil
-
+	return nil
 }
 
 func preLoginBanner(p walk.Container, banner string) error {
@@ -2,13 +2,22 @@ package gui
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"runtime"
+	"snixconnect/internal/backend"
 	"snixconnect/internal/bsync"
 	"snixconnect/internal/logs"
+	"snixconnect/internal/otp"
+	"snixconnect/internal/policy"
+	"snixconnect/internal/proxy"
+	"snixconnect/internal/quota"
+	"snixconnect/internal/tlsconf"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -22,15 +31,22 @@ const globalAppMutex = "Global\\SnixConnectVPNClientGui"
 
 type ConnectHandler func(context.Context, string)
 type appGuiHandler struct {
-	mainProperty   *winMainProperty
-	logsProPerty   *winLogsProperty
-	optionProperty *winOptionProperty
-	credProperty   *winCredProperty
-	bannerProperty *winBannerProperty
-	aboutProperty  *winAboutProperty
-	handler        *connHandler
-	tundeviceGUID  *windows.GUID
-	closeWaitGroup sync.WaitGroup
+	mainProperty    *winMainProperty
+	logsProPerty    *winLogsProperty
+	optionProperty  *winOptionProperty
+	credProperty    *winCredProperty
+	bannerProperty  *winBannerProperty
+	trustProperty   *winTrustProperty
+	aboutProperty   *winAboutProperty
+	historyProperty *winHistoryProperty
+	handler         *connHandler
+	tundeviceGUID   *windows.GUID
+	closeWaitGroup  sync.WaitGroup
+
+	// warnings raised before the tray icon is up wait in pendingWarnings
+	warningMutex    sync.Mutex
+	trayReady       bool
+	pendingWarnings [][2]string
 }
 
 type connHandler struct {
@@ -47,25 +63,36 @@ func NewGuiHandler(localAppDir string) *appGuiHandler {
 	}
 
 	localAppDirByCmd = localAppDir
-	app.optionProperty = new(winOptionProperty)
+	app.optionProperty = &winOptionProperty{policy: new(policy.Policy)}
 	app.credProperty = &winCredProperty{c: new(userCredential)}
 	app.logsProPerty.logModel = newAppLogViewModel()
 	lfnoop := func(s string) { app.logsProPerty.logModel.addLogToItems(s) }
 	app.logsProPerty.updateLogTable.Store(lfnoop)
 	app.logsProPerty.connStats = new(ConnectionStats)
 	app.logsProPerty.updateDetails.Store(func() {})
+	app.logsProPerty.updateThroughput.Store(func() {})
 	app.bannerProperty = new(winBannerProperty)
+	app.trustProperty = new(winTrustProperty)
 	app.aboutProperty = new(winAboutProperty)
+	app.historyProperty = new(winHistoryProperty)
+	app.logsProPerty.showHistory = app.historyProperty.newHistoryDialog
 	if app.handler.connectFunc == nil {
 		app.handler.connectFunc = func(context.Context, string) {}
 	}
 	app.mainProperty.tray = &appTrayNotify{windowsIsCore: winOSIsCore()}
 	logger = logs.NewLogger("[GUI]", app.GuiLogHandler())
+	fileDamaged = app.showFileDamaged
 	return app
 }
 
 func (g *appGuiHandler) SetConnectHandler(f ConnectHandler) { g.handler.connectFunc = f }
 
+// SetConfigHandler sets f to be called with the config once it is
+// loaded at startup and whenever the settings are saved.
+func (g *appGuiHandler) SetConfigHandler(f func(*UserAppConfig)) {
+	g.optionProperty.configChanged = f
+}
+
 func (g *appGuiHandler) alreadyRunning() error {
 	err := createWin32Mutex(globalAppMutex)
 	if errors.Is(err, windows.ERROR_ALREADY_EXISTS) {
@@ -108,6 +135,17 @@ func (g *appGuiHandler) renderMainWindow() error {
 		config = new(UserAppConfig)
 		config.CredentialCache = true
 	}
+	machinePolicy, err := policy.Load()
+	if err != nil {
+		logger.Print(err)
+	}
+	g.optionProperty.policy = machinePolicy
+	if !g.optionProperty.policy.IsZero() {
+		logger.Print("settings are managed by the machine policy")
+	}
+	if err := applyPolicy(g.optionProperty.policy, binder, config); err != nil {
+		logger.Print(err)
+	}
 
 	g.tundeviceGUID, err = getTunGuidValue()
 	if err != nil {
@@ -115,8 +153,36 @@ func (g *appGuiHandler) renderMainWindow() error {
 	}
 
 	g.optionProperty.currentConfig = config
+	allowPlainHTTP.Store(config.AllowPlainHTTP)
+	if g.optionProperty.configChanged != nil {
+		go g.optionProperty.configChanged(config.clone())
+	}
+	g.optionProperty.credential = binder
+	g.optionProperty.serverAddress = func() string {
+		urladdr, err := parseRawURL(g.mainProperty.serverText())
+		if err != nil {
+			return ""
+		}
+		return urladdr.String()
+	}
 	g.credProperty.c = binder
-	g.mainProperty.serverLineEdit.SetText(binder.ServerAddress)
+	g.mainProperty.profileAddress = binder.profileAddress
+	g.optionProperty.profileName = func() string {
+		if p := binder.profileOf(g.optionProperty.serverAddress()); p != nil {
+			return p.Name
+		}
+		return ""
+	}
+	g.optionProperty.profilesChanged = func(selected string) {
+		g.mainProperty.mainWindow.Synchronize(func() {
+			g.mainProperty.setProfiles(binder.profileNames(), selected)
+		})
+	}
+	if binder.selectProfile(binder.LastProfile) {
+		g.mainProperty.setProfiles(binder.profileNames(), binder.LastProfile)
+	} else {
+		g.mainProperty.setProfiles(binder.profileNames(), binder.ServerAddress)
+	}
 
 	// About button handler:
 	viewAboutHandler := func() { g.aboutProperty.newAboutDialog() }
@@ -128,6 +194,9 @@ func (g *appGuiHandler) renderMainWindow() error {
 	g.mainProperty.viewLogButton.Clicked().Attach(viewLogHandler)
 	onButtonPressEnter(g.mainProperty.viewLogButton.KeyUp(), viewLogHandler)
 
+	// History handler:
+	g.mainProperty.tray.attachHistoryAction(g.historyProperty.newHistoryDialog)
+
 	// Setting button handler:
 	optWinHandler := func() { g.optionProperty.newSettingDialog() }
 	g.mainProperty.settingsButton.Triggered().Attach(optWinHandler)
@@ -139,6 +208,7 @@ func (g *appGuiHandler) renderMainWindow() error {
 	g.SetConnStatus(NewStatusDisconnected(FlagDisconnected))
 
 	g.mainProperty.mainWindow.Closing().Attach(g.handleCloseToTry)
+	g.showPendingWarnings()
 	g.mainProperty.mainWindow.Run()
 	return nil
 }
@@ -170,13 +240,13 @@ func (g *appGuiHandler) runConnectFunc() {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
-	g.mainProperty.serverLineEdit.SetEnabled(false)
-	defer g.mainProperty.serverLineEdit.SetEnabled(true)
+	g.mainProperty.serverComboBox.SetEnabled(false)
+	defer g.mainProperty.serverComboBox.SetEnabled(true)
 	var ctx context.Context
 	ctx, g.handler.ctxCancelFunc = context.WithCancel(context.Background())
 	defer g.handler.ctxCancelFunc()
-	logger.Print("user has requested to connect to the vpn server")
-	addr := g.mainProperty.serverLineEdit.Text()
+	g.credProperty.c.selectProfile(g.mainProperty.serverComboBox.Text())
+	addr := g.mainProperty.serverText()
 	g.handler.connectFunc(ctx, addr)
 }
 
@@ -223,9 +293,41 @@ func (g *appGuiHandler) exeConnHandler() {
 	if !g.mainProperty.validateAddress() {
 		return
 	}
+	logger.Print("user has requested to connect to the vpn server")
 	g.handler.connHandler.Load().(walk.EventHandler)()
 }
 
+// AutoConnect connects to the server in main window as the connect
+// button does, unless a connection is running already.
+func (g *appGuiHandler) AutoConnect(reason string) {
+	g.mainProperty.mainWindow.Synchronize(func() {
+		if g.handler.handlerIsCancel {
+			return
+		}
+		addr, err := isvalidUrl(g.mainProperty.serverText())
+		if err != nil {
+			logger.Printf("%s, but there is no valid server address to connect to", reason)
+			return
+		}
+		if _, ok := g.mainProperty.profileAddress(g.mainProperty.serverComboBox.Text()); !ok {
+			g.mainProperty.serverComboBox.SetText(addr)
+		}
+		logger.Printf("%s, connecting to the vpn server", reason)
+		g.handler.connHandler.Load().(walk.EventHandler)()
+	})
+}
+
+// AutoDisconnect ends the running connection or reconnect attempts.
+func (g *appGuiHandler) AutoDisconnect(reason string) {
+	g.mainProperty.mainWindow.Synchronize(func() {
+		if !g.handler.handlerIsCancel {
+			return
+		}
+		logger.Printf("%s, disconnecting from the vpn server", reason)
+		g.runDisconnectFunc()
+	})
+}
+
 func (g *appGuiHandler) RenderWindow() error { return g.renderMainWindow() }
 
 func (g *appGuiHandler) GuiLogHandler() func(string)  { return g.logsProPerty.loggerFunc }
@@ -238,9 +340,251 @@ func (g *appGuiHandler) GetAppConfig() *UserAppConfig {
 	return &config
 }
 
-func (g *appGuiHandler) UserCerdential(groups []GroupSelect, banner string) (*UserCredential, bool) {
-	c := new(UserCredential)
-	urladdr, err := parseRawURL(g.mainProperty.serverLineEdit.Text())
+// ClientCertificate returns the imported client certificate of server or
+// nil, the user is warned when the certificate is about to expire.
+func (g *appGuiHandler) ClientCertificate(server string) (*tls.Certificate, error) {
+	urladdr, err := parseRawURL(server)
+	if err != nil {
+		return nil, nil
+	}
+	options, ok := g.GetAppConfig().Servers[urladdr.String()]
+	if !ok || len(options.ClientCert) == 0 {
+		return nil, nil
+	}
+
+	cert, err := loadClientCert(options.ClientCert)
+	if err != nil {
+		return nil, err
+	}
+
+	info := tlsconf.Info(cert)
+	var warning string
+	switch now := time.Now(); {
+	case info.Expired(now):
+		warning = fmt.Sprintf("client certificate %s has expired on %s",
+			info.Subject, info.NotAfter.Format(time.RFC1123))
+	case info.ExpiresSoon(now):
+		warning = fmt.Sprintf("client certificate %s expires on %s",
+			info.Subject, info.NotAfter.Format(time.RFC1123))
+	}
+	if len(warning) > 0 {
+		logger.Print(warning)
+		g.mainProperty.mainWindow.Synchronize(func() {
+			title := "SnixConnect Client Certificate"
+			g.mainProperty.tray.trayIcon.ShowWarning(title, warning)
+		})
+	}
+	return cert, nil
+}
+
+// ProxyConfig returns the proxy settings used to reach the gateway.
+func (g *appGuiHandler) ProxyConfig() (proxy.Config, error) {
+	return g.GetAppConfig().Proxy.Config()
+}
+
+// ServerOptions returns a copy of the options saved for server.
+func (g *appGuiHandler) ServerOptions(server string) ServerOptions {
+	urladdr, err := parseRawURL(server)
+	if err != nil {
+		return ServerOptions{}
+	}
+	config := g.GetAppConfig().clone()
+	if options, ok := config.Servers[urladdr.String()]; ok {
+		return *options
+	}
+	return ServerOptions{}
+}
+
+// DataUsage returns the saved traffic counters of the quotas.
+func (g *appGuiHandler) DataUsage() quota.Usage {
+	usage, err := loadDataUsage()
+	if err != nil {
+		logger.Print(err)
+		return make(quota.Usage)
+	}
+	return usage
+}
+
+func (g *appGuiHandler) SaveDataUsage(usage quota.Usage) {
+	if err := saveDataUsage(usage); err != nil {
+		logger.Print(err)
+	}
+}
+
+// ShowQuotaAlert tells the user about a quota threshold in a tray balloon.
+func (g *appGuiHandler) ShowQuotaAlert(alert quota.Alert) {
+	text := strings.ToUpper(alert.String()[:1]) + alert.String()[1:]
+	g.mainProperty.mainWindow.Synchronize(func() {
+		if alert.Exceeded() {
+			g.mainProperty.tray.trayIcon.ShowError("Data Quota Reached", text)
+			return
+		}
+		g.mainProperty.tray.trayIcon.ShowWarning("Data Quota Warning", text)
+	})
+}
+
+// showFileDamaged warns about a settings file left damaged, most likely
+// by the machine going down while it was written.
+func (g *appGuiHandler) showFileDamaged(name string, restored bool, err error) {
+	text := fmt.Sprintf("%s was damaged and has been restored from its last good copy", name)
+	if !restored {
+		text = fmt.Sprintf("%s was damaged and there is no good copy of it, defaults are used", name)
+	}
+	logger.Printf("%s: %v", text, err)
+	g.showWarning("Settings Recovered", text)
+}
+
+// showWarning shows a warning in a tray balloon, the files loaded before
+// the tray icon is created have their warnings queued until it is up.
+func (g *appGuiHandler) showWarning(title, text string) {
+	g.warningMutex.Lock()
+	defer g.warningMutex.Unlock()
+	if !g.trayReady {
+		g.pendingWarnings = append(g.pendingWarnings, [2]string{title, text})
+		return
+	}
+	g.mainProperty.mainWindow.Synchronize(func() {
+		g.mainProperty.tray.trayIcon.ShowWarning(title, text)
+	})
+}
+
+// showPendingWarnings shows the queued warnings once the tray icon is up,
+// in a single balloon since a new one replaces the one shown.
+func (g *appGuiHandler) showPendingWarnings() {
+	g.warningMutex.Lock()
+	defer g.warningMutex.Unlock()
+	g.trayReady = true
+	if len(g.pendingWarnings) == 0 {
+		return
+	}
+	texts := make([]string, len(g.pendingWarnings))
+	for i, w := range g.pendingWarnings {
+		texts[i] = w[1]
+	}
+	g.mainProperty.tray.trayIcon.ShowWarning(g.pendingWarnings[0][0], strings.Join(texts, "\n"))
+	g.pendingWarnings = nil
+}
+
+// TrustServerCertificate shows the chain of host which failed validation,
+// the pin chosen by the user is saved for the server in main window.
+func (g *appGuiHandler) TrustServerCertificate(host string, chain []*x509.Certificate,
+	reason error) (tlsconf.Pin, bool) {
+	logger.Printf("prompt untrusted certificate dialog for host %s", host)
+	dlgchan := make(chan int)
+	g.trustProperty.newTrustDialog(dlgchan, host, chain, reason)
+	switch <-dlgchan {
+	case walk.DlgCmdOK:
+	case walk.DlgCmdAbort:
+		logger.Print("certificate dialog terminated by another thread")
+		return tlsconf.Pin{}, false
+	default:
+		logger.Printf("user declined to trust the certificate of %s", host)
+		return tlsconf.Pin{}, false
+	}
+
+	pin := tlsconf.NewPin(host, g.trustProperty.pinType, chain[0])
+	logger.Printf("pinned %s of %s with sha256 fingerprint %s", pin.Type,
+		host, tlsconf.FormatFingerprint(pin.SHA256))
+
+	urladdr, err := parseRawURL(g.mainProperty.serverText())
+	if err != nil {
+		return pin, true
+	}
+	g.optionProperty.mutex.Lock()
+	defer g.optionProperty.mutex.Unlock()
+	config := g.optionProperty.currentConfig.clone()
+	options := config.Server(urladdr.String())
+	options.Pins = append(options.Pins, pin)
+	if err := saveUserAppConfig(config); err != nil {
+		logger.Print(err)
+		return pin, true
+	}
+	g.optionProperty.currentConfig = config
+	return pin, true
+}
+
+// ShowCertificateChanged warns the user that a pinned server
+// has presented a different certificate.
+func (g *appGuiHandler) ShowCertificateChanged(err error) {
+	g.mainProperty.mainWindow.Synchronize(func() {
+		walk.MsgBox(g.mainProperty.mainWindow, "SnixConnect Security Warning",
+			err.Error(), walk.MsgBoxIconWarning)
+	})
+}
+
+var otpFieldHints = []string{"otp", "token", "passcode", "one-time",
+	"one time", "verification", "2fa", "mfa", "authenticator"}
+
+// otpField returns the field of form which asks for a one-time password.
+func otpField(form *CredentialForm) *FormField {
+	for i := range form.Fields {
+		f := &form.Fields[i]
+		if f.Type != backend.FieldText && f.Type != backend.FieldPassword {
+			continue
+		}
+		name := strings.ToLower(f.Name + " " + f.Label)
+		for _, hint := range otpFieldHints {
+			if strings.Contains(name, hint) {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// loginFields returns the username, password and group fields of form,
+// plain is set when the form has nothing else but the otp field and can
+// be answered from the cached credential without asking the user.
+func loginFields(form *CredentialForm, otp *FormField) (user, pass, group *FormField, plain bool) {
+	others := 0
+	for i := range form.Fields {
+		f := &form.Fields[i]
+		switch {
+		case f == otp:
+		case f.Type == backend.FieldText && user == nil:
+			user = f
+		case f.Type == backend.FieldPassword && pass == nil:
+			pass = f
+		case f.Type == backend.FieldSelect && group == nil:
+			group = f
+		default:
+			others++
+		}
+	}
+	plain = user != nil && pass != nil && others == 0
+	return
+}
+
+// fillOTPField puts the current totp code of server in the otp field
+// of form, the filled field is returned.
+func (g *appGuiHandler) fillOTPField(form *CredentialForm, server string) *FormField {
+	uri, ok, err := g.credProperty.c.otpSecret(server)
+	if err != nil {
+		logger.Print(err)
+	}
+	if !ok || err != nil {
+		return nil
+	}
+	field := otpField(form)
+	if field == nil {
+		return nil
+	}
+	key, err := otp.ParseURI(uri)
+	if err != nil {
+		logger.Printf("saved totp token for %s is invalid: %v", server, err)
+		return nil
+	}
+	code, err := key.Code(time.Now())
+	if err != nil {
+		logger.Printf("error generating totp code: %v", err)
+		return nil
+	}
+	field.Value = code
+	return field
+}
+
+func (g *appGuiHandler) UserCerdential(form *CredentialForm) (map[string]string, bool) {
+	urladdr, err := parseRawURL(g.mainProperty.serverText())
 	if err != nil {
 		urladdr = new(url.URL)
 	}
@@ -249,23 +593,37 @@ func (g *appGuiHandler) UserCerdential(groups []GroupSelect, banner string) (*Us
 	cache = cache && len(urladdr.String()) > 0
 	cache = cache && len(g.credProperty.c.Username) != 0
 	cache = cache && len(g.credProperty.c.Password) != 0
-	groupExist := false
-	for _, v := range groups {
-		if v.Name == g.credProperty.c.Group && len(v.Name) != 0 {
-			groupExist = true
-			break
+
+	otpFilled := g.fillOTPField(form, urladdr.String())
+	if otpFilled != nil && len(form.Fields) == 1 {
+		logger.Printf("using saved totp token to answer %q", otpFilled.Label)
+		return map[string]string{otpFilled.Name: otpFilled.Value}, true
+	}
+
+	user, pass, group, plain := loginFields(form, otpFilled)
+	groupExist := group == nil
+	if group != nil {
+		for _, v := range group.Options {
+			if v.Name == g.credProperty.c.Group && len(v.Name) != 0 {
+				groupExist = true
+				break
+			}
 		}
 	}
-	groupExist = groupExist || len(groups) == 0
 
-	if g.credProperty.c.LastConnected && cache && groupExist {
-		c.Username = g.credProperty.c.Username
-		c.Password = g.credProperty.c.Password
-		if len(groups) != 0 {
-			c.Group = g.credProperty.c.Group
+	if g.credProperty.c.LastConnected && cache && groupExist && plain {
+		answers := map[string]string{
+			user.Name: g.credProperty.c.Username,
+			pass.Name: g.credProperty.c.Password,
+		}
+		if group != nil {
+			answers[group.Name] = g.credProperty.c.Group
+		}
+		if otpFilled != nil {
+			answers[otpFilled.Name] = otpFilled.Value
 		}
 		logger.Printf("using previously cached credentials for host %s", urladdr.Host)
-		return c, true
+		return answers, true
 	}
 
 	logger.Printf("prompt user credential dialog for host %s", urladdr.Host)
@@ -273,26 +631,40 @@ func (g *appGuiHandler) UserCerdential(groups []GroupSelect, banner string) (*Us
 		g.credProperty.c.UserCredential = UserCredential{}
 	}
 
+	login := user != nil && pass != nil
+	if login && len(g.credProperty.c.Username) > 0 {
+		user.Value = g.credProperty.c.Username
+		pass.Value = g.credProperty.c.Password
+	}
+	if login && group != nil && groupExist {
+		group.Value = g.credProperty.c.Group
+	}
+
 	dlgchan := make(chan int)
-	g.credProperty.newCredentialDialog(dlgchan, groups, banner)
+	g.credProperty.newCredentialDialog(dlgchan, form)
 	switch <-dlgchan {
 	case walk.DlgCmdOK:
 	case walk.DlgCmdAbort:
 		logger.Print("credential dialog terminated by another thread")
-		return c, false
+		return nil, false
 	default:
 		logger.Print("user declined to provide vpn connection credentials")
-		return c, false
+		return nil, false
 	}
 
-	c.Username = g.credProperty.c.Username
-	c.Password = g.credProperty.c.Password
-	c.Group = g.credProperty.c.Group
-	return c, true
+	answers := g.credProperty.answers
+	if login {
+		g.credProperty.c.Username = answers[user.Name]
+		g.credProperty.c.Password = answers[pass.Name]
+		if group != nil {
+			g.credProperty.c.Group = answers[group.Name]
+		}
+	}
+	return answers, true
 }
 
 func (g *appGuiHandler) ShowServerBanner(banner string) {
-	urladdr, err := parseRawURL(g.mainProperty.serverLineEdit.Text())
+	urladdr, err := parseRawURL(g.mainProperty.serverText())
 	if err != nil {
 		urladdr = new(url.URL)
 	}
@@ -67,6 +67,12 @@ var currentStatus statusIndicator
 var statusMutex sync.Mutex
 
 type statusConnecting struct{ statusFlag StatusFlag }
+type statusReconnectWait struct {
+	attempt, max int
+	next         time.Time
+	cancel       context.CancelFunc
+	finished     chan struct{}
+}
 type statusDisconnected struct{ statusFlag StatusFlag }
 type statusConnected struct {
 	connInfo *ConnectionStats
@@ -107,6 +113,39 @@ func NewStatusConnecting(flag StatusFlag) *statusConnecting {
 	return &statusConnecting{statusFlag: flag}
 }
 
+// NewStatusReconnectWait shows the countdown to attempt of max,
+// the attempt is made at next.
+func NewStatusReconnectWait(attempt, max int, next time.Time) *statusReconnectWait {
+	return &statusReconnectWait{attempt: attempt, max: max, next: next}
+}
+
+func (s *statusReconnectWait) text() string {
+	wait := time.Until(s.next).Round(time.Second)
+	if wait < 0 {
+		wait = 0
+	}
+	return fmt.Sprintf("attempt %d of %d, next try in %s", s.attempt, s.max, wait)
+}
+
+func (g *appGuiHandler) reconnectWaitRoutine(ctx context.Context, s *statusReconnectWait) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer close(s.finished)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.mainProperty.connStatusMsg.SetText("Reconnecting: " + s.text())
+			g.mainProperty.tray.trayIcon.SetToolTip(trayToolTipText(trayReconnecting + ": " + s.text()))
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func (g *appGuiHandler) connectedRoutine(ctx context.Context, done chan struct{}) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
@@ -126,12 +165,29 @@ func (g *appGuiHandler) connectedRoutine(ctx context.Context, done chan struct{}
 		info.ConnectedSince = time.Now()
 	}
 
+	var channel string
+	if info.DataChannel != nil {
+		channel = info.DataChannel()
+	}
+
+	meter := &g.logsProPerty.throughput
+	meter.reset(info.RX(), info.TX())
+
 	for {
 		select {
 		case <-ticker.C:
-			g.mainProperty.connRxTxLable[0].SetText(formatTransceive(info.RX()))
-			g.mainProperty.connRxTxLable[1].SetText(formatTransceive(info.TX()))
+			rx, tx := info.RX(), info.TX()
+			rxRate, txRate := meter.add(rx, tx)
+			g.mainProperty.connRxTxLable[0].SetText(formatTransceive(rx) + " (" + formatRate(rxRate) + ")")
+			g.mainProperty.connRxTxLable[1].SetText(formatTransceive(tx) + " (" + formatRate(txRate) + ")")
 			g.mainProperty.connRxTxLable[2].SetText(formatTimeText(info.ConnectedSince))
+			g.mainProperty.tray.trayIcon.SetToolTip(trayToolTipText(fmt.Sprintf("%s\nReceive: %s, Transmit: %s",
+				trayConnected, formatRate(rxRate), formatRate(txRate))))
+			g.logsProPerty.throughputUpdater()
+			if info.DataChannel != nil && info.DataChannel() != channel {
+				channel = info.DataChannel()
+				g.logsProPerty.detailsUpdater()
+			}
 
 		case <-ctx.Done():
 			return
@@ -155,8 +211,8 @@ func (s *statusConnected) applyStatus(g *appGuiHandler) {
 	g.showTrayNotifyMsg(FlagConnected)
 	g.drawTrayIconStatus(FlagConnected)
 
-	g.mainProperty.connRxTxLable[0].SetText("0B")
-	g.mainProperty.connRxTxLable[1].SetText("0B")
+	g.mainProperty.connRxTxLable[0].SetText("0B (0B/s)")
+	g.mainProperty.connRxTxLable[1].SetText("0B (0B/s)")
 	g.mainProperty.connRxTxLable[2].SetText("0s")
 	g.mainProperty.connRxTxLable[0].SetEnabled(true)
 	g.mainProperty.connRxTxLable[1].SetEnabled(true)
@@ -167,19 +223,20 @@ func (s *statusConnected) applyStatus(g *appGuiHandler) {
 	g.logsProPerty.detailsUpdater()
 	go g.connectedRoutine(ctx, s.finished)
 
-	urladdr, err := parseRawURL(g.mainProperty.serverLineEdit.Text())
+	urladdr, err := parseRawURL(g.mainProperty.serverText())
 	if err != nil {
 		urladdr = new(url.URL)
 	}
 	g.setButtonDisconnect()
 
-	lconn := urladdr.String() == g.credProperty.c.ServerAddress
 	cache := g.optionProperty.currentConfig.CredentialCache
-	if lconn && g.credProperty.c.LastConnected == cache {
-		return
-	}
+	profiles := len(g.credProperty.c.Profiles)
 	g.credProperty.c.LastConnected = cache
 	g.credProperty.c.ServerAddress = urladdr.String()
+	g.credProperty.c.storeProfile(cache)
+	if len(g.credProperty.c.Profiles) != profiles {
+		g.mainProperty.setProfiles(g.credProperty.c.profileNames(), g.credProperty.c.LastProfile)
+	}
 	err = saveUserCredential(g.credProperty.c)
 	if err != nil {
 		go winErrorBox(g.mainProperty.mainWindow, err)
@@ -209,6 +266,30 @@ func (s *statusConnecting) applyStatus(g *appGuiHandler) {
 	g.setButtonDisconnect()
 
 }
+func (s *statusReconnectWait) applyStatus(g *appGuiHandler) {
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	s.finished = make(chan struct{})
+	g.mainProperty.mainWindow.SetSuspended(true)
+	defer g.mainProperty.mainWindow.SetSuspended(false)
+
+	g.drawTrayIconStatus(FlagReconnecting)
+	g.mainProperty.tray.statusAction.SetText(trayReconnecting)
+	g.mainProperty.tray.trayIcon.SetToolTip(trayToolTipText(trayReconnecting + ": " + s.text()))
+	if s.attempt == 1 {
+		g.showTrayNotifyMsg(FlagReconnecting)
+	}
+
+	g.mainProperty.connStatusMsg.SetTextColor(colorDisconnect)
+	g.mainProperty.connStatusMsg.SetText("Reconnecting: " + s.text())
+	g.mainProperty.connRxTxLable[0].SetEnabled(false)
+	g.mainProperty.connRxTxLable[1].SetEnabled(false)
+	g.mainProperty.connRxTxLable[2].SetEnabled(false)
+	g.mainProperty.connStatusBox.SetVisible(true)
+	g.setButtonDisconnect()
+	go g.reconnectWaitRoutine(ctx, s)
+}
+
 func (s *statusDisconnected) applyStatus(g *appGuiHandler) {
 	g.mainProperty.mainWindow.SetSuspended(true)
 	defer g.mainProperty.mainWindow.SetSuspended(false)
@@ -261,6 +342,9 @@ func (s *statusDisconnected) applyStatus(g *appGuiHandler) {
 	}
 
 	g.credProperty.c.LastConnected = false
+	if p := g.credProperty.c.profileOf(g.credProperty.c.ServerAddress); p != nil {
+		p.LastConnected = false
+	}
 	err := saveUserCredential(g.credProperty.c)
 	if err != nil {
 		go winErrorBox(g.mainProperty.mainWindow, err)
@@ -277,6 +361,15 @@ func (s *statusConnected) restoreChanges(g *appGuiHandler) {
 
 }
 
+func (s *statusReconnectWait) restoreChanges(g *appGuiHandler) {
+	s.cancel()
+	<-s.finished
+
+	g.mainProperty.mainWindow.SetSuspended(true)
+	defer g.mainProperty.mainWindow.SetSuspended(false)
+	g.mainProperty.connStatusBox.SetVisible(false)
+}
+
 func (s *statusConnecting) restoreChanges(g *appGuiHandler) {
 	g.mainProperty.mainWindow.SetSuspended(true)
 	defer g.mainProperty.mainWindow.SetSuspended(false)
@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
@@ -191,12 +192,19 @@ func currentWinUser() string {
 
 }
 
+// allowPlainHTTP mirrors the AllowPlainHTTP setting, without it
+// parseRawURL refuses http:// server addresses.
+var allowPlainHTTP atomic.Bool
+
 func parseRawURL(rawurl string) (urltype *url.URL, err error) {
 	u, err := url.ParseRequestURI(rawurl)
 	if err == nil && len(u.Host) > 0 {
 		if u.Scheme != "https" && u.Scheme != "http" {
 			return u, fmt.Errorf("invalid server address %s", rawurl)
 		}
+		if u.Scheme == "http" && !allowPlainHTTP.Load() {
+			return u, fmt.Errorf("plain http server address %s is not allowed, it can be allowed in settings", rawurl)
+		}
 		return u, err
 	}
 
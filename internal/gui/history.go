@@ -0,0 +1,181 @@
+package gui
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sessionHistoryFile = "history.jsonl"
+
+var statusFlagNames = [...]string{
+	FlagConnected:    "connected",
+	FlagConnecting:   "connecting",
+	FlagReconnecting: "reconnecting",
+	FlagAuthFailed:   "auth-failed",
+	FlagRejected:     "rejected",
+	FlagConnFailed:   "connection-failed",
+	FlagDisconnected: "disconnected",
+}
+
+func (f StatusFlag) String() string {
+	if int(f) < len(statusFlagNames) {
+		return statusFlagNames[f]
+	}
+	return "unknown"
+}
+
+func (f StatusFlag) MarshalText() ([]byte, error) { return []byte(f.String()), nil }
+
+func (f *StatusFlag) UnmarshalText(text []byte) error {
+	for i, name := range statusFlagNames {
+		if name == string(text) {
+			*f = StatusFlag(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status %q", text)
+}
+
+// SessionRecord is one connection as written to the history file, from
+// the user connecting to the tunnel going down for good. RX and TX are
+// summed over the reconnects in between.
+type SessionRecord struct {
+	Server string     `json:"server"`
+	Group  string     `json:"group,omitempty"`
+	Start  time.Time  `json:"start"`
+	End    time.Time  `json:"end"`
+	RX     uint64     `json:"rx"`
+	TX     uint64     `json:"tx"`
+	Reason StatusFlag `json:"reason"`
+	Error  string     `json:"error,omitempty"`
+}
+
+func (r *SessionRecord) Duration() time.Duration { return r.End.Sub(r.Start) }
+
+func (r *SessionRecord) matches(filter string) bool {
+	filter = strings.ToLower(strings.TrimSpace(filter))
+	if len(filter) == 0 {
+		return true
+	}
+	for _, s := range []string{r.Server, r.Group, r.Reason.String(), r.Error} {
+		if strings.Contains(strings.ToLower(s), filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendSessionRecord adds r to the end of the history file, records
+// are never rewritten.
+func appendSessionRecord(r SessionRecord) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error: saving connection history: %v", err)
+		}
+	}()
+
+	path, err := mkdirLocalAppConfig(localAppDirByCmd)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	f, err := os.OpenFile(path+sessionHistoryFile, flag, filePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// loadSessionHistory reads the history file, newest session first. Lines
+// that do not decode, such as one cut short by a crash, are skipped.
+func loadSessionHistory() (records []SessionRecord, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error: loading connection history: %v", err)
+		}
+	}()
+
+	path, err := mkdirLocalAppConfig(localAppDirByCmd)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path + sessionHistoryFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var r SessionRecord
+		if json.Unmarshal(scanner.Bytes(), &r) == nil {
+			records = append(records, r)
+		}
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, scanner.Err()
+}
+
+func writeSessionsCSV(w io.Writer, records []SessionRecord) error {
+	cw := csv.NewWriter(w)
+	header := []string{"Server", "Group", "Start", "End", "Duration Seconds",
+		"Received Bytes", "Transmitted Bytes", "End Reason", "Error"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range records {
+		err := cw.Write([]string{
+			r.Server, r.Group,
+			r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339),
+			strconv.FormatInt(int64(r.Duration().Seconds()), 10),
+			strconv.FormatUint(r.RX, 10), strconv.FormatUint(r.TX, 10),
+			r.Reason.String(), r.Error,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func saveSessionsCSV(path string, records []SessionRecord) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error: exporting connection history: %v", err)
+		}
+	}()
+
+	flag := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	f, err := os.OpenFile(path, flag, filePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = writeSessionsCSV(f, records); err != nil {
+		return err
+	}
+	return f.Sync()
+}
@@ -0,0 +1,270 @@
+package gui
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"snixconnect/pkg/walk"
+
+	"github.com/lxn/win"
+)
+
+type winHistoryProperty struct {
+	historyDialog *walk.Dialog
+	historyIsOpen bool
+	mutex         sync.Mutex
+}
+
+type sessionHistoryModel struct {
+	walk.ReflectTableModelBase
+	records []SessionRecord
+	items   []sessionHistoryItem
+}
+
+type sessionHistoryItem struct {
+	Start    time.Time
+	Duration string
+	Server   string
+	Group    string
+	RX       string
+	TX       string
+	Reason   string
+	Error    string
+}
+
+func (m *sessionHistoryModel) Items() interface{} { return m.items }
+
+// setRecords shows the records matching filter, they are kept so the
+// export writes what is listed.
+func (m *sessionHistoryModel) setRecords(all []SessionRecord, filter string) {
+	m.records, m.items = m.records[:0], m.items[:0]
+	for _, r := range all {
+		if !r.matches(filter) {
+			continue
+		}
+		m.records = append(m.records, r)
+		m.items = append(m.items, sessionHistoryItem{
+			Start:    r.Start,
+			Duration: r.Duration().Round(time.Second).String(),
+			Server:   r.Server,
+			Group:    r.Group,
+			RX:       formatTransceive(r.RX),
+			TX:       formatTransceive(r.TX),
+			Reason:   r.Reason.String(),
+			Error:    r.Error,
+		})
+	}
+	m.PublishRowsReset()
+}
+
+func (m *sessionHistoryModel) StyleCell(style *walk.CellStyle) {
+	i := style.Row()
+	if len(m.records) <= i || i < 0 {
+		return
+	}
+	switch m.records[i].Reason {
+	case FlagAuthFailed, FlagRejected, FlagConnFailed:
+		style.TextColor = colorFailed
+	}
+}
+
+// RecordSession appends r to the connection history.
+func (g *appGuiHandler) RecordSession(r SessionRecord) {
+	if err := appendSessionRecord(r); err != nil {
+		logger.Print(err)
+	}
+}
+
+func (g *winHistoryProperty) newHistoryDialog() {
+	if g.historyIsOpen {
+		winAdjustPosCenter(g.historyDialog)
+		win.SetForegroundWindow(g.historyDialog.Handle())
+		return
+	}
+	go func() {
+		err := g.showHistoryDialog()
+		if err == nil {
+			return
+		}
+
+		err = fmt.Errorf("error running showHistoryDialog: %v", err)
+		go winErrorBox(nil, err)
+	}()
+}
+
+func (g *winHistoryProperty) showHistoryDialog() (err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	runtime.LockOSThread()
+	g.historyDialog, err = walk.NewDialogWithStyle(nil, win.WS_POPUPWINDOW, 0)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			g.historyDialog.Dispose()
+		}
+	}()
+
+	setIconForWidget(g.historyDialog, appViewLogIconName, g.historyDialog.DPI(), iconSize32x32)
+	setFontForWidget(g.historyDialog, appFontFamily, 9, 0)
+	vbox := walk.NewVBoxLayout()
+	vbox.SetMargins(walk.Margins{HNear: 9, VNear: 9, VFar: 9, HFar: 9})
+	g.historyDialog.SetTitle("SnixConnect Connection History")
+	g.historyDialog.SetLayout(vbox)
+
+	filterComposite, err := walk.NewComposite(g.historyDialog)
+	if err != nil {
+		return
+	}
+	filterComposite.SetDoubleBuffering(true)
+	filterComposite.SetLayout(layer2BoxLayout())
+	filterLabel, err := walk.NewLabel(filterComposite)
+	if err != nil {
+		return
+	}
+	filterLabel.SetText("Filter:")
+	if _, err = walk.NewHSpacer(filterComposite); err != nil {
+		return
+	}
+	filterEdit, err := walk.NewLineEdit(filterComposite)
+	if err != nil {
+		return
+	}
+	filterEdit.SetCueBanner("server, group, end reason or error")
+	filterEdit.SetMinMaxSize(walk.Size{Width: 400}, walk.Size{Width: 400})
+	countLabel, err := walk.NewLabel(filterComposite)
+	if err != nil {
+		return
+	}
+
+	records, loadErr := loadSessionHistory()
+	if loadErr != nil {
+		logger.Print(loadErr)
+	}
+	model := new(sessionHistoryModel)
+	table, err := newHistoryTable(g.historyDialog)
+	if err != nil {
+		return
+	}
+	table.SetModel(model)
+
+	applyFilter := func() {
+		model.setRecords(records, filterEdit.Text())
+		countLabel.SetText(fmt.Sprintf("   %d of %d sessions", len(model.records), len(records)))
+	}
+	applyFilter()
+	filterEdit.TextChanged().Attach(applyFilter)
+
+	buttonComposite, err := walk.NewComposite(g.historyDialog)
+	if err != nil {
+		return
+	}
+	buttonComposite.SetDoubleBuffering(true)
+	buttonLayout := walk.NewHBoxLayout()
+	buttonLayout.SetMargins(walk.Margins{})
+	buttonComposite.SetLayout(buttonLayout)
+	if _, err = walk.NewHSpacer(buttonComposite); err != nil {
+		return
+	}
+	buttonExport, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return
+	}
+	buttonClose, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return
+	}
+	buttonExport.SetText("Export CSV")
+	buttonClose.SetText("Close")
+
+	exportHandler := func() {
+		defer func() { g.historyDialog.SetFocus() }()
+		fileSelect := new(walk.FileDialog)
+		fileSelect.Title = "Export Connection History"
+		d := time.Now().Format("2006-01-02T150405")
+		fileSelect.FilePath = fmt.Sprintf("snixconnect-history-%s.csv", d)
+		fileSelect.Filter = "CSV Files (*.csv)|*.csv|All Files (*.*)|*.*"
+		accepted, err := fileSelect.ShowSave(g.historyDialog)
+		if err != nil {
+			logger.Print(err)
+			return
+		}
+		if !accepted {
+			return
+		}
+		if fileSelect.FilterIndex == 1 &&
+			!strings.HasSuffix(fileSelect.FilePath, ".csv") {
+			fileSelect.FilePath = fileSelect.FilePath + ".csv"
+		}
+		if err := saveSessionsCSV(fileSelect.FilePath, model.records); err != nil {
+			logger.Print(err)
+			winErrorBox(g.historyDialog, err)
+		}
+	}
+
+	buttonClose.Clicked().Attach(g.historyDialog.Cancel)
+	buttonExport.Clicked().Attach(exportHandler)
+	onButtonPressEnter(buttonExport.KeyUp(), exportHandler)
+	onButtonPressEnter(buttonClose.KeyUp(), g.historyDialog.Cancel)
+
+	g.historyDialog.Disposing().Attach(func() { g.historyIsOpen = false })
+	g.historyDialog.Synchronize(func() {
+		g.historyIsOpen = true
+		winAdjustPosCenter(g.historyDialog)
+	})
+	filterEdit.SetFocus()
+	g.historyDialog.Run()
+	return nil
+}
+
+func newHistoryTable(p walk.Form) (*walk.TableView, error) {
+	const (
+		tableWidth  = 865
+		tableHeight = 400
+	)
+
+	t_size := walk.Size{Width: tableWidth, Height: tableHeight}
+
+	table, err := walk.NewTableView(p)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range []struct {
+		title, member, format string
+		width                 int
+	}{
+		{"Started", "Start", "2006-01-02 15:04:05", 130},
+		{"Duration", "Duration", "", 80},
+		{"Server", "Server", "", 200},
+		{"Group", "Group", "", 80},
+		{"Received", "RX", "", 70},
+		{"Transmitted", "TX", "", 75},
+		{"End Reason", "Reason", "", 110},
+		{"Error", "Error", "", 0},
+	} {
+		column := walk.NewTableViewColumn()
+		column.SetTitle(c.title)
+		column.SetDataMember(c.member)
+		if len(c.format) > 0 {
+			column.SetFormat(c.format)
+		}
+		if c.width > 0 {
+			column.SetWidth(c.width)
+		}
+		table.Columns().Add(column)
+	}
+
+	table.SetAlternatingRowBG(true)
+	table.SetLastColumnStretched(true)
+	table.SetGridlines(true)
+	table.SetMinMaxSize(t_size, t_size)
+
+	return table, nil
+}
@@ -8,32 +8,30 @@ import (
 	"sync/atomic"
 	"time"
 
+	"snixconnect/internal/backend"
 	"snixconnect/pkg/walk"
 
 	"github.com/lxn/win"
 )
 
 type winLogsProperty struct {
-	updateDetails  atomic.Value
-	updateLogTable atomic.Value
-	logModel       *appLogViewModel
-	logDialog      *walk.Dialog
-	connStats      *ConnectionStats
-	logIsOpen      bool
-	mutex          sync.Mutex
+	updateDetails    atomic.Value
+	updateLogTable   atomic.Value
+	updateThroughput atomic.Value
+	logModel         *appLogViewModel
+	logDialog        *walk.Dialog
+	connStats        *ConnectionStats
+	throughput       throughputMeter
+	showHistory      func()
+	logIsOpen        bool
+	mutex            sync.Mutex
 }
 
 func (g *winLogsProperty) loggerFunc(s string) { g.updateLogTable.Load().(func(string))(s) }
 func (g *winLogsProperty) detailsUpdater()     { g.updateDetails.Load().(func())() }
+func (g *winLogsProperty) throughputUpdater()  { g.updateThroughput.Load().(func())() }
 
-type ConnectionStats struct {
-	ConnectedSince   time.Time
-	Gateway          string
-	MTU              uint16
-	DNS              []string
-	TunIPv4, Netmask string
-	RX, TX           func() uint64
-}
+type ConnectionStats = backend.ConnectionStats
 
 func layer1BoxLayout() walk.Layout {
 	layout := walk.NewVBoxLayout()
@@ -156,6 +154,22 @@ func (g *winLogsProperty) showLogsDialog() (err error) {
 	if err != nil {
 		return
 	}
+	copm15, err := walk.NewComposite(comp1)
+	if err != nil {
+		return
+	}
+	copm25, err := walk.NewComposite(comp2)
+	if err != nil {
+		return
+	}
+	copm16, err := walk.NewComposite(comp1)
+	if err != nil {
+		return
+	}
+	copm26, err := walk.NewComposite(comp2)
+	if err != nil {
+		return
+	}
 	copm11.SetLayout(layer2BoxLayout())
 	copm12.SetLayout(layer2BoxLayout())
 	copm13.SetLayout(layer2BoxLayout())
@@ -164,6 +178,10 @@ func (g *winLogsProperty) showLogsDialog() (err error) {
 	copm22.SetLayout(layer2BoxLayout())
 	copm24.SetLayout(layer2BoxLayout())
 	copm23.SetLayout(layer2BoxLayout())
+	copm15.SetLayout(layer2BoxLayout())
+	copm25.SetLayout(layer2BoxLayout())
+	copm16.SetLayout(layer2BoxLayout())
+	copm26.SetLayout(layer2BoxLayout())
 	copm11.SetDoubleBuffering(true)
 	copm12.SetDoubleBuffering(true)
 	copm13.SetDoubleBuffering(true)
@@ -172,6 +190,10 @@ func (g *winLogsProperty) showLogsDialog() (err error) {
 	copm22.SetDoubleBuffering(true)
 	copm24.SetDoubleBuffering(true)
 	copm23.SetDoubleBuffering(true)
+	copm15.SetDoubleBuffering(true)
+	copm25.SetDoubleBuffering(true)
+	copm16.SetDoubleBuffering(true)
+	copm26.SetDoubleBuffering(true)
 
 	lbIPv4, err := textLableValue(copm11, "IPv4 Address:")
 	if err != nil {
@@ -215,6 +237,89 @@ func (g *winLogsProperty) showLogsDialog() (err error) {
 		return
 	}
 
+	lbChannel, err := textLableValue(copm15, "Data Channel:")
+	if err != nil {
+		return
+	}
+
+	lbSince, err := textLableValue(copm25, "Connected Since:")
+	if err != nil {
+		return
+	}
+
+	lbIPv6, err := textLableValue(copm16, "IPv6 Address:")
+	if err != nil {
+		return
+	}
+
+	lbPrefixLen, err := textLableValue(copm26, "IPv6 Prefix Length:")
+	if err != nil {
+		return
+	}
+
+	routesBox, err := walk.NewGroupBox(g.logDialog)
+	if err != nil {
+		return
+	}
+	routesBox.SetDoubleBuffering(true)
+	routesBox.SetLayout(layer1BoxLayout())
+	routesBox.SetTitle("Routes And DNS")
+
+	compRoutes, err := walk.NewComposite(routesBox)
+	if err != nil {
+		return
+	}
+	compExcluded, err := walk.NewComposite(routesBox)
+	if err != nil {
+		return
+	}
+	compSplitDNS, err := walk.NewComposite(routesBox)
+	if err != nil {
+		return
+	}
+	compSuffixes, err := walk.NewComposite(routesBox)
+	if err != nil {
+		return
+	}
+	compIPv6Off, err := walk.NewComposite(routesBox)
+	if err != nil {
+		return
+	}
+	compRoutes.SetLayout(layer2BoxLayout())
+	compExcluded.SetLayout(layer2BoxLayout())
+	compSplitDNS.SetLayout(layer2BoxLayout())
+	compSuffixes.SetLayout(layer2BoxLayout())
+	compIPv6Off.SetLayout(layer2BoxLayout())
+	compRoutes.SetDoubleBuffering(true)
+	compExcluded.SetDoubleBuffering(true)
+	compSplitDNS.SetDoubleBuffering(true)
+	compSuffixes.SetDoubleBuffering(true)
+	compIPv6Off.SetDoubleBuffering(true)
+
+	lbRoutes, err := textLableValue(compRoutes, "Through Tunnel:")
+	if err != nil {
+		return
+	}
+	lbExcluded, err := textLableValue(compExcluded, "Outside Tunnel:")
+	if err != nil {
+		return
+	}
+	lbSplitDNS, err := textLableValue(compSplitDNS, "Tunnel DNS For:")
+	if err != nil {
+		return
+	}
+	lbSuffixes, err := textLableValue(compSuffixes, "DNS Suffixes:")
+	if err != nil {
+		return
+	}
+	lbIPv6Off, err := textLableValue(compIPv6Off, "IPv6 Disabled On:")
+	if err != nil {
+		return
+	}
+	for _, lb := range []*walk.TextLabel{lbRoutes, lbExcluded, lbSplitDNS, lbSuffixes, lbIPv6Off} {
+		lb.SetMinMaxSize(walk.Size{Width: 650}, walk.Size{Width: 650})
+	}
+
 	connStatHandler := func() {
 		g.logDialog.SetSuspended(true)
 		defer g.logDialog.SetSuspended(false)
@@ -222,6 +327,9 @@ func (g *winLogsProperty) showLogsDialog() (err error) {
 		fillConnectionStats(lbIPv4, g.connStats.TunIPv4)
 		fillConnectionStats(lbGateway, g.connStats.Gateway)
 		fillConnectionStats(lbNetmask, g.connStats.Netmask)
+		addr6, prefixLen, _ := strings.Cut(g.connStats.TunIPv6, "/")
+		fillConnectionStats(lbIPv6, addr6)
+		fillConnectionStats(lbPrefixLen, prefixLen)
 		switch {
 		case g.connStats.MTU > 0:
 			lbLinkMTU.SetText(fmt.Sprint(g.connStats.MTU))
@@ -231,6 +339,32 @@ func (g *winLogsProperty) showLogsDialog() (err error) {
 			lbLinkMTU.SetText("Not Available")
 		}
 
+		switch {
+		case g.connStats.DataChannel != nil:
+			fillConnectionStats(lbChannel, g.connStats.DataChannel())
+		default:
+			fillConnectionStats(lbChannel, "")
+		}
+		switch {
+		case g.connStats.ConnectedSince.IsZero():
+			fillConnectionStats(lbSince, "")
+		default:
+			fillConnectionStats(lbSince, g.connStats.ConnectedSince.Format(time.Stamp))
+		}
+
+		fillConnectionStats(lbRoutes, strings.Join(g.connStats.Routes, ", "))
+		fillConnectionStats(lbExcluded, strings.Join(g.connStats.ExcludedRoutes, ", "))
+		fillConnectionStats(lbSuffixes, strings.Join(g.connStats.DNSSuffixes, ", "))
+		fillConnectionStats(lbIPv6Off, strings.Join(g.connStats.IPv6DisabledOn, ", "))
+		switch {
+		case len(g.connStats.SplitDNS) > 0:
+			fillConnectionStats(lbSplitDNS, strings.Join(g.connStats.SplitDNS, ", "))
+		case len(g.connStats.DNS) > 0:
+			fillConnectionStats(lbSplitDNS, "All Names")
+		default:
+			fillConnectionStats(lbSplitDNS, "")
+		}
+
 		for i, dnsLable := range lbDNS {
 			if len(g.connStats.DNS) > i {
 				fillConnectionStats(dnsLable, g.connStats.DNS[i])
@@ -242,6 +376,55 @@ func (g *winLogsProperty) showLogsDialog() (err error) {
 	}
 
 	g.updateDetails.Store(connStatHandler)
+
+	throughputBox, err := walk.NewGroupBox(g.logDialog)
+	if err != nil {
+		return
+	}
+	throughputBox.SetDoubleBuffering(true)
+	throughputLayout := walk.NewVBoxLayout()
+	throughputLayout.SetMargins(walk.Margins{HNear: 15, HFar: 15, VNear: 6, VFar: 6})
+	throughputBox.SetLayout(throughputLayout)
+	throughputBox.SetTitle("Throughput (Last 5 Minutes)")
+
+	graph, err := newThroughputGraph(throughputBox, &g.throughput)
+	if err != nil {
+		return
+	}
+	compRates, err := walk.NewComposite(throughputBox)
+	if err != nil {
+		return
+	}
+	compRates.SetLayout(layer2BoxLayout())
+	compRates.SetDoubleBuffering(true)
+
+	var lbRates [4]*walk.TextLabel
+	for i, text := range []string{"Receive Peak:", "Receive Average:", "Transmit Peak:", "Transmit Average:"} {
+		if lbRates[i], err = textLableValue(compRates, text); err != nil {
+			return
+		}
+		if i%2 == 1 && i < len(lbRates)-1 {
+			if _, err = walk.NewHSpacer(compRates); err != nil {
+				return
+			}
+		}
+	}
+	lbRates[0].SetTextColor(graphColorRX)
+	lbRates[1].SetTextColor(graphColorRX)
+	lbRates[2].SetTextColor(graphColorTX)
+	lbRates[3].SetTextColor(graphColorTX)
+
+	throughputHandler := func() {
+		rx, tx := g.throughput.samples()
+		rxSummary, txSummary := summarizeRates(rx), summarizeRates(tx)
+		lbRates[0].SetText(formatRate(rxSummary.peak))
+		lbRates[1].SetText(formatRate(rxSummary.average))
+		lbRates[2].SetText(formatRate(txSummary.peak))
+		lbRates[3].SetText(formatRate(txSummary.average))
+		graph.Invalidate()
+	}
+	g.updateThroughput.Store(throughputHandler)
+
 	logTable, err := newLoggingTable(g.logDialog)
 	if err != nil {
 		return
@@ -279,6 +462,10 @@ func (g *winLogsProperty) showLogsDialog() (err error) {
 	if _, err = walk.NewHSpacer(buttonComposite); err != nil {
 		return
 	}
+	buttonHistory, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return
+	}
 	buttonSave, err := walk.NewPushButton(buttonComposite)
 	if err != nil {
 		return
@@ -289,8 +476,10 @@ func (g *winLogsProperty) showLogsDialog() (err error) {
 		return
 	}
 
+	buttonHistory.SetDoubleBuffering(true)
 	buttonSave.SetDoubleBuffering(true)
 	buttonClose.SetDoubleBuffering(true)
+	buttonHistory.SetText("History")
 	buttonSave.SetText("Export")
 	buttonClose.SetText("Close")
 
@@ -323,11 +512,14 @@ func (g *winLogsProperty) showLogsDialog() (err error) {
 
 	buttonClose.Clicked().Attach(g.logDialog.Cancel)
 	buttonSave.Clicked().Attach(saveToFileHandler)
+	buttonHistory.Clicked().Attach(g.showHistory)
+	onButtonPressEnter(buttonHistory.KeyUp(), g.showHistory)
 	onButtonPressEnter(buttonSave.KeyUp(), saveToFileHandler)
 	onButtonPressEnter(buttonClose.KeyUp(), g.logDialog.Cancel)
 
 	closingFunc := func() {
 		g.updateDetails.Store(func() {})
+		g.updateThroughput.Store(func() {})
 		flog := func(l string) { g.logModel.addLogToItems(l) }
 		g.updateLogTable.Store(flog)
 		g.logIsOpen = false
@@ -339,6 +531,7 @@ func (g *winLogsProperty) showLogsDialog() (err error) {
 	}
 
 	g.detailsUpdater()
+	g.throughputUpdater()
 	g.logDialog.Disposing().Attach(closingFunc)
 	g.logDialog.Synchronize(syncFunc)
 	buttonClose.SetFocus()
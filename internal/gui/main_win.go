@@ -3,6 +3,8 @@ package gui
 import (
 	"fmt"
 	"strings"
+	"syscall"
+	"unsafe"
 
 	"github.com/lxn/win"
 
@@ -11,15 +13,16 @@ import (
 )
 
 const (
-	mainWinWidth  = 468
-	mainWinHeight = 200
-	mainWinName   = "SnixConnect VPN Client"
+	mainWinWidth   = 468
+	mainWinHeight  = 200
+	mainWinName    = "SnixConnect VPN Client"
+	cbSetCueBanner = 0x1703
 )
 
 type winMainProperty struct {
 	tray           *appTrayNotify
 	mainWindow     *walk.MainWindow
-	serverLineEdit *walk.LineEdit
+	serverComboBox *walk.ComboBox
 	settingsButton *walk.Action
 	aboutButton    *walk.Action
 	toolbarHandler *walk.ToolBar
@@ -29,6 +32,9 @@ type winMainProperty struct {
 	connectButton  *walk.PushButton
 	connStatusMsg  *walk.Label
 	connRxTxLable  [3]*walk.Label
+
+	// profileAddress resolves a profile name to its server address.
+	profileAddress func(name string) (string, bool)
 }
 
 func (g *winMainProperty) hideWindow() {
@@ -74,17 +80,42 @@ func (g *winMainProperty) setAppGuiTweaks() {
 	setIconForWidget(g.settingsButton, appSettingIconName, toolBarDpi, iconSize64x64)
 	setIconForWidget(g.aboutButton, appAboutIconName, toolBarDpi, iconSize64x64)
 	setFontForWidget(g.mainWindow, appFontFamily, 9, 0)
-	setFontForWidget(g.serverLineEdit, appFontFamily, 10, 0)
+	setFontForWidget(g.serverComboBox, appFontFamily, 10, 0)
+	cueBanner, _ := syscall.UTF16PtrFromString("Profile or https://vpn-example.site[:443]/[usergroup]")
+	g.serverComboBox.SendMessage(cbSetCueBanner, 0, uintptr(unsafe.Pointer(cueBanner)))
 	setFontForWidget(g.connStatusMsg, appFontFamily, 10, 0)
 	g.connectButton.SetFocus()
 }
 
+// serverText returns the server address of the profile named in the
+// server box, or the address typed in it.
+func (g *winMainProperty) serverText() string {
+	text := strings.TrimSpace(g.serverComboBox.Text())
+	if addr, ok := g.profileAddress(text); ok {
+		return addr
+	}
+	return text
+}
+
+// setProfiles lists names in the server box and shows selected in it,
+// an empty selected keeps the text shown.
+func (g *winMainProperty) setProfiles(names []string, selected string) {
+	if len(selected) == 0 {
+		selected = g.serverComboBox.Text()
+	}
+	g.serverComboBox.SetModel(names)
+	g.serverComboBox.SetText(selected)
+}
+
 func (g *winMainProperty) validateAddress() bool {
-	addrText := strings.TrimSpace(g.serverLineEdit.Text())
-	g.serverLineEdit.SetText(addrText)
+	addrText := strings.TrimSpace(g.serverComboBox.Text())
+	if _, ok := g.profileAddress(addrText); ok {
+		return true
+	}
+	g.serverComboBox.SetText(addrText)
 	urlString, err := isvalidUrl(addrText)
 	if err == nil {
-		g.serverLineEdit.SetText(urlString)
+		g.serverComboBox.SetText(urlString)
 		return true
 	}
 
@@ -92,11 +123,22 @@ func (g *winMainProperty) validateAddress() bool {
 	err = fmt.Errorf("%v make sure you typed the address correctly", err)
 	winErrorBox(g.mainWindow, err)
 	g.showWindow()
-	g.serverLineEdit.SetTextSelection(0, -1)
-	g.serverLineEdit.SetFocus()
+	g.serverComboBox.SetTextSelection(0, -1)
+	g.serverComboBox.SetFocus()
 	return false
 }
 
+func (g *winMainProperty) serverTextChanged() {
+	t := strings.TrimSpace(g.serverComboBox.Text())
+	if g.serverComboBox.CurrentIndex() >= 0 || len(t) > 0 {
+		g.connectButton.SetEnabled(true)
+		g.tray.connectAction.SetEnabled(true)
+		return
+	}
+	g.connectButton.SetEnabled(false)
+	g.tray.connectAction.SetEnabled(false)
+}
+
 func (g *winMainProperty) newMainWindow() *declarative.MainWindow {
 	return &declarative.MainWindow{
 		AssignTo: &g.mainWindow,
@@ -118,22 +160,13 @@ func (g *winMainProperty) newMainWindow() *declarative.MainWindow {
 						DoubleBuffering: true,
 						Layout:          declarative.Grid{Columns: 2, Alignment: declarative.AlignHNearVCenter},
 						Children: []declarative.Widget{
-							declarative.LineEdit{
-								DoubleBuffering: true,
-								AssignTo:        &g.serverLineEdit,
-								CueBanner:       "https://vpn-example.site[:443]/[usergroup]",
-								MaxSize:         declarative.Size{Height: 23},
-								MaxLength:       2048,
-								OnTextChanged: func() {
-									t := strings.TrimSpace(g.serverLineEdit.Text())
-									if len(t) > 0 {
-										g.connectButton.SetEnabled(true)
-										g.tray.connectAction.SetEnabled(true)
-										return
-									}
-									g.connectButton.SetEnabled(false)
-									g.tray.connectAction.SetEnabled(false)
-								},
+							declarative.ComboBox{
+								DoubleBuffering:       true,
+								AssignTo:              &g.serverComboBox,
+								Editable:              true,
+								MaxLength:             2048,
+								OnTextChanged:         g.serverTextChanged,
+								OnCurrentIndexChanged: g.serverTextChanged,
 							},
 
 							declarative.PushButton{
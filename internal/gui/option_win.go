@@ -1,10 +1,26 @@
 package gui
 
 import (
+	"crypto/ed25519"
+	"crypto/tls"
 	"fmt"
+	"os"
 	"runtime"
+	"snixconnect/internal/backend"
+	"snixconnect/internal/bundle"
+	"snixconnect/internal/dnsconf"
+	"snixconnect/internal/killswitch"
+	"snixconnect/internal/otp"
+	"snixconnect/internal/policy"
+	"snixconnect/internal/proxy"
+	"snixconnect/internal/quota"
+	"snixconnect/internal/route"
+	"snixconnect/internal/tlsconf"
+	"snixconnect/internal/trustnet"
 	"snixconnect/pkg/walk"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/lxn/win"
 )
@@ -12,8 +28,21 @@ import (
 type winOptionProperty struct {
 	settingDialog *walk.Dialog
 	currentConfig *UserAppConfig
+	credential    *userCredential
+	serverAddress func() string
 	settingIsOpen bool
 	mutex         sync.Mutex
+
+	// profileName returns the profile of the server in main window,
+	// profilesChanged shows the profiles again with selected in main window.
+	profileName     func() string
+	profilesChanged func(selected string)
+
+	// configChanged is called with the config once loaded and saved.
+	configChanged func(*UserAppConfig)
+
+	// policy is the machine policy, it is never nil.
+	policy *policy.Policy
 }
 
 func (g *winOptionProperty) newSettingDialog() {
@@ -59,7 +88,22 @@ func (g *winOptionProperty) showSettingDialog() (err error) {
 	g.settingDialog.SetLayout(vbox)
 	setFontForWidget(g.settingDialog, appFontFamily, 9, 0)
 
-	groupBox, err := walk.NewGroupBox(g.settingDialog)
+	// the groups are split in pages by area, stacked they don't fit a screen
+	tabs, err := walk.NewTabWidget(g.settingDialog)
+	if err != nil {
+		return err
+	}
+	var pages []*walk.TabPage
+	for _, title := range []string{"General", "Security", "Network", "Connection", "Profiles"} {
+		page, err := newSettingPage(tabs, title)
+		if err != nil {
+			return err
+		}
+		pages = append(pages, page)
+	}
+	general, security, network, connection, profiles := pages[0], pages[1], pages[2], pages[3], pages[4]
+
+	groupBox, err := walk.NewGroupBox(general)
 	if err != nil {
 		return err
 	}
@@ -78,10 +122,98 @@ func (g *winOptionProperty) showSettingDialog() (err error) {
 	if err != nil {
 		return err
 	}
+	useDTLS, err := walk.NewCheckBox(groupBox)
+	if err != nil {
+		return err
+	}
+	forgetPins, err := walk.NewCheckBox(groupBox)
+	if err != nil {
+		return err
+	}
+	plainHTTP, err := walk.NewCheckBox(groupBox)
+	if err != nil {
+		return err
+	}
 	credentials.SetText("Cache Credentials")
 	credentials.SetToolTipText("Save credential to use in future connection attempts")
 	tlsSkipVerify.SetText("Allow Insecure TLS Connection")
 	tlsSkipVerify.SetToolTipText("Don't validate the server's certificate")
+	useDTLS.SetText("Use DTLS Data Channel")
+	useDTLS.SetToolTipText("Carry tunnel traffic over udp when the server supports it")
+	forgetPins.SetText("Forget Pinned Server Certificates")
+	forgetPins.SetToolTipText("Validate the server's certificate again on next connection")
+	plainHTTP.SetText("Allow Plain HTTP Server Address")
+	plainHTTP.SetToolTipText("Accept http:// server addresses without tls")
+	server := g.serverAddress()
+	var pins int
+	if options, ok := g.currentConfig.Servers[server]; ok && len(server) > 0 {
+		pins = len(options.Pins)
+	}
+	forgetPins.SetEnabled(pins > 0)
+	lockCheckBox(credentials, g.locked("CredentialCache"))
+	lockCheckBox(tlsSkipVerify, g.locked("SkipTLSVerify"))
+	lockCheckBox(useDTLS, g.locked("DisableDTLS"))
+	lockCheckBox(plainHTTP, g.locked("AllowPlainHTTP"))
+	lockCheckBox(forgetPins, g.serverLocked())
+	otpSave, err := g.setupOTPGroup(general)
+	if err != nil {
+		return err
+	}
+	certSave, err := g.setupCertGroup(general)
+	if err != nil {
+		return err
+	}
+	tlsSave, err := g.setupTLSGroup(security)
+	if err != nil {
+		return err
+	}
+	proxySave, err := g.setupProxyGroup(network)
+	if err != nil {
+		return err
+	}
+	killSwitchSave, err := g.setupKillSwitchGroup(security)
+	if err != nil {
+		return err
+	}
+	trustedSave, err := g.setupTrustedNetworkGroup(security)
+	if err != nil {
+		return err
+	}
+	routesSave, err := g.setupRoutesGroup(network)
+	if err != nil {
+		return err
+	}
+	dnsSave, err := g.setupDNSGroup(network)
+	if err != nil {
+		return err
+	}
+	dpdSave, err := g.setupDPDGroup(connection)
+	if err != nil {
+		return err
+	}
+	reconnectSave, err := g.setupReconnectGroup(connection)
+	if err != nil {
+		return err
+	}
+	quotaSave, err := g.setupQuotaGroup(connection)
+	if err != nil {
+		return err
+	}
+	profileSave, err := g.setupProfileGroup(profiles)
+	if err != nil {
+		return err
+	}
+	bundleSave, err := g.setupBundleGroup(profiles)
+	if err != nil {
+		return err
+	}
+
+	for _, page := range pages {
+		if _, err := walk.NewVSpacer(page); err != nil {
+			return err
+		}
+	}
+
 	buttonComposite, err := walk.NewComposite(g.settingDialog)
 	if err != nil {
 		return err
@@ -102,9 +234,48 @@ func (g *winOptionProperty) showSettingDialog() (err error) {
 	}
 
 	buttonSaveHandler := func() {
-		newconf := new(UserAppConfig)
+		newconf := g.currentConfig.clone()
+		for _, save := range []func(*UserAppConfig) error{tlsSave, proxySave, killSwitchSave,
+			trustedSave, routesSave, dnsSave, dpdSave, reconnectSave, quotaSave} {
+			if err := save(newconf); err != nil {
+				logger.Print(err)
+				winErrorBox(g.settingDialog, err)
+				return
+			}
+		}
+		// these groups write files, they are checked here and written
+		// once every group is valid
+		var writes []func() error
+		for _, check := range []func(*UserAppConfig) (func() error, error){otpSave, certSave,
+			profileSave, bundleSave} {
+			write, err := check(newconf)
+			if err != nil {
+				logger.Print(err)
+				winErrorBox(g.settingDialog, err)
+				return
+			}
+			if write != nil {
+				writes = append(writes, write)
+			}
+		}
 		newconf.CredentialCache = credentials.Checked()
 		newconf.SkipTLSVerify = tlsSkipVerify.Checked()
+		newconf.DisableDTLS = !useDTLS.Checked()
+		newconf.AllowPlainHTTP = plainHTTP.Checked()
+		if forgetPins.Checked() {
+			newconf.Server(server).Pins = nil
+			logger.Printf("removed pinned server certificates of %s", server)
+		}
+		for _, write := range writes {
+			if err := write(); err != nil {
+				logger.Print(err)
+				winErrorBox(g.settingDialog, err)
+				return
+			}
+		}
+		if err := applyPolicy(g.policy, g.credential, newconf); err != nil {
+			logger.Print(err)
+		}
 		if !newconf.CredentialCache {
 			if err := removeUserCerdential(); err != nil {
 				logger.Print(err)
@@ -119,6 +290,10 @@ func (g *winOptionProperty) showSettingDialog() (err error) {
 		}
 
 		g.currentConfig = newconf
+		allowPlainHTTP.Store(newconf.AllowPlainHTTP)
+		if g.configChanged != nil {
+			go g.configChanged(newconf.clone())
+		}
 		g.settingDialog.Accept()
 	}
 
@@ -130,6 +305,8 @@ func (g *winOptionProperty) showSettingDialog() (err error) {
 	onButtonPressEnter(buttonOK.KeyUp(), buttonSaveHandler)
 	credentials.SetChecked(g.currentConfig.CredentialCache)
 	tlsSkipVerify.SetChecked(g.currentConfig.SkipTLSVerify)
+	useDTLS.SetChecked(!g.currentConfig.DisableDTLS)
+	plainHTTP.SetChecked(g.currentConfig.AllowPlainHTTP)
 
 	g.settingDialog.Synchronize(func() {
 		g.settingIsOpen = true
@@ -139,3 +316,1402 @@ func (g *winOptionProperty) showSettingDialog() (err error) {
 	g.settingDialog.Run()
 	return nil
 }
+
+// newSettingPage adds a page titled title to tabs, the setting groups of
+// one area are stacked in it.
+func newSettingPage(tabs *walk.TabWidget, title string) (*walk.TabPage, error) {
+	page, err := walk.NewTabPage()
+	if err != nil {
+		return nil, err
+	}
+	if err := page.SetTitle(title); err != nil {
+		page.Dispose()
+		return nil, err
+	}
+	vbox := walk.NewVBoxLayout()
+	vbox.SetMargins(walk.Margins{HNear: 9, VNear: 9, VFar: 9, HFar: 9})
+	if err := page.SetLayout(vbox); err != nil {
+		page.Dispose()
+		return nil, err
+	}
+	if err := tabs.Pages().Add(page); err != nil {
+		page.Dispose()
+		return nil, err
+	}
+	return page, nil
+}
+
+// setupOTPGroup adds the totp token controls for the server in main window,
+// the returned function checks the token and returns the write enrolling
+// or removing it, run once every setting is valid.
+func (g *winOptionProperty) setupOTPGroup(parent walk.Container) (func(newconf *UserAppConfig) (func() error, error), error) {
+	server := g.serverAddress()
+
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("One-Time Password Token")
+
+	status, err := walk.NewTextLabel(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	uriLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	remove, err := walk.NewCheckBox(groupBox)
+	if err != nil {
+		return nil, err
+	}
+
+	status.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{Width: 250})
+	uriLine.SetCueBanner("otpauth://totp/... or base32 secret")
+	uriLine.SetToolTipText("Enrol the TOTP token given by your administrator")
+	remove.SetText("Remove Saved Token")
+
+	uri, saved, err := g.credential.otpSecret(server)
+	if err != nil {
+		logger.Print(err)
+	}
+	switch key, err := otp.ParseURI(uri); {
+	case len(server) == 0:
+		status.SetText("Enter a server address in main window to enrol a token")
+		uriLine.SetEnabled(false)
+	case saved && err == nil:
+		status.SetText(fmt.Sprintf("Token %s is saved for %s", key.Name(), server))
+	default:
+		status.SetText(fmt.Sprintf("No token is saved for %s", server))
+	}
+	remove.SetEnabled(saved)
+
+	return func(*UserAppConfig) (func() error, error) {
+		value := strings.TrimSpace(uriLine.Text())
+		if len(server) == 0 || (len(value) == 0 && !remove.Checked()) {
+			return nil, nil
+		}
+
+		var uri string
+		if len(value) > 0 {
+			key, err := otp.ParseKey(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid totp token: %v", err)
+			}
+			uri = key.URI()
+		}
+		return func() error {
+			if err := saveOTPSecret(server, uri); err != nil {
+				return err
+			}
+			if err := g.credential.setOTPSecret(server, uri); err != nil {
+				return err
+			}
+			if len(uri) == 0 {
+				logger.Printf("removed saved totp token for %s", server)
+				return nil
+			}
+			logger.Printf("enrolled totp token for %s", server)
+			return nil
+		}, nil
+	}, nil
+}
+
+// setupCertGroup adds the client certificate controls for the server in
+// main window, the returned function returns the write storing the
+// certificate and applying it to newconf.
+func (g *winOptionProperty) setupCertGroup(parent walk.Container) (func(newconf *UserAppConfig) (func() error, error), error) {
+	server := g.serverAddress()
+
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Client Certificate")
+	lockGroup(groupBox, g.serverLocked())
+
+	status, err := walk.NewTextLabel(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	passLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	buttonComposite, err := walk.NewComposite(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	buttonLayout := walk.NewHBoxLayout()
+	buttonLayout.SetMargins(walk.Margins{})
+	buttonComposite.SetLayout(buttonLayout)
+	buttonImport, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return nil, err
+	}
+	buttonRemove, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := walk.NewHSpacer(buttonComposite); err != nil {
+		return nil, err
+	}
+
+	status.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{Width: 250})
+	passLine.SetPasswordMode(true)
+	passLine.SetCueBanner("Passphrase of certificate file")
+	buttonImport.SetText("Import...")
+	buttonRemove.SetText("Remove")
+
+	var (
+		current  *tls.Certificate
+		imported *tls.Certificate
+		removed  bool
+	)
+
+	showInfo := func(cert *tls.Certificate) {
+		buttonRemove.SetEnabled(cert != nil)
+		if cert == nil {
+			status.SetText(fmt.Sprintf("No client certificate is used for %s", server))
+			return
+		}
+		info := tlsconf.Info(cert)
+		text := fmt.Sprintf("Subject: %s\nIssuer: %s\nExpires: %s", info.Subject,
+			info.Issuer, info.NotAfter.Local().Format("2006-01-02 15:04"))
+		switch now := time.Now(); {
+		case info.Expired(now):
+			text += " (expired)"
+		case info.ExpiresSoon(now):
+			text += " (expires soon)"
+		}
+		status.SetText(text)
+	}
+
+	if len(server) == 0 {
+		status.SetText("Enter a server address in main window to import a certificate")
+		passLine.SetEnabled(false)
+		buttonImport.SetEnabled(false)
+		buttonRemove.SetEnabled(false)
+	} else {
+		if options, ok := g.currentConfig.Servers[server]; ok && len(options.ClientCert) > 0 {
+			if current, err = loadClientCert(options.ClientCert); err != nil {
+				logger.Print(err)
+			}
+		}
+		showInfo(current)
+	}
+
+	buttonImport.Clicked().Attach(func() {
+		fileSelect := new(walk.FileDialog)
+		fileSelect.Title = "Import Client Certificate"
+		fileSelect.Filter = "PKCS#12 Files (*.p12;*.pfx)|*.p12;*.pfx|All Files (*.*)|*.*"
+		accepted, err := fileSelect.ShowOpen(g.settingDialog)
+		if err != nil || !accepted {
+			return
+		}
+		data, err := os.ReadFile(fileSelect.FilePath)
+		if err != nil {
+			winErrorBox(g.settingDialog, err)
+			return
+		}
+		cert, err := tlsconf.LoadPKCS12(data, passLine.Text())
+		if err != nil {
+			winErrorBox(g.settingDialog, err)
+			return
+		}
+		imported, removed = cert, false
+		showInfo(cert)
+	})
+
+	buttonRemove.Clicked().Attach(func() {
+		imported, removed = nil, true
+		showInfo(nil)
+	})
+
+	return func(newconf *UserAppConfig) (func() error, error) {
+		if len(server) == 0 || (imported == nil && !removed) {
+			return nil, nil
+		}
+		return func() error {
+			options := newconf.Server(server)
+			if len(options.ClientCert) > 0 {
+				if err := removeClientCert(options.ClientCert); err != nil {
+					return err
+				}
+				options.ClientCert = ""
+			}
+			if imported == nil {
+				logger.Printf("removed client certificate for %s", server)
+				return nil
+			}
+
+			name, err := saveClientCert(server, imported)
+			if err != nil {
+				return err
+			}
+			options.ClientCert = name
+			logger.Printf("imported client certificate %s for %s", tlsconf.Info(imported).Subject, server)
+			return nil
+		}, nil
+	}, nil
+}
+
+// setupTLSGroup adds the ca bundle and tls hardening controls for the server
+// in main window, the returned function applies the changes to newconf.
+func (g *winOptionProperty) setupTLSGroup(parent walk.Container) (func(newconf *UserAppConfig) error, error) {
+	server := g.serverAddress()
+
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Server TLS Options")
+	lockGroup(groupBox, g.serverLocked())
+
+	status, err := walk.NewTextLabel(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	buttonComposite, err := walk.NewComposite(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	buttonLayout := walk.NewHBoxLayout()
+	buttonLayout.SetMargins(walk.Margins{})
+	buttonComposite.SetLayout(buttonLayout)
+	buttonImport, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return nil, err
+	}
+	buttonRemove, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := walk.NewHSpacer(buttonComposite); err != nil {
+		return nil, err
+	}
+	versionLabel, err := walk.NewLabel(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	versionBox, err := walk.NewDropDownBox(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	ciphersLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	sniLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	revocation, err := walk.NewCheckBox(groupBox)
+	if err != nil {
+		return nil, err
+	}
+
+	status.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{Width: 250})
+	buttonImport.SetText("Import CA Bundle...")
+	buttonRemove.SetText("Remove")
+	versionLabel.SetText("Minimum TLS Version:")
+	versions := []string{"Default"}
+	for _, v := range tlsconf.Versions {
+		versions = append(versions, "TLS "+v)
+	}
+	versionBox.SetModel(versions)
+	versionBox.SetCurrentIndex(0)
+	ciphersLine.SetCueBanner("Allowed TLS 1.2 cipher suites, comma separated")
+	ciphersLine.SetToolTipText("e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	sniLine.SetCueBanner("Server name (SNI) override")
+	revocation.SetText("Check Certificate Revocation (OCSP/CRL)")
+	revocation.SetToolTipText("Refuse the server when the revocation status can't be checked")
+
+	var current tlsconf.Options
+	if options, ok := g.currentConfig.Servers[server]; ok {
+		current = options.TLS
+	}
+	bundle := current.CABundle
+
+	showBundle := func() {
+		buttonRemove.SetEnabled(len(bundle) > 0)
+		if len(bundle) == 0 {
+			status.SetText("No extra CA bundle, only system roots are trusted")
+			return
+		}
+		_, n, err := tlsconf.ParseCABundle(bundle)
+		if err != nil {
+			status.SetText(err.Error())
+			return
+		}
+		status.SetText(fmt.Sprintf("CA bundle with %d certificates is trusted", n))
+	}
+
+	if len(server) == 0 {
+		status.SetText("Enter a server address in main window to change TLS options")
+		for _, w := range []walk.Widget{buttonImport, buttonRemove, versionBox,
+			ciphersLine, sniLine, revocation} {
+			w.SetEnabled(false)
+		}
+	} else {
+		showBundle()
+		for i, v := range tlsconf.Versions {
+			if v == current.MinVersion {
+				versionBox.SetCurrentIndex(i + 1)
+			}
+		}
+		ciphersLine.SetText(strings.Join(current.CipherSuites, ", "))
+		sniLine.SetText(current.ServerName)
+		revocation.SetChecked(current.CheckRevocation)
+	}
+
+	buttonImport.Clicked().Attach(func() {
+		fileSelect := new(walk.FileDialog)
+		fileSelect.Title = "Import CA Bundle"
+		fileSelect.Filter = "PEM Files (*.pem;*.crt;*.cer)|*.pem;*.crt;*.cer|All Files (*.*)|*.*"
+		accepted, err := fileSelect.ShowOpen(g.settingDialog)
+		if err != nil || !accepted {
+			return
+		}
+		data, err := os.ReadFile(fileSelect.FilePath)
+		if err != nil {
+			winErrorBox(g.settingDialog, err)
+			return
+		}
+		if _, _, err := tlsconf.ParseCABundle(string(data)); err != nil {
+			winErrorBox(g.settingDialog, err)
+			return
+		}
+		bundle = string(data)
+		showBundle()
+	})
+
+	buttonRemove.Clicked().Attach(func() {
+		bundle = ""
+		showBundle()
+	})
+
+	return func(newconf *UserAppConfig) error {
+		if len(server) == 0 {
+			return nil
+		}
+		opts := tlsconf.Options{
+			CABundle:        bundle,
+			ServerName:      strings.TrimSpace(sniLine.Text()),
+			CheckRevocation: revocation.Checked(),
+		}
+		if i := versionBox.CurrentIndex(); i > 0 {
+			opts.MinVersion = tlsconf.Versions[i-1]
+		}
+		for _, name := range strings.Split(ciphersLine.Text(), ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				opts.CipherSuites = append(opts.CipherSuites, name)
+			}
+		}
+		if err := opts.Validate(); err != nil {
+			return err
+		}
+		if _, ok := newconf.Servers[server]; !ok && opts.IsZero() {
+			return nil
+		}
+		newconf.Server(server).TLS = opts
+		return nil
+	}, nil
+}
+
+// setupProxyGroup adds the proxy controls, the returned
+// function applies the changes to newconf.
+func (g *winOptionProperty) setupProxyGroup(parent walk.Container) (func(newconf *UserAppConfig) error, error) {
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Proxy")
+	lockGroup(groupBox, g.locked("Proxy"))
+
+	modeBox, err := walk.NewDropDownBox(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	addrLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	userLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	passLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+
+	current := g.currentConfig.Proxy
+	modes, selected := make([]string, len(proxy.Modes)), 0
+	for i, m := range proxy.Modes {
+		modes[i] = m.String()
+		if m == current.Mode {
+			selected = i
+		}
+	}
+	modeBox.SetModel(modes)
+	modeBox.SetCurrentIndex(selected)
+	modeBox.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{})
+	addrLine.SetText(current.Address)
+	userLine.SetText(current.Username)
+	userLine.SetCueBanner("Proxy username (optional)")
+	passLine.SetPasswordMode(true)
+	passLine.SetCueBanner("Proxy password")
+	if len(current.Password) > 0 {
+		passLine.SetCueBanner("Proxy password (saved)")
+	}
+
+	modeChanged := func() {
+		mode := proxy.Modes[modeBox.CurrentIndex()]
+		addrLine.SetEnabled(mode != proxy.ModeNone)
+		userLine.SetEnabled(mode != proxy.ModeNone)
+		passLine.SetEnabled(mode != proxy.ModeNone)
+		if mode == proxy.ModeSystem {
+			addrLine.SetCueBanner("PAC file URL (optional)")
+			addrLine.SetToolTipText("Evaluate this PAC file instead of the windows settings")
+			return
+		}
+		addrLine.SetCueBanner("Proxy address, host:port")
+		addrLine.SetToolTipText("")
+	}
+	modeBox.CurrentIndexChanged().Attach(modeChanged)
+	modeChanged()
+
+	return func(newconf *UserAppConfig) error {
+		options := ProxyOptions{
+			Mode:     proxy.Modes[modeBox.CurrentIndex()],
+			Address:  strings.TrimSpace(addrLine.Text()),
+			Username: strings.TrimSpace(userLine.Text()),
+		}
+		conf := proxy.Config{Mode: options.Mode, Address: options.Address}
+		if err := conf.Validate(); err != nil {
+			return err
+		}
+
+		switch password := passLine.Text(); {
+		case options.Mode == proxy.ModeNone:
+			options = ProxyOptions{}
+		case len(options.Username) == 0:
+		case len(password) > 0:
+			protected, err := dpapiProtect([]byte(password))
+			if err != nil {
+				return fmt.Errorf("can not save proxy password: %v", err)
+			}
+			options.Password = protected
+		default:
+			options.Password = current.Password
+		}
+		newconf.Proxy = options
+		return nil
+	}, nil
+}
+
+// setupReconnectGroup adds the reconnect policy controls, the returned
+// function applies the changes to newconf.
+func (g *winOptionProperty) setupReconnectGroup(parent walk.Container) (func(newconf *UserAppConfig) error, error) {
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Reconnect")
+	lockGroup(groupBox, g.locked("Reconnect"))
+
+	policy := g.currentConfig.ReconnectPolicy()
+	attemptsEdit, err := newNumberRow(groupBox, "Maximum Attempts:", 0, 0, 100,
+		float64(policy.MaxAttempts))
+	if err != nil {
+		return nil, err
+	}
+	delayEdit, err := newNumberRow(groupBox, "Initial Delay (seconds):", 0, 1, 300,
+		policy.InitialDelay.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	factorEdit, err := newNumberRow(groupBox, "Backoff Factor:", 1, 1, 10, policy.Factor)
+	if err != nil {
+		return nil, err
+	}
+	jitterEdit, err := newNumberRow(groupBox, "Jitter (%):", 0, 0, 100, policy.Jitter*100)
+	if err != nil {
+		return nil, err
+	}
+	authFailed, err := walk.NewCheckBox(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	attemptsEdit.SetToolTipText("Zero disables reconnecting")
+	authFailed.SetText("Retry After Authentication Failure")
+	authFailed.SetToolTipText("Reconnect even when the server refused the credentials")
+	authFailed.SetChecked(policy.RetryAuthFailed)
+
+	return func(newconf *UserAppConfig) error {
+		newconf.Reconnect = &ReconnectOptions{
+			MaxAttempts:         int(attemptsEdit.Value()),
+			InitialDelaySeconds: delayEdit.Value(),
+			BackoffFactor:       factorEdit.Value(),
+			JitterPercent:       jitterEdit.Value(),
+			RetryAuthFailed:     authFailed.Checked(),
+		}
+		return nil
+	}, nil
+}
+
+// setupDPDGroup adds the dead peer detection controls for the server in
+// main window, the returned function applies the changes to newconf.
+func (g *winOptionProperty) setupDPDGroup(parent walk.Container) (func(newconf *UserAppConfig) error, error) {
+	server := g.serverAddress()
+
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Dead Peer Detection")
+	lockGroup(groupBox, g.locked("Servers"))
+
+	var current DPDOptions
+	if options, ok := g.currentConfig.Servers[server]; ok {
+		current = options.DPD
+	}
+	intervalEdit, err := newNumberRow(groupBox, "DPD Interval (seconds):", 0, 0, 3600,
+		float64(current.IntervalSeconds))
+	if err != nil {
+		return nil, err
+	}
+	keepaliveEdit, err := newNumberRow(groupBox, "Keepalive (seconds):", 0, 0, 3600,
+		float64(current.KeepaliveSeconds))
+	if err != nil {
+		return nil, err
+	}
+	missedEdit, err := newNumberRow(groupBox, "Missed Probes Limit:", 0, 0, 20,
+		float64(current.MaxMissed))
+	if err != nil {
+		return nil, err
+	}
+	intervalEdit.SetToolTipText("Zero uses the interval pushed by the server")
+	keepaliveEdit.SetToolTipText("Zero uses the interval pushed by the server")
+	missedEdit.SetToolTipText("Reconnect after this many DPD intervals without response")
+	if len(server) == 0 {
+		groupBox.SetToolTipText("Enter a server address in main window to change DPD options")
+		intervalEdit.SetEnabled(false)
+		keepaliveEdit.SetEnabled(false)
+		missedEdit.SetEnabled(false)
+	}
+
+	return func(newconf *UserAppConfig) error {
+		if len(server) == 0 {
+			return nil
+		}
+		opts := DPDOptions{
+			IntervalSeconds:  int(intervalEdit.Value()),
+			KeepaliveSeconds: int(keepaliveEdit.Value()),
+			MaxMissed:        int(missedEdit.Value()),
+		}
+		if _, ok := newconf.Servers[server]; !ok && opts == (DPDOptions{}) {
+			return nil
+		}
+		newconf.Server(server).DPD = opts
+		return nil
+	}, nil
+}
+
+// setupKillSwitchGroup adds the kill switch controls, the returned
+// function applies the changes to newconf.
+func (g *winOptionProperty) setupKillSwitchGroup(parent walk.Container) (func(newconf *UserAppConfig) error, error) {
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Kill Switch")
+	lockGroup(groupBox, g.locked("KillSwitch"))
+
+	modeBox, err := walk.NewDropDownBox(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	modes, selected := make([]string, len(killswitch.Modes)), 0
+	for i, m := range killswitch.Modes {
+		modes[i] = m.String()
+		if m == g.currentConfig.KillSwitch {
+			selected = i
+		}
+	}
+	modeBox.SetModel(modes)
+	modeBox.SetCurrentIndex(selected)
+	modeBox.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{})
+	modeBox.SetToolTipText("Block traffic outside of the tunnel, always on keeps " +
+		"blocking when disconnected or after a crash")
+
+	return func(newconf *UserAppConfig) error {
+		newconf.KillSwitch = killswitch.Modes[modeBox.CurrentIndex()]
+		return nil
+	}, nil
+}
+
+// setupTrustedNetworkGroup adds the trusted network detection rules and
+// actions, the returned function applies the changes to newconf.
+func (g *winOptionProperty) setupTrustedNetworkGroup(parent walk.Container) (func(newconf *UserAppConfig) error, error) {
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Trusted Network Detection")
+	lockGroup(groupBox, g.locked("TrustedNetwork"))
+
+	current := g.currentConfig.TrustedNetwork
+	rulesText, err := walk.NewTextEditWithStyle(groupBox, win.WS_VSCROLL)
+	if err != nil {
+		return nil, err
+	}
+	rulesText.SetMinMaxSize(walk.Size{Width: 250, Height: 60}, walk.Size{Height: 60})
+	rulesText.SetText(trustnet.FormatRules(current.Rules))
+	rulesText.SetToolTipText("One rule per line, the first match wins, e.g.\r\n" +
+		"trusted dns-suffix corp.example.com\r\n" +
+		"trusted gateway-mac 00:11:22:33:44:55\r\n" +
+		"trusted probe https://intranet.example.com/\r\n" +
+		"untrusted ssid Hotel Guest")
+
+	actions := make([]string, len(trustnet.Actions))
+	trustedIndex, untrustedIndex := 0, 0
+	for i, a := range trustnet.Actions {
+		actions[i] = a.String()
+		if a == current.Trusted {
+			trustedIndex = i
+		}
+		if a == current.Untrusted {
+			untrustedIndex = i
+		}
+	}
+	trustedBox, err := newDropDownRow(groupBox, "On Trusted Network", actions, trustedIndex)
+	if err != nil {
+		return nil, err
+	}
+	untrustedBox, err := newDropDownRow(groupBox, "On Untrusted Network", actions, untrustedIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(newconf *UserAppConfig) error {
+		rules, err := trustnet.ParseRules(rulesText.Text())
+		if err != nil {
+			return err
+		}
+		newconf.TrustedNetwork = trustnet.Options{
+			Rules:     rules,
+			Trusted:   trustnet.Actions[trustedBox.CurrentIndex()],
+			Untrusted: trustnet.Actions[untrustedBox.CurrentIndex()],
+		}
+		return nil
+	}, nil
+}
+
+// setupRoutesGroup adds the split tunnel controls for the server in
+// main window, the returned function applies the changes to newconf.
+func (g *winOptionProperty) setupRoutesGroup(parent walk.Container) (func(newconf *UserAppConfig) error, error) {
+	server := g.serverAddress()
+
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Split Tunneling")
+	lockGroup(groupBox, g.serverLocked())
+
+	includeLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	excludeLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	localLAN, err := walk.NewCheckBox(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	disableIPv6, err := walk.NewCheckBox(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	includeLine.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{})
+	includeLine.SetCueBanner("Tunnel only these networks, e.g. 10.0.0.0/8")
+	includeLine.SetToolTipText("Added to the routes pushed by the server, empty sends all traffic " +
+		"through the tunnel unless the server splits it")
+	excludeLine.SetCueBanner("Keep these networks out of the tunnel")
+	excludeLine.SetToolTipText("Added to the excluded routes pushed by the server")
+	localLAN.SetText("Allow Local LAN Access")
+	localLAN.SetToolTipText("Reach the networks of the local adapters outside of the tunnel")
+	disableIPv6.SetText("Disable IPv6 On Physical Adapters")
+	disableIPv6.SetToolTipText("Unbind IPv6 from the local adapters while connected so IPv6 " +
+		"traffic can't leak outside of the tunnel")
+
+	var current route.Options
+	var ipv6Off bool
+	if options, ok := g.currentConfig.Servers[server]; ok {
+		current, ipv6Off = options.Routes, options.DisableIPv6
+	}
+	if len(server) == 0 {
+		groupBox.SetToolTipText("Enter a server address in main window to change split tunneling")
+		includeLine.SetEnabled(false)
+		excludeLine.SetEnabled(false)
+		localLAN.SetEnabled(false)
+		disableIPv6.SetEnabled(false)
+	} else {
+		includeLine.SetText(strings.Join(route.Strings(current.Include), ", "))
+		excludeLine.SetText(strings.Join(route.Strings(current.Exclude), ", "))
+		localLAN.SetChecked(current.LocalLAN)
+		disableIPv6.SetChecked(ipv6Off)
+	}
+
+	return func(newconf *UserAppConfig) error {
+		if len(server) == 0 {
+			return nil
+		}
+		include, err := route.ParsePrefixes(includeLine.Text())
+		if err != nil {
+			return err
+		}
+		exclude, err := route.ParsePrefixes(excludeLine.Text())
+		if err != nil {
+			return err
+		}
+		opts := route.Options{Include: include, Exclude: exclude, LocalLAN: localLAN.Checked()}
+		if _, ok := newconf.Servers[server]; !ok && opts.IsZero() && !disableIPv6.Checked() {
+			return nil
+		}
+		newconf.Server(server).Routes = opts
+		newconf.Server(server).DisableIPv6 = disableIPv6.Checked()
+		return nil
+	}, nil
+}
+
+// setupDNSGroup adds the split dns controls for the server in main
+// window, the returned function applies the changes to newconf.
+func (g *winOptionProperty) setupDNSGroup(parent walk.Container) (func(newconf *UserAppConfig) error, error) {
+	server := g.serverAddress()
+
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Split DNS")
+	lockGroup(groupBox, g.serverLocked())
+
+	domainsLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	suffixesLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	domainsLine.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{})
+	domainsLine.SetCueBanner("Resolve only these domains in tunnel, e.g. corp.example.com")
+	domainsLine.SetToolTipText("Added to the split DNS domains pushed by the server, empty sends " +
+		"every name to the tunnel nameservers unless the server splits them")
+	suffixesLine.SetCueBanner("DNS search suffixes")
+	suffixesLine.SetToolTipText("Added to the default domain pushed by the server")
+
+	var current dnsconf.Options
+	if options, ok := g.currentConfig.Servers[server]; ok {
+		current = options.DNS
+	}
+	if len(server) == 0 {
+		groupBox.SetToolTipText("Enter a server address in main window to change split DNS")
+		domainsLine.SetEnabled(false)
+		suffixesLine.SetEnabled(false)
+	} else {
+		domainsLine.SetText(strings.Join(current.Domains, ", "))
+		suffixesLine.SetText(strings.Join(current.Suffixes, ", "))
+	}
+
+	return func(newconf *UserAppConfig) error {
+		if len(server) == 0 {
+			return nil
+		}
+		domains, err := dnsconf.ParseDomains(domainsLine.Text())
+		if err != nil {
+			return err
+		}
+		suffixes, err := dnsconf.ParseDomains(suffixesLine.Text())
+		if err != nil {
+			return err
+		}
+		opts := dnsconf.Options{Domains: domains, Suffixes: suffixes}
+		if _, ok := newconf.Servers[server]; !ok && opts.IsZero() {
+			return nil
+		}
+		newconf.Server(server).DNS = opts
+		return nil
+	}, nil
+}
+
+// setupQuotaGroup adds the data quota controls of all servers and of the
+// server in main window, the returned function applies the changes to newconf.
+func (g *winOptionProperty) setupQuotaGroup(parent walk.Container) (func(newconf *UserAppConfig) error, error) {
+	const megabyte = 1 << 20
+	server := g.serverAddress()
+
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Data Quota")
+	lockGroup(groupBox, g.locked("Quota", "Servers"))
+
+	scopes, keys := []string{"All Servers"}, []string{quota.Global}
+	limits := []quota.Limits{g.currentConfig.Quota}
+	if len(server) > 0 {
+		var current quota.Limits
+		if options, ok := g.currentConfig.Servers[server]; ok {
+			current = options.Quota
+		}
+		scopes, keys = append(scopes, "This Server"), append(keys, server)
+		limits = append(limits, current)
+	}
+	scopeBox, err := newDropDownRow(groupBox, "Applies To", scopes, 0)
+	if err != nil {
+		return nil, err
+	}
+	dailyEdit, err := newNumberRow(groupBox, "Daily Limit (MB):", 0, 0, 1e7, 0)
+	if err != nil {
+		return nil, err
+	}
+	monthlyEdit, err := newNumberRow(groupBox, "Monthly Limit (MB):", 0, 0, 1e8, 0)
+	if err != nil {
+		return nil, err
+	}
+	thresholdsLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	disconnect, err := walk.NewCheckBox(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	usageLabel, err := walk.NewLabel(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	if len(server) == 0 {
+		scopeBox.SetToolTipText("Enter a server address in main window to set a quota of its own")
+	}
+	dailyEdit.SetToolTipText("Received and transmitted traffic, zero is no limit")
+	monthlyEdit.SetToolTipText("Received and transmitted traffic, zero is no limit")
+	thresholdsLine.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{})
+	thresholdsLine.SetCueBanner("Warn at percents of a limit, e.g. " +
+		quota.FormatThresholds(quota.DefaultThresholds))
+	disconnect.SetText("Disconnect When A Limit Is Reached")
+	disconnect.SetToolTipText("Refuse to connect until the day or month is over")
+
+	usage, err := loadDataUsage()
+	if err != nil {
+		logger.Print(err)
+		usage = make(quota.Usage)
+	}
+	show := func(i int) {
+		l := limits[i]
+		dailyEdit.SetValue(float64(l.Daily / megabyte))
+		monthlyEdit.SetValue(float64(l.Monthly / megabyte))
+		thresholdsLine.SetText(quota.FormatThresholds(l.Thresholds))
+		disconnect.SetChecked(l.Disconnect)
+		now, counter := time.Now(), usage.Counter(keys[i])
+		usageLabel.SetText(fmt.Sprintf("Used today %s, this month %s",
+			quota.FormatBytes(counter.Used(now, quota.Day)),
+			quota.FormatBytes(counter.Used(now, quota.Month))))
+	}
+	read := func(i int) error {
+		thresholds, err := quota.ParseThresholds(thresholdsLine.Text())
+		if err != nil {
+			return err
+		}
+		limits[i] = quota.Limits{
+			Daily:      uint64(dailyEdit.Value()) * megabyte,
+			Monthly:    uint64(monthlyEdit.Value()) * megabyte,
+			Thresholds: thresholds,
+			Disconnect: disconnect.Checked(),
+		}
+		return nil
+	}
+	selected := 0
+	show(selected)
+	scopeBox.CurrentIndexChanged().Attach(func() {
+		if scopeBox.CurrentIndex() == selected {
+			return
+		}
+		if err := read(selected); err != nil {
+			scopeBox.SetCurrentIndex(selected)
+			winErrorBox(g.settingDialog, err)
+			return
+		}
+		selected = scopeBox.CurrentIndex()
+		show(selected)
+	})
+
+	return func(newconf *UserAppConfig) error {
+		if err := read(selected); err != nil {
+			return err
+		}
+		newconf.Quota = limits[0]
+		if len(server) == 0 {
+			return nil
+		}
+		if _, ok := newconf.Servers[server]; !ok && limits[1].IsZero() {
+			return nil
+		}
+		newconf.Server(server).Quota = limits[1]
+		return nil
+	}, nil
+}
+
+// setupProfileGroup adds the profile controls of the server in main
+// window, the returned function applies the backend to newconf and
+// returns the write saving the profile.
+func (g *winOptionProperty) setupProfileGroup(parent walk.Container) (func(newconf *UserAppConfig) (func() error, error), error) {
+	server := g.serverAddress()
+	name := g.profileName()
+
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Server Profile")
+	lockGroup(groupBox, g.serverLocked())
+
+	nameLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	backends, selected := append([]string{"Default"}, backend.Names()...), 0
+	var current string
+	if options, ok := g.currentConfig.Servers[server]; ok {
+		current = options.Backend
+	}
+	for i, b := range backends[1:] {
+		if b == current {
+			selected = i + 1
+		}
+	}
+	backendBox, err := newDropDownRow(groupBox, "VPN Backend", backends, selected)
+	if err != nil {
+		return nil, err
+	}
+	remove, err := walk.NewCheckBox(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	nameLine.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{})
+	nameLine.SetCueBanner("Name to list the server by in main window")
+	nameLine.SetText(name)
+	nameLine.SetToolTipText("The credential, backend and TLS options are kept for each profile")
+	remove.SetText("Remove This Profile")
+	remove.SetToolTipText("Forget the profile and its cached credential")
+	remove.SetEnabled(len(name) > 0)
+	if len(server) == 0 {
+		groupBox.SetToolTipText("Enter a server address in main window to save it as a profile")
+		nameLine.SetEnabled(false)
+		backendBox.SetEnabled(false)
+	}
+
+	return func(newconf *UserAppConfig) (func() error, error) {
+		if len(server) == 0 {
+			return nil, nil
+		}
+		var opts string
+		if i := backendBox.CurrentIndex(); i > 0 {
+			opts = backends[i]
+		}
+		if _, ok := newconf.Servers[server]; ok || len(opts) > 0 {
+			newconf.Server(server).Backend = opts
+		}
+
+		c, newName := g.credential, strings.TrimSpace(nameLine.Text())
+		var change func() error
+		switch {
+		case remove.Checked():
+			change = func() error {
+				c.removeProfile(name)
+				newName = server
+				logger.Printf("removed profile %s of %s", name, server)
+				return nil
+			}
+		case len(name) > 0:
+			if err := c.checkRename(name, newName); err != nil {
+				return nil, err
+			}
+			change = func() error { return c.renameProfile(name, newName) }
+		case len(newName) > 0:
+			if c.profile(newName) != nil {
+				return nil, fmt.Errorf("a profile named %q exists already", newName)
+			}
+			change = func() error {
+				p := c.newProfile(newName, server)
+				if c.ServerAddress == server {
+					p.UserCredential, p.LastConnected = c.UserCredential, c.LastConnected
+				}
+				return nil
+			}
+		default:
+			return nil, nil
+		}
+		return func() error {
+			if err := change(); err != nil {
+				return err
+			}
+			if err := saveUserCredential(c); err != nil {
+				return err
+			}
+			g.profilesChanged(newName)
+			return nil
+		}, nil
+	}, nil
+}
+
+// setupBundleGroup adds the profile bundle import and export controls,
+// the returned function checks the imported profiles and returns the
+// write saving them to newconf.
+func (g *winOptionProperty) setupBundleGroup(parent walk.Container) (func(newconf *UserAppConfig) (func() error, error), error) {
+	groupBox, err := walk.NewGroupBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	vboxgr.SetSpacing(2)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Profile Bundle")
+
+	status, err := walk.NewTextLabel(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	passLine, err := walk.NewLineEdit(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	buttonComposite, err := walk.NewComposite(groupBox)
+	if err != nil {
+		return nil, err
+	}
+	buttonLayout := walk.NewHBoxLayout()
+	buttonLayout.SetMargins(walk.Margins{})
+	buttonComposite.SetLayout(buttonLayout)
+	buttonImport, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return nil, err
+	}
+	buttonExport, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return nil, err
+	}
+	buttonKey, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := walk.NewHSpacer(buttonComposite); err != nil {
+		return nil, err
+	}
+
+	status.SetMinMaxSize(walk.Size{Width: 250}, walk.Size{Width: 250})
+	passLine.SetPasswordMode(true)
+	passLine.SetCueBanner("Passphrase of bundle file, empty for none")
+	buttonImport.SetText("Import...")
+	buttonExport.SetText("Export...")
+	buttonExport.SetToolTipText("Save the profiles with their saved options, passwords are left out")
+	buttonKey.SetText("Signing Key...")
+	buttonKey.SetToolTipText("Sign the exported bundle with an Ed25519 private key (PEM)")
+
+	var (
+		imported []bundle.Profile
+		signer   string
+		key      ed25519.PrivateKey
+	)
+
+	showStatus := func() {
+		switch {
+		case len(imported) > 0:
+			status.SetText(fmt.Sprintf("%d profiles are imported when the settings are saved", len(imported)))
+		case key != nil:
+			fp := bundle.KeyFingerprint(key.Public().(ed25519.PublicKey))
+			status.SetText("Exported bundles are signed with key\n" + tlsconf.FormatFingerprint(fp[:32]))
+		default:
+			status.SetText("Import profiles from a bundle file or export the saved ones")
+		}
+	}
+	showStatus()
+
+	fileFilter := "Profile Bundles (*.snixbundle)|*.snixbundle|All Files (*.*)|*.*"
+	buttonImport.Clicked().Attach(func() {
+		fileSelect := new(walk.FileDialog)
+		fileSelect.Title = "Import Profile Bundle"
+		fileSelect.Filter = fileFilter
+		accepted, err := fileSelect.ShowOpen(g.settingDialog)
+		if err != nil || !accepted {
+			return
+		}
+		data, err := os.ReadFile(fileSelect.FilePath)
+		if err != nil {
+			winErrorBox(g.settingDialog, err)
+			return
+		}
+		b, pub, err := bundle.Decode(data, passLine.Text())
+		if err != nil {
+			winErrorBox(g.settingDialog, err)
+			return
+		}
+		profiles := b.Resolve()
+		for _, p := range profiles {
+			server, err := bundleServer(p)
+			if err == nil {
+				err = g.bundleProfileAllowed(p, server)
+			}
+			if err != nil {
+				winErrorBox(g.settingDialog, err)
+				return
+			}
+		}
+
+		const title = "SnixConnect Profile Bundle"
+		var newSigner string
+		if g.locked("BundleSigners") && (pub == nil ||
+			!g.currentConfig.trustsSigner(bundle.KeyFingerprint(pub))) {
+			winErrorBox(g.settingDialog, fmt.Errorf("only bundles signed by a key "+
+				"your organisation trusts can be imported"))
+			return
+		}
+		if pub == nil {
+			question := "The bundle is not signed, where it comes from can't be verified.\n\nImport it anyway?"
+			if walk.MsgBox(g.settingDialog, title, question,
+				walk.MsgBoxYesNo|walk.MsgBoxIconWarning) != walk.DlgCmdYes {
+				return
+			}
+		} else if fp := bundle.KeyFingerprint(pub); !g.currentConfig.trustsSigner(fp) {
+			question := fmt.Sprintf("The bundle is signed by a key which isn't trusted yet:\n\n%s\n\n"+
+				"Trust this key and import the bundle?", tlsconf.FormatFingerprint(fp))
+			if walk.MsgBox(g.settingDialog, title, question,
+				walk.MsgBoxYesNo|walk.MsgBoxIconQuestion) != walk.DlgCmdYes {
+				return
+			}
+			newSigner = fp
+		}
+
+		var changes []string
+		for _, p := range profiles {
+			old, ok := replacedProfile(g.credential, g.currentConfig, p)
+			if !ok {
+				continue
+			}
+			if lines := bundle.Diff(old, p); len(lines) > 0 {
+				changes = append(changes, fmt.Sprintf("%s:\n    %s", p.Name, strings.Join(lines, "\n    ")))
+			}
+		}
+		if len(changes) > 0 {
+			question := fmt.Sprintf("The bundle overwrites these settings:\n\n%s\n\nContinue?",
+				strings.Join(changes, "\n\n"))
+			if walk.MsgBox(g.settingDialog, title, question,
+				walk.MsgBoxYesNo|walk.MsgBoxIconQuestion) != walk.DlgCmdYes {
+				return
+			}
+		}
+		imported, signer = profiles, newSigner
+		showStatus()
+	})
+
+	buttonExport.Clicked().Attach(func() {
+		if len(g.credential.Profiles) == 0 {
+			winErrorBox(g.settingDialog, fmt.Errorf("there are no saved profiles to export"))
+			return
+		}
+		data, err := bundle.Encode(exportBundle(g.credential, g.currentConfig), passLine.Text(), key)
+		if err != nil {
+			winErrorBox(g.settingDialog, err)
+			return
+		}
+		fileSelect := new(walk.FileDialog)
+		fileSelect.Title = "Export Profile Bundle"
+		fileSelect.FilePath = "snixconnect-profiles.snixbundle"
+		fileSelect.Filter = fileFilter
+		accepted, err := fileSelect.ShowSave(g.settingDialog)
+		if err != nil || !accepted {
+			return
+		}
+		if fileSelect.FilterIndex == 1 &&
+			!strings.HasSuffix(fileSelect.FilePath, ".snixbundle") {
+			fileSelect.FilePath = fileSelect.FilePath + ".snixbundle"
+		}
+		if err := os.WriteFile(fileSelect.FilePath, data, filePerm); err != nil {
+			logger.Print(err)
+			winErrorBox(g.settingDialog, err)
+			return
+		}
+		logger.Printf("exported %d profiles to %s", len(g.credential.Profiles), fileSelect.FilePath)
+	})
+
+	buttonKey.Clicked().Attach(func() {
+		fileSelect := new(walk.FileDialog)
+		fileSelect.Title = "Select Signing Key"
+		fileSelect.Filter = "PEM Files (*.pem;*.key)|*.pem;*.key|All Files (*.*)|*.*"
+		accepted, err := fileSelect.ShowOpen(g.settingDialog)
+		if err != nil || !accepted {
+			return
+		}
+		data, err := os.ReadFile(fileSelect.FilePath)
+		if err != nil {
+			winErrorBox(g.settingDialog, err)
+			return
+		}
+		if key, err = bundle.ParseSigningKey(data); err != nil {
+			winErrorBox(g.settingDialog, err)
+			return
+		}
+		showStatus()
+	})
+
+	return func(newconf *UserAppConfig) (func() error, error) {
+		if len(imported) == 0 {
+			return nil, nil
+		}
+		for _, p := range imported {
+			if _, err := bundleServer(p); err != nil {
+				return nil, err
+			}
+		}
+		if len(signer) > 0 && !newconf.trustsSigner(signer) {
+			newconf.BundleSigners = append(newconf.BundleSigners, signer)
+			logger.Printf("trusted bundle signing key %s", tlsconf.FormatFingerprint(signer))
+		}
+		return func() error {
+			c := g.credential
+			for _, p := range imported {
+				if err := importProfile(c, newconf, p); err != nil {
+					return err
+				}
+			}
+			if err := saveUserCredential(c); err != nil {
+				return err
+			}
+			logger.Printf("imported %d profiles from bundle", len(imported))
+			g.profilesChanged("")
+			return nil
+		}, nil
+	}, nil
+}
+
+// newDropDownRow adds a labeled drop down box to parent.
+func newDropDownRow(parent walk.Container, text string, items []string,
+	selected int) (*walk.ComboBox, error) {
+	row, err := walk.NewComposite(parent)
+	if err != nil {
+		return nil, err
+	}
+	rowLayout := walk.NewHBoxLayout()
+	rowLayout.SetMargins(walk.Margins{})
+	row.SetLayout(rowLayout)
+	label, err := walk.NewLabel(row)
+	if err != nil {
+		return nil, err
+	}
+	box, err := walk.NewDropDownBox(row)
+	if err != nil {
+		return nil, err
+	}
+	label.SetText(text)
+	label.SetMinMaxSize(walk.Size{Width: 150}, walk.Size{})
+	box.SetModel(items)
+	box.SetCurrentIndex(selected)
+	box.SetMinMaxSize(walk.Size{Width: 100}, walk.Size{Width: 100})
+	return box, nil
+}
+
+// newNumberRow adds a labeled number edit to parent.
+func newNumberRow(parent walk.Container, text string, decimals int,
+	min, max, value float64) (*walk.NumberEdit, error) {
+	row, err := walk.NewComposite(parent)
+	if err != nil {
+		return nil, err
+	}
+	rowLayout := walk.NewHBoxLayout()
+	rowLayout.SetMargins(walk.Margins{})
+	row.SetLayout(rowLayout)
+	label, err := walk.NewLabel(row)
+	if err != nil {
+		return nil, err
+	}
+	edit, err := walk.NewNumberEdit(row)
+	if err != nil {
+		return nil, err
+	}
+	label.SetText(text)
+	label.SetMinMaxSize(walk.Size{Width: 150}, walk.Size{})
+	edit.SetDecimals(decimals)
+	edit.SetRange(min, max)
+	edit.SetValue(value)
+	edit.SetSpinButtonsVisible(true)
+	edit.SetMinMaxSize(walk.Size{Width: 100}, walk.Size{Width: 100})
+	return edit, nil
+}
@@ -0,0 +1,110 @@
+package gui
+
+import (
+	"fmt"
+
+	"snixconnect/internal/bundle"
+	"snixconnect/internal/policy"
+	"snixconnect/pkg/walk"
+)
+
+const managedNote = " (managed by your organisation)"
+
+// applyPolicy adds the profiles of p to c and config and forces the
+// settings of p on config. A username or group the policy leaves empty
+// is kept as the user entered it, a profile which can't be added is
+// logged and skipped.
+func applyPolicy(p *policy.Policy, c *userCredential, config *UserAppConfig) error {
+	for _, profile := range p.Profiles {
+		if existing := c.profile(profile.Name); existing != nil {
+			if len(profile.Username) == 0 {
+				profile.Username = existing.Username
+			}
+			if len(profile.Group) == 0 {
+				profile.Group = existing.Group
+			}
+		}
+		if err := importProfile(c, config, profile); err != nil {
+			logger.Printf("error: applying policy %v", err)
+		}
+	}
+	return p.Apply(config)
+}
+
+// ServerAllowed returns an error when the policy doesn't allow
+// connecting to server.
+func (g *appGuiHandler) ServerAllowed(server string) error {
+	urladdr, err := parseRawURL(server)
+	if err != nil {
+		return err
+	}
+	if !g.optionProperty.policy.AllowsServer(urladdr.Hostname()) {
+		return fmt.Errorf("connecting to %s is not allowed by your organisation", urladdr.Hostname())
+	}
+	return nil
+}
+
+// locked reports whether the policy forces one of settings.
+func (g *winOptionProperty) locked(settings ...string) bool {
+	for _, s := range settings {
+		if g.policy.Locked(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// serverLocked reports whether the options of the server in main window
+// are forced, by the policy of all servers or by a policy profile.
+func (g *winOptionProperty) serverLocked() bool {
+	if g.locked("Servers") {
+		return true
+	}
+	return g.managedServer(g.serverAddress())
+}
+
+func (g *winOptionProperty) managedServer(server string) bool {
+	if len(server) == 0 {
+		return false
+	}
+	for _, p := range g.policy.Profiles {
+		if s, err := bundleServer(p); err == nil && s == server {
+			return true
+		}
+	}
+	return false
+}
+
+// lockGroup disables groupBox and notes it in the title when locked.
+func lockGroup(groupBox *walk.GroupBox, locked bool) {
+	if !locked {
+		return
+	}
+	groupBox.SetTitle(groupBox.Title() + managedNote)
+	groupBox.SetEnabled(false)
+}
+
+func lockCheckBox(checkBox *walk.CheckBox, locked bool) {
+	if !locked {
+		return
+	}
+	checkBox.SetText(checkBox.Text() + managedNote)
+	checkBox.SetEnabled(false)
+}
+
+// bundleProfileAllowed returns an error when importing p would change a
+// policy profile or add a server the policy doesn't allow.
+func (g *winOptionProperty) bundleProfileAllowed(p bundle.Profile, server string) error {
+	if _, ok := g.policy.Profile(p.Name); ok || g.managedServer(server) {
+		return fmt.Errorf("profile %q is managed by your organisation", p.Name)
+	}
+	urladdr, err := parseRawURL(server)
+	if err != nil {
+		return err
+	}
+	if !g.policy.AllowsServer(urladdr.Hostname()) {
+		return fmt.Errorf("profile %q: connecting to %s is not allowed by your organisation",
+			p.Name, urladdr.Hostname())
+	}
+	return nil
+}
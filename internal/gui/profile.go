@@ -0,0 +1,156 @@
+package gui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Profile is a named server with the credential cached for it, the
+// backend and TLS options of a profile are the ones saved for its
+// address in ServerOptions.
+type Profile struct {
+	Name          string
+	ServerAddress string
+	UserCredential
+	LastConnected bool
+}
+
+func (c *userCredential) profile(name string) *Profile {
+	for i := range c.Profiles {
+		if strings.EqualFold(c.Profiles[i].Name, name) {
+			return &c.Profiles[i]
+		}
+	}
+	return nil
+}
+
+func (c *userCredential) profileOf(server string) *Profile {
+	if p := c.profile(c.LastProfile); p != nil && p.ServerAddress == server {
+		return p
+	}
+	for i := range c.Profiles {
+		if c.Profiles[i].ServerAddress == server {
+			return &c.Profiles[i]
+		}
+	}
+	return nil
+}
+
+func (c *userCredential) profileNames() []string {
+	names := make([]string, len(c.Profiles))
+	for i, p := range c.Profiles {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// profileAddress returns the address of the profile named name.
+func (c *userCredential) profileAddress(name string) (string, bool) {
+	if p := c.profile(strings.TrimSpace(name)); p != nil {
+		return p.ServerAddress, true
+	}
+	return "", false
+}
+
+// selectProfile makes the profile named text, or else the one of the
+// server address in text, the one the cached credential is of.
+func (c *userCredential) selectProfile(text string) bool {
+	p := c.profile(strings.TrimSpace(text))
+	if p == nil {
+		urladdr, err := parseRawURL(strings.TrimSpace(text))
+		if err != nil {
+			return false
+		}
+		if p = c.profileOf(urladdr.String()); p == nil {
+			return false
+		}
+	}
+	c.LastProfile = p.Name
+	c.ServerAddress = p.ServerAddress
+	c.UserCredential = p.UserCredential
+	c.LastConnected = p.LastConnected
+	return true
+}
+
+// storeProfile copies the cached credential to the last used profile,
+// or to a new profile named after the server when there is none for it.
+// The passwords of the profiles are kept only when cache is set.
+func (c *userCredential) storeProfile(cache bool) {
+	p := c.profileOf(c.ServerAddress)
+	if p == nil {
+		p = c.newProfile(profileName(c.ServerAddress), c.ServerAddress)
+	}
+	p.UserCredential = c.UserCredential
+	p.LastConnected = c.LastConnected
+	c.LastProfile = p.Name
+	if cache {
+		return
+	}
+	for i := range c.Profiles {
+		c.Profiles[i].Password = ""
+	}
+}
+
+func (c *userCredential) newProfile(name, server string) *Profile {
+	base := name
+	for i := 2; c.profile(name) != nil; i++ {
+		name = fmt.Sprintf("%s (%d)", base, i)
+	}
+	c.Profiles = append(c.Profiles, Profile{Name: name, ServerAddress: server})
+	return &c.Profiles[len(c.Profiles)-1]
+}
+
+func (c *userCredential) renameProfile(name, newName string) error {
+	if err := c.checkRename(name, newName); err != nil {
+		return err
+	}
+	newName = strings.TrimSpace(newName)
+	p := c.profile(name)
+	if p == nil || p.Name == newName {
+		return nil
+	}
+	if c.LastProfile == p.Name {
+		c.LastProfile = newName
+	}
+	p.Name = newName
+	return nil
+}
+
+// checkRename returns the error renaming profile name to newName gives,
+// without renaming it.
+func (c *userCredential) checkRename(name, newName string) error {
+	newName = strings.TrimSpace(newName)
+	p := c.profile(name)
+	if p == nil || p.Name == newName {
+		return nil
+	}
+	if len(newName) == 0 {
+		return fmt.Errorf("profile name can not be empty")
+	}
+	if other := c.profile(newName); other != nil && other != p {
+		return fmt.Errorf("a profile named %q exists already", newName)
+	}
+	return nil
+}
+
+func (c *userCredential) removeProfile(name string) {
+	for i := range c.Profiles {
+		if strings.EqualFold(c.Profiles[i].Name, name) {
+			c.Profiles = append(c.Profiles[:i], c.Profiles[i+1:]...)
+			break
+		}
+	}
+	if strings.EqualFold(c.LastProfile, name) {
+		c.LastProfile = ""
+	}
+}
+
+// profileName is the default name of the profile of server, its host
+// and user group.
+func profileName(server string) string {
+	urladdr, err := parseRawURL(server)
+	if err != nil || len(urladdr.Host) == 0 {
+		return server
+	}
+	return strings.TrimSuffix(urladdr.Host+urladdr.Path, "/")
+}
@@ -0,0 +1,148 @@
+package gui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+)
+
+const (
+	backupSuffix  = ".bak"
+	damagedSuffix = ".damaged"
+)
+
+// migration upgrades a decoded file from one schema version to the next.
+type migration func(doc map[string]json.RawMessage) error
+
+// fileDamaged is called when a file in the app directory doesn't decode,
+// restored tells whether its backup has been used instead.
+var fileDamaged = func(name string, restored bool, err error) {}
+
+// saveJSONFile writes v to name in the app directory through a temp file
+// renamed over it, so a crash never leaves a half written file. The file
+// it replaces is kept as name.bak when it is valid json.
+func saveJSONFile(name string, v interface{}) error {
+	path, err := mkdirLocalAppConfig(localAppDirByCmd)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if old, err := os.ReadFile(path + name); err == nil && json.Valid(old) {
+		if err := replaceFile(path+name+backupSuffix, old); err != nil {
+			return err
+		}
+	}
+	return replaceFile(path+name, append(data, '\n'))
+}
+
+func replaceFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// loadJSONFile decodes name from the app directory into v, running the
+// migrations from the schema version of the file unless migrations is
+// nil. A damaged file is moved aside and its backup is put in its place.
+func loadJSONFile(name string, v interface{}, migrations []migration) error {
+	path, err := mkdirLocalAppConfig(localAppDirByCmd)
+	if err != nil {
+		return err
+	}
+	err = decodeJSONFile(path+name, v, migrations)
+	if err == nil {
+		return nil
+	}
+	if os.IsNotExist(err) {
+		// the file may have been removed by hand or lost, its backup is used
+		if _, statErr := os.Stat(path + name + backupSuffix); statErr != nil {
+			return err
+		}
+	} else {
+		os.Rename(path+name, path+name+damagedSuffix)
+	}
+
+	resetValue(v)
+	if bakErr := decodeJSONFile(path+name+backupSuffix, v, migrations); bakErr != nil {
+		resetValue(v)
+		if !os.IsNotExist(err) {
+			fileDamaged(name, false, err)
+		}
+		return err
+	}
+	if data, err := os.ReadFile(path + name + backupSuffix); err == nil {
+		if err := replaceFile(path+name, data); err != nil {
+			logger.Print(err)
+		}
+	}
+	fileDamaged(name, true, err)
+	return nil
+}
+
+func decodeJSONFile(path string, v interface{}, migrations []migration) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if migrations != nil {
+		if data, err = migrate(data, migrations); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// resetValue sets what v points to back to its zero value, so nothing of
+// a file which failed to decode is left in it.
+func resetValue(v interface{}) {
+	e := reflect.ValueOf(v).Elem()
+	e.Set(reflect.Zero(e.Type()))
+}
+
+// migrate upgrades data from its schemaVersion to len(migrations), a file
+// written by a newer version is decoded as it is.
+func migrate(data []byte, migrations []migration) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var version int
+	if raw, ok := doc["schemaVersion"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, fmt.Errorf("invalid schema version: %v", err)
+		}
+	}
+	if version >= len(migrations) {
+		if version > len(migrations) {
+			logger.Printf("file of schema version %d is newer than this version of SnixConnect", version)
+		}
+		return data, nil
+	}
+	for i := version; i < len(migrations); i++ {
+		if err := migrations[i](doc); err != nil {
+			return nil, fmt.Errorf("migrating to schema version %d: %v", i+1, err)
+		}
+	}
+	doc["schemaVersion"] = json.RawMessage(strconv.Itoa(len(migrations)))
+	return json.Marshal(doc)
+}
@@ -0,0 +1,103 @@
+package gui
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const (
+	testServer = "https://vpn.example.com/eng"
+	testOTPURI = "otpauth://totp/SnixConnect:alice?secret=JBSWY3DPEHPK3PXP"
+)
+
+func migrateCredential(t *testing.T, data string) *userCredential {
+	t.Helper()
+	migrated, err := migrate([]byte(data), credentialMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := new(userCredential)
+	if err := json.Unmarshal(migrated, c); err != nil {
+		t.Fatalf("migrated file doesn't decode: %v\n%s", err, migrated)
+	}
+	if c.SchemaVersion != len(credentialMigrations) {
+		t.Errorf("schema version %d, want %d", c.SchemaVersion, len(credentialMigrations))
+	}
+	return c
+}
+
+func TestMigrateUnversionedCredential(t *testing.T) {
+	c := migrateCredential(t, `{
+		"ServerAddress": "`+testServer+`",
+		"Username": "alice",
+		"Password": "secret",
+		"Group": "engineering",
+		"LastConnected": true,
+		"OTPSecrets": {"`+testServer+`": "`+testOTPURI+`"}
+	}`)
+
+	want := Profile{
+		Name:           "vpn.example.com/eng",
+		ServerAddress:  testServer,
+		UserCredential: UserCredential{Username: "alice", Password: "secret", Group: "engineering"},
+		LastConnected:  true,
+	}
+	if len(c.Profiles) != 1 || c.Profiles[0] != want {
+		t.Errorf("profiles %+v, want %+v", c.Profiles, want)
+	}
+	if c.LastProfile != want.Name {
+		t.Errorf("last profile %q, want %q", c.LastProfile, want.Name)
+	}
+	if c.ServerAddress != testServer || c.Username != "alice" {
+		t.Errorf("single server fields not kept: %+v", c)
+	}
+	uri, ok, err := c.otpSecret(testServer)
+	if err != nil || !ok || uri != testOTPURI {
+		t.Errorf("totp token %q %v %v, want %q", uri, ok, err, testOTPURI)
+	}
+}
+
+func TestMigrateCredentialWithoutServer(t *testing.T) {
+	c := migrateCredential(t, `{}`)
+	if len(c.Profiles) != 0 || len(c.LastProfile) > 0 || len(c.OTPSecrets) > 0 {
+		t.Errorf("profile made up for an empty file: %+v", c)
+	}
+}
+
+func TestMigrateCredentialVersion1(t *testing.T) {
+	profiles := `[{"Name":"Office","ServerAddress":"` + testServer + `","Username":"bob"}]`
+	c := migrateCredential(t, `{
+		"schemaVersion": 1,
+		"ServerAddress": "`+testServer+`",
+		"Username": "bob",
+		"Profiles": `+profiles+`,
+		"LastProfile": "Office",
+		"OTPSecrets": {"`+testServer+`": "`+testOTPURI+`", "https://old.example.com": ""}
+	}`)
+
+	if len(c.Profiles) != 1 || c.Profiles[0].Name != "Office" || c.LastProfile != "Office" {
+		t.Errorf("profiles changed by the migration: %+v, last %q", c.Profiles, c.LastProfile)
+	}
+	if string(c.OTPSecrets[testServer]) == testOTPURI {
+		t.Error("totp token kept in the clear")
+	}
+	if _, ok := c.OTPSecrets["https://old.example.com"]; ok {
+		t.Error("empty totp token kept")
+	}
+	uri, ok, err := c.otpSecret(testServer)
+	if err != nil || !ok || uri != testOTPURI {
+		t.Errorf("totp token %q %v %v, want %q", uri, ok, err, testOTPURI)
+	}
+}
+
+func TestMigrateCredentialCurrent(t *testing.T) {
+	// a current file holds protected tokens, which must not be migrated again
+	data := `{"schemaVersion":2,"OTPSecrets":{"` + testServer + `":"cHJvdGVjdGVk"}}`
+	migrated, err := migrate([]byte(data), credentialMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(migrated) != data {
+		t.Errorf("current file changed to %s", migrated)
+	}
+}
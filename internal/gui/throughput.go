@@ -0,0 +1,186 @@
+package gui
+
+import (
+	"sync"
+	"time"
+
+	"snixconnect/pkg/walk"
+)
+
+const (
+	throughputWindow = 300 // one sample per second, five minutes
+	graphHeight      = 80
+)
+
+var (
+	graphColorRX   = walk.RGB(0x1e, 0x8c, 0x3c)
+	graphColorTX   = walk.RGB(0x1f, 0x5f, 0xbf)
+	graphColorGrid = walk.RGB(0xd8, 0xd8, 0xd8)
+)
+
+// throughputMeter turns the cumulative byte counters of the tunnel into
+// per second rates, the rates of the last five minutes are kept for the
+// graph and the peak and average values.
+type throughputMeter struct {
+	mutex  sync.Mutex
+	rx, tx [throughputWindow]float64
+	next   int
+	count  int
+
+	lastRX, lastTX uint64
+	lastAt         time.Time
+}
+
+func (m *throughputMeter) reset(rx, tx uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.next, m.count = 0, 0
+	m.lastRX, m.lastTX, m.lastAt = rx, tx, time.Now()
+}
+
+// add records the counters and returns the rates since the last call.
+func (m *throughputMeter) add(rx, tx uint64) (rxRate, txRate float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(m.lastAt).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+	rxRate = counterRate(m.lastRX, rx, elapsed)
+	txRate = counterRate(m.lastTX, tx, elapsed)
+	m.lastRX, m.lastTX, m.lastAt = rx, tx, now
+
+	m.rx[m.next], m.tx[m.next] = rxRate, txRate
+	m.next = (m.next + 1) % throughputWindow
+	if m.count < throughputWindow {
+		m.count++
+	}
+	return rxRate, txRate
+}
+
+// counterRate is the rate between two readings, a counter going backwards
+// belongs to a new tunnel and started over from zero.
+func counterRate(last, current uint64, elapsed float64) float64 {
+	if current < last {
+		return float64(current) / elapsed
+	}
+	return float64(current-last) / elapsed
+}
+
+// samples returns the recorded rates, oldest first.
+func (m *throughputMeter) samples() (rx, tx []float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	rx = make([]float64, 0, m.count)
+	tx = make([]float64, 0, m.count)
+	start := (m.next - m.count + throughputWindow) % throughputWindow
+	for i := 0; i < m.count; i++ {
+		j := (start + i) % throughputWindow
+		rx = append(rx, m.rx[j])
+		tx = append(tx, m.tx[j])
+	}
+	return rx, tx
+}
+
+type rateSummary struct {
+	peak, average float64
+}
+
+func summarizeRates(rates []float64) rateSummary {
+	var s rateSummary
+	if len(rates) == 0 {
+		return s
+	}
+	var sum float64
+	for _, r := range rates {
+		sum += r
+		if r > s.peak {
+			s.peak = r
+		}
+	}
+	s.average = sum / float64(len(rates))
+	return s
+}
+
+func formatRate(rate float64) string {
+	return formatTransceive(uint64(rate+0.5)) + "/s"
+}
+
+// newThroughputGraph draws the rates of m, the newest sample at the right
+// edge and the scale following the highest rate shown.
+func newThroughputGraph(parent walk.Container, m *throughputMeter) (*walk.CustomWidget, error) {
+	var graph *walk.CustomWidget
+	paint := func(canvas *walk.Canvas, _ walk.Rectangle) error {
+		bounds := graph.ClientBoundsPixels()
+		background, err := walk.NewSolidColorBrush(walk.RGB(0xff, 0xff, 0xff))
+		if err != nil {
+			return err
+		}
+		defer background.Dispose()
+		if err := canvas.FillRectanglePixels(background, bounds); err != nil {
+			return err
+		}
+
+		grid, err := walk.NewCosmeticPen(walk.PenDot, graphColorGrid)
+		if err != nil {
+			return err
+		}
+		defer grid.Dispose()
+		for i := 1; i < 4; i++ {
+			y := bounds.Height * i / 4
+			canvas.DrawLinePixels(grid, walk.Point{X: 0, Y: y}, walk.Point{X: bounds.Width, Y: y})
+		}
+		if err := canvas.DrawRectanglePixels(grid, bounds); err != nil {
+			return err
+		}
+
+		rx, tx := m.samples()
+		scale := summarizeRates(rx).peak
+		if peak := summarizeRates(tx).peak; peak > scale {
+			scale = peak
+		}
+		if scale < 1024 {
+			scale = 1024
+		}
+		for _, line := range []struct {
+			rates []float64
+			color walk.Color
+		}{{rx, graphColorRX}, {tx, graphColorTX}} {
+			if len(line.rates) < 2 {
+				continue
+			}
+			pen, err := walk.NewCosmeticPen(walk.PenSolid, line.color)
+			if err != nil {
+				return err
+			}
+			points := make([]walk.Point, len(line.rates))
+			offset := throughputWindow - len(line.rates)
+			for i, r := range line.rates {
+				points[i] = walk.Point{
+					X: (offset + i) * (bounds.Width - 1) / (throughputWindow - 1),
+					Y: bounds.Height - 1 - int(r/scale*float64(bounds.Height-2)),
+				}
+			}
+			err = canvas.DrawPolylinePixels(pen, points)
+			pen.Dispose()
+			if err != nil {
+				return err
+			}
+		}
+
+		text := bounds
+		text.X, text.Y = 4, 2
+		text.Width -= 8
+		return canvas.DrawTextPixels(formatRate(scale), graph.Font(), walk.RGB(0x70, 0x70, 0x70),
+			text, walk.TextLeft|walk.TextTop|walk.TextSingleLine)
+	}
+
+	graph, err := walk.NewCustomWidgetPixels(parent, 0, paint)
+	if err != nil {
+		return nil, err
+	}
+	graph.SetDoubleBuffering(true)
+	graph.SetMinMaxSize(walk.Size{Height: graphHeight}, walk.Size{Height: graphHeight})
+	return graph, nil
+}
@@ -11,6 +11,7 @@ type appTrayNotify struct {
 	showWinAction *walk.Action
 	hideWinAction *walk.Action
 	aboutAction   *walk.Action
+	historyAction *walk.Action
 	exitAction    *walk.Action
 	statusAction  *walk.Action
 
@@ -24,6 +25,7 @@ func (g *winMainProperty) newTrayIcon() {
 	g.tray.showWinAction = new(walk.Action)
 	g.tray.hideWinAction = new(walk.Action)
 	g.tray.aboutAction = new(walk.Action)
+	g.tray.historyAction = new(walk.Action)
 	g.tray.exitAction = new(walk.Action)
 	g.tray.statusAction = new(walk.Action)
 
@@ -66,6 +68,10 @@ func (g *winMainProperty) showTrayIcon() (err error) {
 	g.tray.aboutAction = walk.NewAction()
 	g.tray.aboutAction.SetText("About SnixConnect...")
 	tryActions = append(tryActions, g.tray.aboutAction)
+
+	g.tray.historyAction = walk.NewAction()
+	g.tray.historyAction.SetText("Connection History...")
+	tryActions = append(tryActions, g.tray.historyAction)
 	tryActions = append(tryActions, walk.NewSeparatorAction())
 
 	g.tray.hideWinAction = walk.NewAction()
@@ -112,6 +118,14 @@ func (g *appTrayNotify) attachAbotAction(h walk.EventHandler) {
 	t.Attach(h)
 }
 
+func (g *appTrayNotify) attachHistoryAction(h walk.EventHandler) {
+	t := g.historyAction.Triggered()
+	if t == nil {
+		return
+	}
+	t.Attach(h)
+}
+
 func (g *appTrayNotify) attachConnectAction(h walk.EventHandler) {
 	t := g.connectAction.Triggered()
 	if t == nil {
@@ -0,0 +1,173 @@
+package gui
+
+import (
+	"crypto/x509"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"snixconnect/internal/tlsconf"
+	"snixconnect/pkg/walk"
+
+	"github.com/lxn/win"
+)
+
+type winTrustProperty struct {
+	trustDialog *walk.Dialog
+	trustIsOpen bool
+	pinType     tlsconf.PinType
+	mutex       sync.Mutex
+}
+
+// chainDetails describes every certificate of chain with
+// the fingerprints the user can compare with the admin.
+func chainDetails(chain []*x509.Certificate) string {
+	var b strings.Builder
+	for i, cert := range chain {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		fmt.Fprintf(&b, "[%d] %s\r\n", i, cert.Subject)
+		fmt.Fprintf(&b, "Issuer: %s\r\n", cert.Issuer)
+		fmt.Fprintf(&b, "Valid: %s - %s\r\n", cert.NotBefore.Format(time.RFC1123),
+			cert.NotAfter.Format(time.RFC1123))
+		if len(cert.DNSNames) > 0 {
+			fmt.Fprintf(&b, "Names: %s\r\n", strings.Join(cert.DNSNames, ", "))
+		}
+		fmt.Fprintf(&b, "SHA-256: %s\r\n", tlsconf.FormatFingerprint(tlsconf.Fingerprint(cert)))
+		fmt.Fprintf(&b, "Public Key SHA-256: %s\r\n",
+			tlsconf.FormatFingerprint(tlsconf.PublicKeyFingerprint(cert)))
+	}
+	return b.String()
+}
+
+func (g *winTrustProperty) newTrustDialog(rch chan int, host string, chain []*x509.Certificate, reason error) {
+	g.closeDialog(walk.DlgCmdAbort)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	go func() {
+		err := g.showTrustDialog(rch, host, chain, reason)
+		if err == nil {
+			return
+		}
+		err = fmt.Errorf("error running showTrustDialog: %v", err)
+		go winErrorBox(nil, err)
+	}()
+}
+
+func (g *winTrustProperty) showTrustDialog(rch chan int, host string, chain []*x509.Certificate, reason error) (err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	runtime.LockOSThread()
+	defer close(rch)
+
+	g.trustDialog, err = walk.NewDialogWithStyle(nil,
+		win.WS_POPUPWINDOW, win.WS_EX_TOPMOST)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			g.trustDialog.Dispose()
+		}
+	}()
+	setIconForWidget(g.trustDialog, appAboutIconName,
+		g.trustDialog.DPI(), iconSize32x32)
+	vbox := walk.NewVBoxLayout()
+	vbox.SetMargins(walk.Margins{HNear: 9, VNear: 9, VFar: 9, HFar: 9})
+	g.trustDialog.SetTitle("Untrusted Server Certificate")
+	g.trustDialog.SetLayout(vbox)
+	setFontForWidget(g.trustDialog, appFontFamily, 9, 0)
+
+	groupBox, err := walk.NewGroupBox(g.trustDialog)
+	if err != nil {
+		return
+	}
+	vboxgr := walk.NewVBoxLayout()
+	vboxgr.SetMargins(walk.Margins{HNear: 10, VNear: 20, VFar: 20, HFar: 10})
+	vboxgr.SetAlignment(walk.AlignHNearVNear)
+	groupBox.SetLayout(vboxgr)
+	groupBox.SetTitle("Certificate Chain")
+
+	message, err := walk.NewTextLabel(groupBox)
+	if err != nil {
+		return
+	}
+	message.SetText(fmt.Sprintf("The certificate of %s could not be verified: %v.\r\n"+
+		"Pin it only after comparing the fingerprints with your administrator, "+
+		"a later change of the pinned certificate is refused.", host, reason))
+	message.SetMinMaxSize(walk.Size{Width: 460}, walk.Size{Width: 460})
+
+	details, err := walk.NewTextEditWithStyle(groupBox, win.WS_VSCROLL)
+	if err != nil {
+		return
+	}
+	setFontForWidget(details, "Consolas", 9, 0)
+	details.SetMinMaxSize(walk.Size{Width: 460, Height: 220}, walk.Size{})
+	details.SetReadOnly(true)
+	details.SetText(chainDetails(chain))
+
+	buttonComposite, err := walk.NewComposite(g.trustDialog)
+	if err != nil {
+		return
+	}
+	buttonLayout := walk.NewHBoxLayout()
+	buttonLayout.SetMargins(walk.Margins{})
+	buttonComposite.SetLayout(buttonLayout)
+	if _, err = walk.NewHSpacer(buttonComposite); err != nil {
+		return
+	}
+
+	buttonCert, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return
+	}
+	buttonKey, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return
+	}
+	buttonCancel, err := walk.NewPushButton(buttonComposite)
+	if err != nil {
+		return
+	}
+
+	pinHandler := func(t tlsconf.PinType) func() {
+		return func() {
+			g.pinType = t
+			g.trustDialog.Accept()
+		}
+	}
+
+	buttonCert.SetText("Pin Certificate")
+	buttonKey.SetText("Pin Public Key")
+	buttonCancel.SetText("Cancel")
+	buttonCert.Clicked().Attach(pinHandler(tlsconf.PinCertificate))
+	buttonKey.Clicked().Attach(pinHandler(tlsconf.PinPublicKey))
+	buttonCancel.Clicked().Attach(g.trustDialog.Cancel)
+	onButtonPressEnter(buttonCert.KeyUp(), pinHandler(tlsconf.PinCertificate))
+	onButtonPressEnter(buttonKey.KeyUp(), pinHandler(tlsconf.PinPublicKey))
+	onButtonPressEnter(buttonCancel.KeyUp(), g.trustDialog.Cancel)
+	buttonCancel.SetFocus()
+
+	g.trustDialog.Synchronize(func() {
+		g.trustIsOpen = true
+		winAdjustPos(g.trustDialog, 1.8)
+	})
+
+	g.trustDialog.Disposing().Attach(func() { g.trustIsOpen = false })
+	rch <- g.trustDialog.Run()
+	return
+}
+
+func (g *winTrustProperty) closeDialog(c int) {
+	if !g.trustIsOpen {
+		return
+	}
+
+	g.trustDialog.SetResult(c)
+	win.PostMessage(g.trustDialog.Handle(), win.WM_CLOSE, 0, 0)
+}
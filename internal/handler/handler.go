@@ -2,12 +2,74 @@ package handler
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
+	"net/netip"
+	"net/url"
+	"os"
+	"snixconnect/internal/anyconnect"
+	"snixconnect/internal/backend"
+	_ "snixconnect/internal/backend/simulate"
+	"snixconnect/internal/bsync"
 	"snixconnect/internal/gui"
+	"snixconnect/internal/killswitch"
 	"snixconnect/internal/logs"
+	"snixconnect/internal/proxy"
+	"snixconnect/internal/route"
+	"snixconnect/internal/tlsconf"
+	"snixconnect/internal/tun"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unsafe"
 )
 
-type gList struct {
-	Name, FriendlyName string
+const defaultBackend = anyconnect.Name
+
+// guiPrompter asks the user through the gui, the group picked in the
+// login form is kept for the connection history.
+type guiPrompter struct {
+	app   guiApp
+	group string
+}
+
+type guiApp interface {
+	UserCerdential(*gui.CredentialForm) (map[string]string, bool)
+	ShowServerBanner(string)
+	TrustServerCertificate(string, []*x509.Certificate, error) (tlsconf.Pin, bool)
+}
+
+func (p *guiPrompter) Credential(form *backend.Form) (map[string]string, bool) {
+	answers, ok := p.app.UserCerdential(form)
+	for _, f := range form.Fields {
+		if f.Type == backend.FieldSelect && len(answers[f.Name]) > 0 {
+			p.group = answers[f.Name]
+		}
+	}
+	return answers, ok
+}
+
+func (p *guiPrompter) Banner(banner string) { p.app.ShowServerBanner(banner) }
+
+func (p *guiPrompter) TrustCertificate(host string, chain []*x509.Certificate,
+	reason error) (tlsconf.Pin, bool) {
+	return p.app.TrustServerCertificate(host, chain, reason)
+}
+
+func disconnectFlag(err error) gui.StatusFlag {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return gui.FlagDisconnected
+	}
+
+	switch backend.KindOf(err) {
+	case backend.ErrAuthFailed:
+		return gui.FlagAuthFailed
+	case backend.ErrRejected:
+		return gui.FlagRejected
+	case backend.ErrCanceled:
+		return gui.FlagDisconnected
+	}
+	return gui.FlagConnFailed
 }
 
 func runSnixConnect(appdir string) {
@@ -15,47 +77,105 @@ func runSnixConnect(appdir string) {
 	app := gui.NewGuiHandler(appdir)
 	logger := logs.NewLogger("[NET]", app.GuiLogHandler())
 
-	authProvider := func(g []gList, banner string) bool {
-		guiGroup := make([]gui.GroupSelect, len(g))
-		for _, v := range g {
-			gs := gui.GroupSelect{Name: v.Name, FriendlyName: v.FriendlyName}
-			guiGroup = append(guiGroup, gs)
-		}
-
-		_, ok := app.UserCerdential(guiGroup, banner)
-		return ok
-
+	firewall := new(killswitch.Switch)
+	exe, err := os.Executable()
+	if err != nil {
+		logger.Print(err)
 	}
 
-	_ = authProvider
+	// blockTraffic lets only the tunnel through, stats is nil while
+	// the tunnel is down.
+	blockTraffic := func(mode killswitch.Mode, stats *gui.ConnectionStats) {
+		if mode == killswitch.ModeOff {
+			return
+		}
+		policy := killswitch.Policy{App: exe}
+		if stats != nil {
+			policy.Tunnel = stats.TunnelLUID
+			if gw, err := netip.ParseAddr(stats.Gateway); err == nil {
+				policy.Gateways = append(policy.Gateways, gw)
+			}
+			bypass, err := route.ParsePrefixes(strings.Join(stats.ExcludedRoutes, ","))
+			if err != nil {
+				logger.Printf("kill switch: excluded routes are blocked: %v", err)
+			}
+			policy.Bypass = bypass
+		} else {
+			var guid [16]byte
+			if g := app.GetTunnelGUID(); g != nil {
+				guid = *(*[16]byte)(unsafe.Pointer(g))
+			}
+			resolvers, err := killswitch.SystemResolvers(guid)
+			if err != nil {
+				logger.Printf("kill switch: %v", err)
+			}
+			policy.Resolvers = resolvers
+		}
+		if err := firewall.Apply(policy, mode == killswitch.ModeAlwaysOn); err != nil {
+			logger.Printf("kill switch: %v", err)
+		}
+	}
 
-	connHandler := func(ctx context.Context, addr string) {
-		config, guid := app.GetAppConfig(), app.GetTunnelGUID()
-		_, _ = config, guid
+	// idleTraffic sets the filters for when no connection is running.
+	idleTraffic := func(mode killswitch.Mode) {
+		if mode == killswitch.ModeAlwaysOn {
+			blockTraffic(mode, nil)
+			return
+		}
+		if err := firewall.Release(); err != nil {
+			logger.Printf("kill switch: %v", err)
+		}
+	}
+	var connecting atomic.Bool
+	meter := newUsageMeter(app, logger)
 
-		statuschan, errchan := simVpn(ctx)
+	// session runs one connection until the backend returns, stats are
+	// the ones of the tunnel, nil when it never came up.
+	session := func(ctx context.Context, vpn backend.Backend, conf *backend.Config,
+		mode killswitch.Mode, retrying bool) (stats *gui.ConnectionStats, err error) {
+		events := make(chan backend.Event)
+		errchan := make(chan error, 1)
+		watchCtx, stopWatch := context.WithCancel(ctx)
+		defer stopWatch()
+		go func() { errchan <- vpn.Connect(ctx, conf, events) }()
 
 		var stillReconnecting bool
 
 		for {
 			select {
 			case err := <-errchan:
-				logger.Print(err)
-				app.SetConnStatus(gui.NewStatusDisconnected(gui.FlagConnFailed))
-				return
+				if err != nil && !errors.Is(err, context.Canceled) {
+					logger.Print(err)
+				}
+				var changed *tlsconf.PinMismatchError
+				if errors.As(err, &changed) {
+					app.ShowCertificateChanged(changed)
+				}
+				return stats, err
 
-			case status := <-statuschan:
-				switch status {
-				case 1:
-					app.SetConnStatus(gui.NewStatusConnected(gui.ConnectionStats{}))
+			case event := <-events:
+				switch event.Status {
+				case backend.StatusConnected:
+					if s := event.Stats; stats == nil && s != nil && s.RX != nil && s.TX != nil {
+						go meter.watch(watchCtx, conf.Server, s.RX, s.TX)
+					}
+					stats = new(gui.ConnectionStats)
+					if event.Stats != nil {
+						*stats = *event.Stats
+					}
+					blockTraffic(mode, stats)
+					app.SetConnStatus(gui.NewStatusConnected(*stats))
 					stillReconnecting = false
 
-				case 0:
+				case backend.StatusConnecting:
 					flag := gui.FlagConnecting
+					if retrying {
+						flag = gui.FlagReconnecting
+					}
 					app.SetConnStatus(gui.NewStatusConnecting(flag))
 					stillReconnecting = false
 
-				case 3:
+				case backend.StatusReconnecting:
 					if !stillReconnecting {
 						flag := gui.FlagReconnecting
 						app.SetConnStatus(gui.NewStatusConnecting(flag))
@@ -66,21 +186,177 @@ func runSnixConnect(appdir string) {
 		}
 	}
 
-	app.SetConnectHandler(connHandler)
-	showErrMsg(app.RenderWindow())
-}
+	newConfig := func(addr string, prompt *guiPrompter) (*backend.Config, error) {
+		config, guid := app.GetAppConfig(), app.GetTunnelGUID()
 
-// simulate vpn library:
-func simVpn(ctx context.Context) (chan int, chan error) {
-	err := make(chan error)
-	status := make(chan int)
+		cert, err := app.ClientCertificate(addr)
+		if err != nil {
+			return nil, err
+		}
 
-	go func() {
-		status <- 0
-		<-ctx.Done()
-		close(err)
-	}()
+		proxyConf, err := app.ProxyConfig()
+		if err != nil {
+			return nil, err
+		}
 
-	return status, err
+		options := app.ServerOptions(addr)
+		conf := &backend.Config{
+			Server:        addr,
+			SkipTLSVerify: config.SkipTLSVerify,
+			Pins:          options.Pins,
+			TLS:           options.TLS,
+			ClientCert:    cert,
+			DisableDTLS:   config.DisableDTLS,
+			Liveness:      options.DPD.Liveness(),
+			Routes:        options.Routes,
+			DisableIPv6:   options.DisableIPv6,
+			DNS:           options.DNS,
+			Prompt:        prompt,
+			Logger:        logger,
+			AllowServer:   app.ServerAllowed,
+		}
+		if proxyConf.Mode != proxy.ModeNone {
+			conf.Dial = proxy.NewDialer(proxyConf, logger).DialContext
+		}
+		if guid != nil {
+			conf.TunnelGUID = *(*[16]byte)(unsafe.Pointer(guid))
+		}
+		return conf, nil
+	}
+
+	connHandler := func(ctx context.Context, addr string) {
+		connecting.Store(true)
+		defer func() {
+			connecting.Store(false)
+			idleTraffic(app.GetAppConfig().KillSwitch)
+		}()
+
+		config := app.GetAppConfig()
+		mode := config.KillSwitch
+		blockTraffic(mode, nil)
+
+		prompt := &guiPrompter{app: app}
+		record := gui.SessionRecord{Server: addr, Start: time.Now()}
+		if u, err := url.Parse(addr); err == nil {
+			record.Group = strings.Trim(u.Path, "/")
+		}
+		// disconnected ends the connection and writes it to the history
+		disconnected := func(flag gui.StatusFlag, err error) {
+			app.SetConnStatus(gui.NewStatusDisconnected(flag))
+			if len(prompt.group) > 0 {
+				record.Group = prompt.group
+			}
+			if err != nil && !errors.Is(err, context.Canceled) {
+				record.Error = err.Error()
+			}
+			record.End, record.Reason = time.Now(), flag
+			app.RecordSession(record)
+		}
+
+		if err := app.ServerAllowed(addr); err != nil {
+			logger.Print(err)
+			disconnected(gui.FlagConnFailed, err)
+			return
+		}
 
+		if alert, ok := meter.exceeded(addr); ok {
+			logger.Print(alert)
+			app.ShowQuotaAlert(alert)
+			disconnected(gui.FlagConnFailed, errors.New(alert.String()))
+			return
+		}
+
+		name := app.ServerOptions(addr).Backend
+		if len(name) == 0 {
+			name = config.Backend
+		}
+		if len(name) == 0 {
+			name = defaultBackend
+		}
+
+		vpn, err := backend.New(name)
+		if err != nil {
+			logger.Print(err)
+			disconnected(gui.FlagConnFailed, err)
+			return
+		}
+
+		policy := config.ReconnectPolicy()
+		// a lost data channel is dialed again with the session under the
+		// same policy, once that gives up the connection ends instead of
+		// logging in again
+		var redialsExhausted bool
+		redial := func(attempt int, err error) (time.Duration, bool) {
+			if !policy.Retry(attempt, err) {
+				redialsExhausted = true
+				return 0, false
+			}
+			delay := policy.Delay(attempt)
+			logger.Printf("redial attempt %d of %d in %s", attempt,
+				policy.MaxAttempts, delay.Round(time.Second))
+			return delay, true
+		}
+		for attempt := 0; ; attempt++ {
+			conf, err := newConfig(addr, prompt)
+			if err != nil {
+				logger.Print(err)
+				disconnected(gui.FlagConnFailed, err)
+				return
+			}
+			conf.Redial = redial
+
+			stats, err := session(ctx, vpn, conf, mode, attempt > 0)
+			if stats != nil {
+				attempt = 0
+				if stats.RX != nil && stats.TX != nil {
+					record.RX += stats.RX()
+					record.TX += stats.TX()
+				}
+			}
+			if ctx.Err() != nil || redialsExhausted || !policy.Retry(attempt+1, err) {
+				disconnected(disconnectFlag(err), err)
+				return
+			}
+
+			blockTraffic(mode, nil)
+			delay := policy.Delay(attempt + 1)
+			logger.Printf("reconnect attempt %d of %d in %s", attempt+1,
+				policy.MaxAttempts, delay.Round(time.Second))
+			next := time.Now().Add(delay)
+			app.SetConnStatus(gui.NewStatusReconnectWait(attempt+1, policy.MaxAttempts, next))
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				disconnected(gui.FlagDisconnected, nil)
+				return
+			}
+		}
+	}
+
+	startup := bsync.OnceFunc(func() {
+		// split dns rules outlive the process, a crash leaves them behind
+		if guid := app.GetTunnelGUID(); guid != nil {
+			if err := tun.CleanupDNS(*(*[16]byte)(unsafe.Pointer(guid))); err != nil {
+				logger.Print(err)
+			}
+		}
+		// and so does ipv6 unbound from the physical adapters
+		if err := tun.RestoreIPv6(); err != nil {
+			logger.Print(err)
+		}
+		go watchTrustedNetwork(app, logger)
+	})
+
+	// the handler first runs once the config and the tunnel guid are loaded
+	app.SetConfigHandler(func(config *gui.UserAppConfig) {
+		startup()
+		if !connecting.Load() {
+			idleTraffic(config.KillSwitch)
+		}
+	})
+	app.SetConnectHandler(connHandler)
+	showErrMsg(app.RenderWindow())
 }
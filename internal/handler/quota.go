@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"snixconnect/internal/gui"
+	"snixconnect/internal/quota"
+	"sync"
+	"time"
+)
+
+const (
+	quotaCheckInterval = 5 * time.Second
+	quotaSaveInterval  = time.Minute
+)
+
+type quotaApp interface {
+	GetAppConfig() *gui.UserAppConfig
+	ServerOptions(server string) gui.ServerOptions
+	DataUsage() quota.Usage
+	SaveDataUsage(quota.Usage)
+	ShowQuotaAlert(quota.Alert)
+	AutoDisconnect(reason string)
+}
+
+// usageMeter counts the traffic of the tunnels against the quota of all
+// servers and the one of the server connected to.
+type usageMeter struct {
+	app    quotaApp
+	logger *log.Logger
+	mutex  sync.Mutex
+	usage  quota.Usage
+}
+
+func newUsageMeter(app quotaApp, logger *log.Logger) *usageMeter {
+	return &usageMeter{app: app, logger: logger, usage: app.DataUsage()}
+}
+
+func (m *usageMeter) limits(server string) map[string]quota.Limits {
+	return map[string]quota.Limits{
+		quota.Global: m.app.GetAppConfig().Quota,
+		server:       m.app.ServerOptions(server).Quota,
+	}
+}
+
+// exceeded reports a quota with a hard cap that leaves no traffic for
+// server in this day or month.
+func (m *usageMeter) exceeded(server string) (quota.Alert, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	for scope, l := range m.limits(server) {
+		if !l.Disconnect {
+			continue
+		}
+		if alert, ok := m.usage.Counter(scope).Exceeded(now, scope, l); ok {
+			return alert, true
+		}
+	}
+	return quota.Alert{}, false
+}
+
+// add counts n bytes to server and returns the thresholds crossed.
+func (m *usageMeter) add(server string, n uint64) (alerts []quota.Alert, disconnect bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	for scope, l := range m.limits(server) {
+		counter := m.usage.Counter(scope)
+		counter.Add(now, n)
+		for _, alert := range counter.Check(now, scope, l) {
+			alerts = append(alerts, alert)
+			disconnect = disconnect || alert.Exceeded() && l.Disconnect
+		}
+	}
+	return alerts, disconnect
+}
+
+func (m *usageMeter) save() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.app.SaveDataUsage(m.usage)
+}
+
+// watch counts the traffic of the tunnel to server until ctx is done,
+// rx and tx are the counters of the tunnel.
+func (m *usageMeter) watch(ctx context.Context, server string, rx, tx func() uint64) {
+	var last uint64
+	saved := time.Now()
+	update := func() {
+		total := rx() + tx()
+		n := total - last
+		if total < last {
+			n = total
+		}
+		last = total
+		if n == 0 {
+			return
+		}
+		alerts, disconnect := m.add(server, n)
+		for _, alert := range alerts {
+			m.logger.Print(alert)
+			m.app.ShowQuotaAlert(alert)
+		}
+		if disconnect {
+			m.app.AutoDisconnect("data quota reached")
+		}
+	}
+
+	ticker := time.NewTicker(quotaCheckInterval)
+	defer ticker.Stop()
+	defer m.save()
+	for {
+		select {
+		case <-ticker.C:
+			update()
+			if time.Since(saved) >= quotaSaveInterval {
+				m.save()
+				saved = time.Now()
+			}
+		case <-ctx.Done():
+			update()
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"snixconnect/internal/gui"
+	"snixconnect/internal/trustnet"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const trustedNetworkInterval = 15 * time.Second
+
+type trustedNetworkApp interface {
+	GetAppConfig() *gui.UserAppConfig
+	GetTunnelGUID() *windows.GUID
+	AutoConnect(reason string)
+	AutoDisconnect(reason string)
+}
+
+// watchTrustedNetwork classifies the network whenever it or the rules
+// change, the configured action runs when the verdict changes so a
+// manual connect or disconnect sticks while the network stays the same.
+func watchTrustedNetwork(app trustedNetworkApp, logger *log.Logger) {
+	var last string
+	verdict := trustnet.Unknown
+
+	ticker := time.NewTicker(trustedNetworkInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		opts := app.GetAppConfig().TrustedNetwork
+		if len(opts.Rules) == 0 {
+			last, verdict = "", trustnet.Unknown
+			continue
+		}
+
+		var guid [16]byte
+		if g := app.GetTunnelGUID(); g != nil {
+			guid = *(*[16]byte)(unsafe.Pointer(g))
+		}
+		network, err := trustnet.Current(guid)
+		if err != nil {
+			logger.Printf("trusted network detection: %v", err)
+			continue
+		}
+		key := network.String() + "\n" + trustnet.FormatRules(opts.Rules)
+		if key == last {
+			continue
+		}
+		last = key
+
+		current, rule, ok := trustnet.Classify(context.Background(), opts.Rules, network)
+		if current == verdict {
+			continue
+		}
+		verdict = current
+		if !ok {
+			logger.Printf("trusted network detection: no rule matched %s", network)
+			continue
+		}
+		reason := fmt.Sprintf("network is %s by rule %q", current, rule.String())
+		switch opts.Action(current) {
+		case trustnet.ActionConnect:
+			app.AutoConnect(reason)
+		case trustnet.ActionDisconnect:
+			app.AutoDisconnect(reason)
+		default:
+			logger.Printf("%s, staying idle", reason)
+		}
+	}
+}
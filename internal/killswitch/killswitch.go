@@ -0,0 +1,56 @@
+package killswitch
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Switch keeps the filters of the kill switch in line with the
+// policy, it is safe for concurrent use.
+type Switch struct {
+	mutex sync.Mutex
+	fw    *firewall
+}
+
+// Apply replaces the filters with the ones enforcing p, persistent
+// filters stay in place when the process ends.
+func (s *Switch) Apply(p Policy, persistent bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.fw != nil && s.fw.persistent != persistent {
+		if err := s.fw.release(); err != nil {
+			return fmt.Errorf("can not release kill switch: %v", err)
+		}
+		s.fw = nil
+	}
+	if s.fw == nil {
+		fw, err := openFirewall(persistent)
+		if err != nil {
+			return fmt.Errorf("can not open windows filtering platform: %v", err)
+		}
+		s.fw = fw
+	}
+	if err := s.fw.apply(p.Rules()); err != nil {
+		return fmt.Errorf("can not apply kill switch: %v", err)
+	}
+	return nil
+}
+
+// Release removes the filters, the persistent ones
+// left behind by a previous process included.
+func (s *Switch) Release() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fw := s.fw
+	s.fw = nil
+	if fw == nil {
+		var err error
+		if fw, err = openFirewall(false); err != nil {
+			return fmt.Errorf("can not open windows filtering platform: %v", err)
+		}
+	}
+	if err := fw.release(); err != nil {
+		return fmt.Errorf("can not release kill switch: %v", err)
+	}
+	return nil
+}
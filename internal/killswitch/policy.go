@@ -0,0 +1,153 @@
+package killswitch
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+type Mode string
+
+const (
+	ModeOff Mode = ""
+
+	// ModeSession blocks from connect until the user disconnects or
+	// reconnecting gives up, the filters go away with the process.
+	ModeSession Mode = "session"
+
+	// ModeAlwaysOn blocks whenever the tunnel is down, the filters
+	// survive a crash of the process until the mode is turned off.
+	ModeAlwaysOn Mode = "always-on"
+)
+
+// Modes lists every mode in the order shown to the user.
+var Modes = []Mode{ModeOff, ModeSession, ModeAlwaysOn}
+
+func (m Mode) String() string {
+	switch m {
+	case ModeOff:
+		return "Off"
+	case ModeSession:
+		return "While Connected"
+	case ModeAlwaysOn:
+		return "Always On"
+	}
+	return string(m)
+}
+
+type Action uint8
+
+const (
+	Block Action = iota
+	Permit
+)
+
+type Direction uint8
+
+const (
+	Outbound Direction = 1 << iota
+	Inbound
+	Both = Outbound | Inbound
+)
+
+const (
+	ProtocolTCP = 6
+	ProtocolUDP = 17
+)
+
+// Rule is a single filter, the zero value of a condition matches
+// everything. Rules with a higher weight are evaluated first.
+type Rule struct {
+	Name      string
+	Action    Action
+	Direction Direction
+	Weight    uint8
+
+	// Interface is the luid of the network interface.
+	Interface  uint64
+	Remote     netip.Prefix
+	Protocol   uint8
+	LocalPort  uint16
+	RemotePort uint16
+	Loopback   bool
+
+	// App is the path of the executable which opened the connection.
+	App string
+}
+
+const (
+	weightBlock    = 0
+	weightPermit   = 10
+	weightLoopback = 15
+)
+
+// Policy is the traffic allowed while the kill switch is on,
+// everything else is blocked.
+type Policy struct {
+	// Tunnel is the luid of the tunnel device, zero while the tunnel is
+	// down. Name queries to Resolvers are then allowed so the server can
+	// be resolved.
+	Tunnel uint64
+
+	// Resolvers are the name servers of the network the machine is
+	// attached to.
+	Resolvers []netip.Addr
+
+	// Gateways are the addresses of the vpn server or its proxy.
+	Gateways []netip.Addr
+
+	// Bypass are the networks routed outside of the tunnel on purpose,
+	// e.g. the local lan.
+	Bypass []netip.Prefix
+
+	// App is the path of the executable of the vpn client, it may
+	// connect anywhere to reach the server while the tunnel is down.
+	App string
+}
+
+// Rules returns the filters enforcing p.
+func (p *Policy) Rules() []Rule {
+	rules := []Rule{
+		{Name: "Permit loopback", Action: Permit, Direction: Both, Weight: weightLoopback, Loopback: true},
+		{Name: "Permit DHCP", Action: Permit, Direction: Both, Weight: weightPermit,
+			Protocol: ProtocolUDP, LocalPort: 68, RemotePort: 67},
+		{Name: "Permit DHCPv6", Action: Permit, Direction: Both, Weight: weightPermit,
+			Protocol: ProtocolUDP, LocalPort: 546, RemotePort: 547},
+	}
+	if len(p.App) > 0 {
+		rules = append(rules, Rule{Name: "Permit vpn client", Action: Permit, Direction: Outbound,
+			Weight: weightPermit, App: p.App})
+	}
+	for _, gw := range p.Gateways {
+		if !gw.IsValid() {
+			continue
+		}
+		gw = gw.Unmap()
+		rules = append(rules, Rule{Name: "Permit vpn gateway " + gw.String(), Action: Permit,
+			Direction: Outbound, Weight: weightPermit, Remote: netip.PrefixFrom(gw, gw.BitLen())})
+	}
+	if p.Tunnel != 0 {
+		rules = append(rules, Rule{Name: "Permit tunnel", Action: Permit, Direction: Both,
+			Weight: weightPermit, Interface: p.Tunnel})
+	} else {
+		for _, resolver := range p.Resolvers {
+			if !resolver.IsValid() {
+				continue
+			}
+			resolver = resolver.Unmap()
+			for _, proto := range []uint8{ProtocolUDP, ProtocolTCP} {
+				rules = append(rules, Rule{Name: "Permit DNS to " + resolver.String() + " while tunnel is down",
+					Action: Permit, Direction: Outbound, Weight: weightPermit, Protocol: proto,
+					Remote: netip.PrefixFrom(resolver, resolver.BitLen()), RemotePort: 53})
+			}
+		}
+	}
+	for _, prefix := range p.Bypass {
+		if !prefix.IsValid() {
+			continue
+		}
+		rules = append(rules, Rule{Name: fmt.Sprintf("Permit bypass route %s", prefix.Masked()),
+			Action: Permit, Direction: Both, Weight: weightPermit, Remote: prefix.Masked()})
+	}
+	return append(rules, Rule{Name: "Block all other traffic", Action: Block, Direction: Both,
+		Weight: weightBlock})
+}
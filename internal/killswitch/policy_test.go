@@ -0,0 +1,96 @@
+package killswitch
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func dnsRules(rules []Rule) []Rule {
+	var dns []Rule
+	for _, r := range rules {
+		if r.RemotePort == 53 {
+			dns = append(dns, r)
+		}
+	}
+	return dns
+}
+
+func TestRulesTunnelDown(t *testing.T) {
+	p := Policy{
+		App:       `C:\Program Files\SnixConnect\snixconnect.exe`,
+		Gateways:  []netip.Addr{netip.MustParseAddr("::ffff:203.0.113.1")},
+		Resolvers: []netip.Addr{netip.MustParseAddr("192.0.2.53"), {}},
+	}
+	rules := p.Rules()
+
+	dns := dnsRules(rules)
+	if len(dns) != 2 {
+		t.Fatalf("got %d dns rules, want 2", len(dns))
+	}
+	want := netip.MustParsePrefix("192.0.2.53/32")
+	protocols := map[uint8]bool{}
+	for _, r := range dns {
+		if r.Remote != want {
+			t.Errorf("dns rule %q permits %v, want %v", r.Name, r.Remote, want)
+		}
+		if r.Action != Permit || r.Direction != Outbound || len(r.App) > 0 {
+			t.Errorf("unexpected dns rule %+v", r)
+		}
+		protocols[r.Protocol] = true
+	}
+	if !protocols[ProtocolUDP] || !protocols[ProtocolTCP] {
+		t.Errorf("dns rules don't cover udp and tcp: %+v", dns)
+	}
+
+	var gateway, app bool
+	for _, r := range rules {
+		if r.Remote == netip.MustParsePrefix("203.0.113.1/32") {
+			gateway = true
+		}
+		if r.App == p.App {
+			app = true
+		}
+	}
+	if !gateway || !app {
+		t.Errorf("gateway permitted %v, client permitted %v", gateway, app)
+	}
+
+	last := rules[len(rules)-1]
+	if last.Action != Block || last.Direction != Both || last.Remote.IsValid() {
+		t.Errorf("last rule %+v doesn't block all other traffic", last)
+	}
+}
+
+func TestRulesNoResolvers(t *testing.T) {
+	p := Policy{App: `C:\snixconnect.exe`}
+	for _, r := range p.Rules() {
+		if r.Action == Permit && !r.Remote.IsValid() && len(r.App) == 0 && !r.Loopback &&
+			r.LocalPort == 0 && r.Interface == 0 {
+			t.Errorf("rule %q permits any remote address", r.Name)
+		}
+	}
+}
+
+func TestRulesTunnelUp(t *testing.T) {
+	p := Policy{
+		Tunnel:    42,
+		Resolvers: []netip.Addr{netip.MustParseAddr("192.0.2.53")},
+		Bypass:    []netip.Prefix{netip.MustParsePrefix("192.168.1.10/24")},
+	}
+	rules := p.Rules()
+	if dns := dnsRules(rules); len(dns) > 0 {
+		t.Errorf("dns permitted outside of the tunnel while it is up: %+v", dns)
+	}
+	var tunnel, bypass bool
+	for _, r := range rules {
+		if r.Interface == 42 && r.Action == Permit {
+			tunnel = true
+		}
+		if r.Remote == netip.MustParsePrefix("192.168.1.0/24") && r.Action == Permit {
+			bypass = true
+		}
+	}
+	if !tunnel || !bypass {
+		t.Errorf("tunnel permitted %v, bypass permitted %v", tunnel, bypass)
+	}
+}
@@ -0,0 +1,44 @@
+package killswitch
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// SystemResolvers returns the name servers of the adapters which are up,
+// the adapter with guid, the tunnel device, is left out.
+func SystemResolvers(guid [16]byte) ([]netip.Addr, error) {
+	size := uint32(15 * 1024)
+	var buf []byte
+	for {
+		buf = make([]byte, size)
+		first := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0]))
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, windows.GAA_FLAG_SKIP_ANYCAST|
+			windows.GAA_FLAG_SKIP_MULTICAST|windows.GAA_FLAG_SKIP_UNICAST, 0, first, &size)
+		if err == nil {
+			break
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW {
+			return nil, fmt.Errorf("GetAdaptersAddresses: %v", err)
+		}
+	}
+
+	tunnel := (*windows.GUID)(unsafe.Pointer(&guid)).String()
+	var resolvers []netip.Addr
+	for a := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); a != nil; a = a.Next {
+		if a.OperStatus != windows.IfOperStatusUp || a.IfType == windows.IF_TYPE_SOFTWARE_LOOPBACK ||
+			strings.EqualFold(windows.BytePtrToString(a.AdapterName), tunnel) {
+			continue
+		}
+		for s := a.FirstDnsServerAddress; s != nil; s = s.Next {
+			if addr, ok := netip.AddrFromSlice(s.Address.IP()); ok {
+				resolvers = append(resolvers, addr.Unmap())
+			}
+		}
+	}
+	return resolvers, nil
+}
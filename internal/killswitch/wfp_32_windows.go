@@ -0,0 +1,27 @@
+//go:build windows && (386 || arm)
+
+package killswitch
+
+import "golang.org/x/sys/windows"
+
+// FWPM_FILTER0, the provider context union and filterId are 8 byte
+// aligned while go aligns 64 bit values to 4 bytes on 32 bit.
+type fwpmFilter0 struct {
+	filterKey           windows.GUID
+	displayData         fwpmDisplayData0
+	flags               uint32
+	providerKey         *windows.GUID
+	providerData        fwpByteBlob
+	layerKey            windows.GUID
+	subLayerKey         windows.GUID
+	weight              fwpValue0
+	numFilterConditions uint32
+	filterCondition     *fwpmFilterCondition0
+	action              fwpmAction0
+	_                   [4]byte
+	providerContextKey  windows.GUID
+	reserved            *windows.GUID
+	_                   [4]byte
+	filterID            uint64
+	effectiveWeight     fwpValue0
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package killswitch
+
+import (
+	"errors"
+	"net/netip"
+)
+
+type firewall struct{ persistent bool }
+
+func openFirewall(persistent bool) (*firewall, error) {
+	return nil, errors.New("kill switch is not available on this platform")
+}
+
+func (fw *firewall) apply(rules []Rule) error { return nil }
+func (fw *firewall) release() error           { return nil }
+
+func SystemResolvers(guid [16]byte) ([]netip.Addr, error) { return nil, nil }
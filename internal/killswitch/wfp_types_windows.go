@@ -0,0 +1,112 @@
+package killswitch
+
+import "golang.org/x/sys/windows"
+
+const (
+	rpcAuthnDefault        = 0xffffffff
+	fwpmSessionFlagDynamic = 0x1
+	fwpmFilterFlagNone     = 0x0
+
+	fwpActionBlock  = 0x1 | 0x1000
+	fwpActionPermit = 0x2 | 0x1000
+
+	fwpMatchEqual       = 0
+	fwpMatchFlagsAllSet = 6
+
+	fwpUint8                   = 1
+	fwpUint16                  = 2
+	fwpUint32                  = 3
+	fwpUint64                  = 4
+	fwpByteBlobType            = 12
+	fwpV4AddrMask              = 0x100
+	fwpV6AddrMask              = 0x101
+	fwpConditionFlagIsLoopback = 0x1
+
+	fwpEAlreadyExists    = 0x80320009
+	fwpEFilterNotFound   = 0x80320003
+	fwpESubLayerNotFound = 0x80320007
+)
+
+var (
+	layerALEAuthConnectV4    = windows.GUID{Data1: 0xc38d57d1, Data2: 0x05a7, Data3: 0x4c33, Data4: [8]byte{0x90, 0x4f, 0x7f, 0xbc, 0xee, 0xe6, 0x0e, 0x82}}
+	layerALEAuthConnectV6    = windows.GUID{Data1: 0x4a72393b, Data2: 0x319f, Data3: 0x44bc, Data4: [8]byte{0x84, 0xc3, 0xba, 0x54, 0xdc, 0xb3, 0xb6, 0xb4}}
+	layerALEAuthRecvAcceptV4 = windows.GUID{Data1: 0xe1cd9fe7, Data2: 0xf4b5, Data3: 0x4273, Data4: [8]byte{0x96, 0xc0, 0x59, 0x2e, 0x48, 0x7b, 0x86, 0x50}}
+	layerALEAuthRecvAcceptV6 = windows.GUID{Data1: 0xa3b42c97, Data2: 0x9f04, Data3: 0x4672, Data4: [8]byte{0xb8, 0x7e, 0xce, 0xe9, 0xc4, 0x83, 0x25, 0x7f}}
+
+	conditionIPRemoteAddress  = windows.GUID{Data1: 0xb235ae9a, Data2: 0x1d64, Data3: 0x49b8, Data4: [8]byte{0xa4, 0x4c, 0x5f, 0xf3, 0xd9, 0x09, 0x50, 0x45}}
+	conditionIPLocalInterface = windows.GUID{Data1: 0x4cd62a49, Data2: 0x59c3, Data3: 0x4969, Data4: [8]byte{0xb7, 0xf3, 0xbd, 0xa5, 0xd3, 0x28, 0x90, 0xa4}}
+	conditionIPRemotePort     = windows.GUID{Data1: 0xc35a604d, Data2: 0xd22b, Data3: 0x4e1a, Data4: [8]byte{0x91, 0xb4, 0x68, 0xf6, 0x74, 0xee, 0x67, 0x4b}}
+	conditionIPLocalPort      = windows.GUID{Data1: 0x0c1ba1af, Data2: 0x5765, Data3: 0x453f, Data4: [8]byte{0xaf, 0x22, 0xa8, 0xf7, 0x91, 0xac, 0x77, 0x5b}}
+	conditionIPProtocol       = windows.GUID{Data1: 0x3971ef2b, Data2: 0x623e, Data3: 0x4f9a, Data4: [8]byte{0x8c, 0xb1, 0x6e, 0x79, 0xb8, 0x06, 0xb9, 0xa7}}
+	conditionFlags            = windows.GUID{Data1: 0x632ce23b, Data2: 0x5167, Data3: 0x435c, Data4: [8]byte{0x86, 0xd7, 0xe9, 0x03, 0x68, 0x4a, 0xa8, 0x0c}}
+	conditionALEAppID         = windows.GUID{Data1: 0xd78e1e87, Data2: 0x8644, Data3: 0x4ea5, Data4: [8]byte{0x94, 0x37, 0xd8, 0x09, 0xec, 0xef, 0xc9, 0x71}}
+
+	// sublayer holding every filter of the kill switch
+	subLayerKey = windows.GUID{Data1: 0x7b6f2c1e, Data2: 0x5a3d, Data3: 0x4e8b, Data4: [8]byte{0x9c, 0x21, 0x6d, 0x4f, 0x83, 0xa5, 0x1b, 0xe7}}
+)
+
+// FWPM_DISPLAY_DATA0
+type fwpmDisplayData0 struct {
+	name        *uint16
+	description *uint16
+}
+
+// FWP_BYTE_BLOB
+type fwpByteBlob struct {
+	size uint32
+	data *uint8
+}
+
+// FWPM_SESSION0
+type fwpmSession0 struct {
+	sessionKey           windows.GUID
+	displayData          fwpmDisplayData0
+	flags                uint32
+	txnWaitTimeoutInMSec uint32
+	processID            uint32
+	sid                  *windows.SID
+	username             *uint16
+	kernelMode           int32
+}
+
+// FWPM_SUBLAYER0
+type fwpmSublayer0 struct {
+	subLayerKey  windows.GUID
+	displayData  fwpmDisplayData0
+	flags        uint32
+	providerKey  *windows.GUID
+	providerData fwpByteBlob
+	weight       uint16
+}
+
+// FWP_VALUE0 and FWP_CONDITION_VALUE0, value holds small integers
+// or a pointer to the data.
+type fwpValue0 struct {
+	typ   uint32
+	value uintptr
+}
+
+// FWPM_FILTER_CONDITION0
+type fwpmFilterCondition0 struct {
+	fieldKey       windows.GUID
+	matchType      uint32
+	conditionValue fwpValue0
+}
+
+// FWPM_ACTION0
+type fwpmAction0 struct {
+	typ        uint32
+	filterType windows.GUID
+}
+
+// FWP_V4_ADDR_AND_MASK, both in host order
+type fwpV4AddrAndMask struct {
+	addr uint32
+	mask uint32
+}
+
+// FWP_V6_ADDR_AND_MASK
+type fwpV6AddrAndMask struct {
+	addr         [16]byte
+	prefixLength uint8
+}
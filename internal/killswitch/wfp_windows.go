@@ -0,0 +1,287 @@
+package killswitch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	fwpuclnt                     = windows.NewLazySystemDLL("fwpuclnt.dll")
+	fwpmEngineOpen0              = fwpuclnt.NewProc("FwpmEngineOpen0")
+	fwpmEngineClose0             = fwpuclnt.NewProc("FwpmEngineClose0")
+	fwpmTransactionBegin0        = fwpuclnt.NewProc("FwpmTransactionBegin0")
+	fwpmTransactionCommit0       = fwpuclnt.NewProc("FwpmTransactionCommit0")
+	fwpmTransactionAbort0        = fwpuclnt.NewProc("FwpmTransactionAbort0")
+	fwpmSubLayerAdd0             = fwpuclnt.NewProc("FwpmSubLayerAdd0")
+	fwpmSubLayerDeleteByKey0     = fwpuclnt.NewProc("FwpmSubLayerDeleteByKey0")
+	fwpmFilterAdd0               = fwpuclnt.NewProc("FwpmFilterAdd0")
+	fwpmFilterDeleteByKey0       = fwpuclnt.NewProc("FwpmFilterDeleteByKey0")
+	fwpmFilterCreateEnumHandle0  = fwpuclnt.NewProc("FwpmFilterCreateEnumHandle0")
+	fwpmFilterEnum0              = fwpuclnt.NewProc("FwpmFilterEnum0")
+	fwpmFilterDestroyEnumHandle0 = fwpuclnt.NewProc("FwpmFilterDestroyEnumHandle0")
+	fwpmFreeMemory0              = fwpuclnt.NewProc("FwpmFreeMemory0")
+	fwpmGetAppIdFromFileName0    = fwpuclnt.NewProc("FwpmGetAppIdFromFileName0")
+)
+
+const enumPageSize = 256
+
+func wfpError(op string, r uintptr) error {
+	if r == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s: %v", op, windows.Errno(r))
+}
+
+// firewall is a session with the filter engine, the filters added in a
+// dynamic session are removed by windows when the session is closed,
+// e.g. because the process has crashed.
+type firewall struct {
+	engine     uintptr
+	persistent bool
+}
+
+func openFirewall(persistent bool) (*firewall, error) {
+	name, err := windows.UTF16PtrFromString("SnixConnect kill switch")
+	if err != nil {
+		return nil, err
+	}
+	session := fwpmSession0{txnWaitTimeoutInMSec: windows.INFINITE}
+	session.displayData.name = name
+	if !persistent {
+		session.flags = fwpmSessionFlagDynamic
+	}
+	fw := &firewall{persistent: persistent}
+	r, _, _ := fwpmEngineOpen0.Call(0, rpcAuthnDefault, 0,
+		uintptr(unsafe.Pointer(&session)), uintptr(unsafe.Pointer(&fw.engine)))
+	if err := wfpError("FwpmEngineOpen0", r); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+func (fw *firewall) close() { fwpmEngineClose0.Call(fw.engine) }
+
+// apply replaces every filter of the kill switch with rules.
+func (fw *firewall) apply(rules []Rule) error {
+	return fw.transaction(func() error {
+		if err := fw.deleteFilters(); err != nil {
+			return err
+		}
+		if err := fw.addSubLayer(); err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			if err := fw.addRule(rule); err != nil {
+				return fmt.Errorf("can not add kill switch filter %q: %v", rule.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// release removes every filter of the kill switch and closes the session.
+func (fw *firewall) release() error {
+	defer fw.close()
+	return fw.transaction(func() error {
+		if err := fw.deleteFilters(); err != nil {
+			return err
+		}
+		r, _, _ := fwpmSubLayerDeleteByKey0.Call(fw.engine, uintptr(unsafe.Pointer(&subLayerKey)))
+		if r == fwpESubLayerNotFound {
+			return nil
+		}
+		return wfpError("FwpmSubLayerDeleteByKey0", r)
+	})
+}
+
+func (fw *firewall) transaction(f func() error) error {
+	r, _, _ := fwpmTransactionBegin0.Call(fw.engine, 0)
+	if err := wfpError("FwpmTransactionBegin0", r); err != nil {
+		return err
+	}
+	if err := f(); err != nil {
+		fwpmTransactionAbort0.Call(fw.engine)
+		return err
+	}
+	r, _, _ = fwpmTransactionCommit0.Call(fw.engine)
+	return wfpError("FwpmTransactionCommit0", r)
+}
+
+func (fw *firewall) addSubLayer() error {
+	name, err := windows.UTF16PtrFromString("SnixConnect kill switch")
+	if err != nil {
+		return err
+	}
+	sublayer := fwpmSublayer0{subLayerKey: subLayerKey, weight: 0xffff}
+	sublayer.displayData.name = name
+	r, _, _ := fwpmSubLayerAdd0.Call(fw.engine, uintptr(unsafe.Pointer(&sublayer)), 0)
+	if r == fwpEAlreadyExists {
+		return nil
+	}
+	return wfpError("FwpmSubLayerAdd0", r)
+}
+
+// deleteFilters removes the filters in the sublayer of the kill switch,
+// the ones added by other sessions included.
+func (fw *firewall) deleteFilters() error {
+	var handle uintptr
+	r, _, _ := fwpmFilterCreateEnumHandle0.Call(fw.engine, 0, uintptr(unsafe.Pointer(&handle)))
+	if err := wfpError("FwpmFilterCreateEnumHandle0", r); err != nil {
+		return err
+	}
+	defer fwpmFilterDestroyEnumHandle0.Call(fw.engine, handle)
+
+	var keys []windows.GUID
+	for {
+		var entries **fwpmFilter0
+		var n uint32
+		r, _, _ := fwpmFilterEnum0.Call(fw.engine, handle, enumPageSize,
+			uintptr(unsafe.Pointer(&entries)), uintptr(unsafe.Pointer(&n)))
+		if err := wfpError("FwpmFilterEnum0", r); err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for _, filter := range unsafe.Slice(entries, n) {
+			if filter.subLayerKey == subLayerKey {
+				keys = append(keys, filter.filterKey)
+			}
+		}
+		fwpmFreeMemory0.Call(uintptr(unsafe.Pointer(&entries)))
+	}
+
+	for i := range keys {
+		r, _, _ := fwpmFilterDeleteByKey0.Call(fw.engine, uintptr(unsafe.Pointer(&keys[i])))
+		if r != 0 && r != fwpEFilterNotFound {
+			return wfpError("FwpmFilterDeleteByKey0", r)
+		}
+	}
+	return nil
+}
+
+type layer struct {
+	key windows.GUID
+	v6  bool
+}
+
+// layers returns the ale layers of the directions and address families of rule.
+func layers(rule Rule) []layer {
+	var result []layer
+	v4 := !rule.Remote.IsValid() || rule.Remote.Addr().Is4()
+	v6 := !rule.Remote.IsValid() || rule.Remote.Addr().Is6()
+	if rule.Direction&Outbound != 0 {
+		if v4 {
+			result = append(result, layer{key: layerALEAuthConnectV4})
+		}
+		if v6 {
+			result = append(result, layer{key: layerALEAuthConnectV6, v6: true})
+		}
+	}
+	if rule.Direction&Inbound != 0 {
+		if v4 {
+			result = append(result, layer{key: layerALEAuthRecvAcceptV4})
+		}
+		if v6 {
+			result = append(result, layer{key: layerALEAuthRecvAcceptV6, v6: true})
+		}
+	}
+	return result
+}
+
+func (fw *firewall) addRule(rule Rule) error {
+	name, err := windows.UTF16PtrFromString(rule.Name)
+	if err != nil {
+		return err
+	}
+	var appID *fwpByteBlob
+	if len(rule.App) > 0 {
+		path, err := windows.UTF16PtrFromString(rule.App)
+		if err != nil {
+			return err
+		}
+		r, _, _ := fwpmGetAppIdFromFileName0.Call(uintptr(unsafe.Pointer(path)),
+			uintptr(unsafe.Pointer(&appID)))
+		if err := wfpError("FwpmGetAppIdFromFileName0", r); err != nil {
+			return err
+		}
+		defer fwpmFreeMemory0.Call(uintptr(unsafe.Pointer(&appID)))
+	}
+
+	action := uint32(fwpActionBlock)
+	if rule.Action == Permit {
+		action = fwpActionPermit
+	}
+	for _, l := range layers(rule) {
+		conditions, keep := filterConditions(rule, appID)
+		filter := fwpmFilter0{
+			layerKey:            l.key,
+			subLayerKey:         subLayerKey,
+			weight:              fwpValue0{typ: fwpUint8, value: uintptr(rule.Weight)},
+			numFilterConditions: uint32(len(conditions)),
+			action:              fwpmAction0{typ: action},
+		}
+		filter.displayData.name = name
+		if len(conditions) > 0 {
+			filter.filterCondition = &conditions[0]
+		}
+		r, _, _ := fwpmFilterAdd0.Call(fw.engine, uintptr(unsafe.Pointer(&filter)), 0, 0)
+		runtime.KeepAlive(keep)
+		if err := wfpError("FwpmFilterAdd0", r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterConditions converts the conditions of rule, the values referenced
+// by the conditions are held by keep.
+func filterConditions(rule Rule, appID *fwpByteBlob) (conditions []fwpmFilterCondition0, keep []any) {
+	add := func(field windows.GUID, match uint32, typ uint32, value uintptr) {
+		conditions = append(conditions, fwpmFilterCondition0{
+			fieldKey: field, matchType: match, conditionValue: fwpValue0{typ: typ, value: value},
+		})
+	}
+	if rule.Loopback {
+		add(conditionFlags, fwpMatchFlagsAllSet, fwpUint32, fwpConditionFlagIsLoopback)
+	}
+	if rule.Interface != 0 {
+		luid := new(uint64)
+		*luid = rule.Interface
+		keep = append(keep, luid)
+		add(conditionIPLocalInterface, fwpMatchEqual, fwpUint64, uintptr(unsafe.Pointer(luid)))
+	}
+	if rule.Remote.IsValid() {
+		prefix := rule.Remote.Masked()
+		if prefix.Addr().Is4() {
+			a4 := prefix.Addr().As4()
+			m := &fwpV4AddrAndMask{
+				addr: binary.BigEndian.Uint32(a4[:]),
+				mask: ^uint32(0) << (32 - prefix.Bits()),
+			}
+			keep = append(keep, m)
+			add(conditionIPRemoteAddress, fwpMatchEqual, fwpV4AddrMask, uintptr(unsafe.Pointer(m)))
+		} else {
+			m := &fwpV6AddrAndMask{addr: prefix.Addr().As16(), prefixLength: uint8(prefix.Bits())}
+			keep = append(keep, m)
+			add(conditionIPRemoteAddress, fwpMatchEqual, fwpV6AddrMask, uintptr(unsafe.Pointer(m)))
+		}
+	}
+	if rule.Protocol != 0 {
+		add(conditionIPProtocol, fwpMatchEqual, fwpUint8, uintptr(rule.Protocol))
+	}
+	if rule.LocalPort != 0 {
+		add(conditionIPLocalPort, fwpMatchEqual, fwpUint16, uintptr(rule.LocalPort))
+	}
+	if rule.RemotePort != 0 {
+		add(conditionIPRemotePort, fwpMatchEqual, fwpUint16, uintptr(rule.RemotePort))
+	}
+	if appID != nil {
+		add(conditionALEAppID, fwpMatchEqual, fwpByteBlobType, uintptr(unsafe.Pointer(appID)))
+	}
+	return conditions, keep
+}
@@ -0,0 +1,200 @@
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultDigits = 6
+	DefaultPeriod = 30 * time.Second
+)
+
+type Algorithm string
+
+const (
+	SHA1   Algorithm = "SHA1"
+	SHA256 Algorithm = "SHA256"
+	SHA512 Algorithm = "SHA512"
+)
+
+func (a Algorithm) hash() (func() hash.Hash, error) {
+	switch a {
+	case SHA1, "":
+		return sha1.New, nil
+	case SHA256:
+		return sha256.New, nil
+	case SHA512:
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported otp algorithm %q", string(a))
+}
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Key is a TOTP key as described by an otpauth:// uri.
+type Key struct {
+	Secret    []byte
+	Issuer    string
+	Account   string
+	Algorithm Algorithm
+	Digits    int
+	Period    time.Duration
+}
+
+// DecodeSecret decodes a base32 secret, spaces, dashes and
+// padding are ignored and the letters may be in any case.
+func DecodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.TrimRight(s, "="))
+	s = strings.NewReplacer(" ", "", "-", "").Replace(s)
+	secret, err := b32.DecodeString(s)
+	if err != nil || len(secret) == 0 {
+		return nil, errors.New("otp secret is not a valid base32 string")
+	}
+	return secret, nil
+}
+
+// ParseURI parses an otpauth://totp/ uri, only the secret
+// parameter is required.
+func ParseURI(uri string) (*Key, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "otpauth" {
+		return nil, errors.New("otp uri must start with otpauth://")
+	}
+	if !strings.EqualFold(u.Host, "totp") {
+		return nil, fmt.Errorf("unsupported otp type %q, only totp is supported", u.Host)
+	}
+
+	q := u.Query()
+	k := &Key{
+		Issuer:    q.Get("issuer"),
+		Algorithm: Algorithm(strings.ToUpper(q.Get("algorithm"))),
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+	}
+	if k.Secret, err = DecodeSecret(q.Get("secret")); err != nil {
+		return nil, err
+	}
+	if len(k.Algorithm) == 0 {
+		k.Algorithm = SHA1
+	}
+	if _, err := k.Algorithm.hash(); err != nil {
+		return nil, err
+	}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		k.Account = strings.TrimSpace(account)
+		if len(k.Issuer) == 0 {
+			k.Issuer = strings.TrimSpace(issuer)
+		}
+	} else {
+		k.Account = label
+	}
+
+	if v := q.Get("digits"); len(v) > 0 {
+		if k.Digits, err = strconv.Atoi(v); err != nil || k.Digits < 6 || k.Digits > 8 {
+			return nil, fmt.Errorf("invalid otp digits %q", v)
+		}
+	}
+	if v := q.Get("period"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid otp period %q", v)
+		}
+		k.Period = time.Duration(n) * time.Second
+	}
+	return k, nil
+}
+
+// ParseKey accepts either an otpauth:// uri or a bare base32 secret.
+func ParseKey(s string) (*Key, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(strings.ToLower(s), "otpauth:") {
+		return ParseURI(s)
+	}
+	secret, err := DecodeSecret(s)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{Secret: secret, Algorithm: SHA1, Digits: DefaultDigits, Period: DefaultPeriod}, nil
+}
+
+// URI returns the otpauth:// form of the key.
+func (k *Key) URI() string {
+	label := k.Account
+	if len(k.Issuer) > 0 {
+		label = k.Issuer + ":" + k.Account
+	}
+	q := url.Values{}
+	q.Set("secret", b32.EncodeToString(k.Secret))
+	if len(k.Issuer) > 0 {
+		q.Set("issuer", k.Issuer)
+	}
+	q.Set("algorithm", string(k.Algorithm))
+	q.Set("digits", strconv.Itoa(k.Digits))
+	q.Set("period", strconv.Itoa(int(k.Period/time.Second)))
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + label, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// Name is a short description of the key for display.
+func (k *Key) Name() string {
+	switch {
+	case len(k.Issuer) > 0 && len(k.Account) > 0:
+		return k.Issuer + " (" + k.Account + ")"
+	case len(k.Issuer) > 0:
+		return k.Issuer
+	case len(k.Account) > 0:
+		return k.Account
+	}
+	return "TOTP token"
+}
+
+// Code returns the RFC 6238 code of the key at t.
+func (k *Key) Code(t time.Time) (string, error) {
+	period := k.Period
+	if period <= 0 {
+		period = DefaultPeriod
+	}
+	return HOTP(k.Secret, uint64(t.Unix()/int64(period/time.Second)), k.Digits, k.Algorithm)
+}
+
+// HOTP returns the RFC 4226 code of secret for counter.
+func HOTP(secret []byte, counter uint64, digits int, alg Algorithm) (string, error) {
+	h, err := alg.hash()
+	if err != nil {
+		return "", err
+	}
+	if digits <= 0 {
+		digits = DefaultDigits
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(h, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod), nil
+}
@@ -0,0 +1,111 @@
+package otp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 4226 appendix D
+func TestHOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	want := []string{"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		got, err := HOTP(secret, uint64(counter), 6, SHA1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != code {
+			t.Errorf("counter %d: got %s, want %s", counter, got, code)
+		}
+	}
+}
+
+// RFC 6238 appendix B
+func TestTOTP(t *testing.T) {
+	secrets := map[Algorithm][]byte{
+		SHA1:   []byte("12345678901234567890"),
+		SHA256: []byte("12345678901234567890123456789012"),
+		SHA512: []byte(strings.Repeat("1234567890", 6) + "1234"),
+	}
+	for _, test := range []struct {
+		unix int64
+		want map[Algorithm]string
+	}{
+		{59, map[Algorithm]string{SHA1: "94287082", SHA256: "46119246", SHA512: "90693936"}},
+		{1111111109, map[Algorithm]string{SHA1: "07081804", SHA256: "68084774", SHA512: "25091201"}},
+		{1111111111, map[Algorithm]string{SHA1: "14050471", SHA256: "67062674", SHA512: "99943326"}},
+		{1234567890, map[Algorithm]string{SHA1: "89005924", SHA256: "91819424", SHA512: "93441116"}},
+		{2000000000, map[Algorithm]string{SHA1: "69279037", SHA256: "90698825", SHA512: "38618901"}},
+		{20000000000, map[Algorithm]string{SHA1: "65353130", SHA256: "77737706", SHA512: "47863826"}},
+	} {
+		for alg, want := range test.want {
+			k := &Key{Secret: secrets[alg], Algorithm: alg, Digits: 8, Period: DefaultPeriod}
+			got, err := k.Code(time.Unix(test.unix, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("%s at %d: got %s, want %s", alg, test.unix, got, want)
+			}
+		}
+	}
+}
+
+func TestParseURI(t *testing.T) {
+	k, err := ParseURI("otpauth://totp/ACME%20Co:alice@example.com?secret=JBSWY3DPEHPK3PXP" +
+		"&issuer=ACME&algorithm=sha256&digits=8&period=60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(k.Secret) != "Hello!\xde\xad\xbe\xef" || k.Issuer != "ACME" || k.Account != "alice@example.com" ||
+		k.Algorithm != SHA256 || k.Digits != 8 || k.Period != time.Minute {
+		t.Errorf("unexpected key %+v", k)
+	}
+	if k.Name() != "ACME (alice@example.com)" {
+		t.Errorf("name %q", k.Name())
+	}
+	if again, err := ParseURI(k.URI()); err != nil || again.URI() != k.URI() {
+		t.Errorf("uri %q parsed to %+v, %v", k.URI(), again, err)
+	}
+
+	k, err = ParseURI("otpauth://totp/Example:bob?secret=jbsw-y3dp-ehpk-3pxp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Issuer != "Example" || k.Algorithm != SHA1 || k.Digits != DefaultDigits || k.Period != DefaultPeriod {
+		t.Errorf("defaults not applied: %+v", k)
+	}
+
+	for _, uri := range []string{
+		"otpauth://totp/alice",
+		"otpauth://totp/alice?secret=",
+		"otpauth://totp/alice?secret=JBSWY3DP!HPK3PXP",
+		"otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=5",
+		"otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=9",
+		"otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=six",
+		"otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&period=0",
+		"otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&period=-30",
+		"otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&algorithm=MD5",
+		"otpauth://hotp/alice?secret=JBSWY3DPEHPK3PXP&counter=1",
+		"https://totp/alice?secret=JBSWY3DPEHPK3PXP",
+	} {
+		if k, err := ParseURI(uri); err == nil {
+			t.Errorf("%s parsed to %+v", uri, k)
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	k, err := ParseKey(" jbswy3dpehpk3pxp ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(k.Secret) != "Hello!\xde\xad\xbe\xef" || k.Digits != DefaultDigits || k.Period != DefaultPeriod {
+		t.Errorf("unexpected key %+v", k)
+	}
+	if _, err := ParseKey("not base32!"); err == nil {
+		t.Error("invalid secret parsed")
+	}
+}
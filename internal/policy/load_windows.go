@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	policyKey  = `Software\Policies\SnixConnect`
+	policyFile = `SnixConnect\policy.json`
+)
+
+// Load reads the policy file in ProgramData and the policy registry key
+// of the machine, the registry wins over the file. The parts which could
+// be read are returned along with an error.
+func Load() (*Policy, error) {
+	p := new(Policy)
+	var errs []string
+	if file, err := loadFile(); err != nil {
+		errs = append(errs, err.Error())
+	} else if file != nil {
+		p.merge(file)
+	}
+	if reg, err := loadRegistry(); err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		p.merge(reg)
+	}
+	if len(errs) > 0 {
+		return p, fmt.Errorf("error: loading policy: %s", strings.Join(errs, ", "))
+	}
+	return p, nil
+}
+
+func loadFile() (*Policy, error) {
+	dir, err := windows.KnownFolderPath(windows.FOLDERID_ProgramData, 0)
+	if err != nil {
+		return nil, fmt.Errorf("KnownFolderPath: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, policyFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", policyFile, err)
+	}
+	return p, nil
+}
+
+// loadRegistry reads AllowedServers as a multi string or a comma
+// separated string, Profiles as json and the values of the Settings
+// subkey by the option they force.
+func loadRegistry() (*Policy, error) {
+	p := new(Policy)
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, policyKey, registry.READ)
+	if err == registry.ErrNotExist {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+
+	servers, _, err := k.GetStringsValue("AllowedServers")
+	if err == registry.ErrUnexpectedType {
+		var s string
+		if s, _, err = k.GetStringValue("AllowedServers"); err == nil {
+			servers = strings.Split(s, ",")
+		}
+	}
+	if err != nil && err != registry.ErrNotExist {
+		return nil, fmt.Errorf("AllowedServers: %v", err)
+	}
+	for _, s := range servers {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			p.AllowedServers = append(p.AllowedServers, s)
+		}
+	}
+
+	profiles, _, err := k.GetStringValue("Profiles")
+	if err == nil {
+		if err = json.Unmarshal([]byte(profiles), &p.Profiles); err == nil {
+			err = p.validate()
+		}
+	}
+	if err != nil && err != registry.ErrNotExist {
+		return nil, fmt.Errorf("Profiles: %v", err)
+	}
+
+	settings, err := registry.OpenKey(k, "Settings", registry.READ)
+	if err == registry.ErrNotExist {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer settings.Close()
+	names, err := settings.ReadValueNames(0)
+	if err != nil {
+		return nil, err
+	}
+	p.Settings = make(map[string]json.RawMessage, len(names))
+	for _, name := range names {
+		value, err := registryValue(settings, name)
+		if err != nil {
+			return nil, fmt.Errorf("Settings\\%s: %v", name, err)
+		}
+		p.Settings[name] = value
+	}
+	return p, nil
+}
+
+// registryValue returns a dword or qword as a json number and a string
+// as it is when it is json, quoted otherwise.
+func registryValue(k registry.Key, name string) (json.RawMessage, error) {
+	_, valtype, err := k.GetValue(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch valtype {
+	case registry.DWORD, registry.QWORD:
+		n, _, err := k.GetIntegerValue(name)
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(strconv.FormatUint(n, 10)), nil
+	case registry.SZ, registry.EXPAND_SZ:
+		s, _, err := k.GetStringValue(name)
+		if err != nil {
+			return nil, err
+		}
+		if json.Valid([]byte(s)) {
+			return json.RawMessage(s), nil
+		}
+		return json.Marshal(s)
+	}
+	return nil, fmt.Errorf("unsupported registry value type %d", valtype)
+}
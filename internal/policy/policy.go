@@ -0,0 +1,171 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"snixconnect/internal/bundle"
+)
+
+// Policy is set by an administrator for every user of the machine and
+// wins over what the users set themselves.
+type Policy struct {
+	// Settings force options of the user config, keyed by the name of
+	// the option. Forbidding an option is forcing it off.
+	Settings map[string]json.RawMessage
+
+	// AllowedServers are the hosts which can be connected to, *.example.com
+	// allows the subdomains of example.com. Empty allows any server.
+	AllowedServers []string
+
+	// Profiles are added to the profiles of every user, they can't be
+	// changed or removed by the user.
+	Profiles []bundle.Profile
+}
+
+func (p *Policy) IsZero() bool {
+	return len(p.Settings) == 0 && len(p.AllowedServers) == 0 && len(p.Profiles) == 0
+}
+
+// Parse decodes a policy file.
+func Parse(data []byte) (*Policy, error) {
+	p := new(Policy)
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(p); err != nil {
+		return nil, err
+	}
+	return p, p.validate()
+}
+
+func (p *Policy) validate() error {
+	if len(p.Profiles) == 0 {
+		return nil
+	}
+	b := bundle.Bundle{Profiles: p.Profiles}
+	return b.Validate()
+}
+
+// Locked reports whether setting is forced by the policy.
+func (p *Policy) Locked(setting string) bool {
+	for name := range p.Settings {
+		if strings.EqualFold(name, setting) {
+			return true
+		}
+	}
+	return false
+}
+
+// Profile returns the profile of the policy named name.
+func (p *Policy) Profile(name string) (bundle.Profile, bool) {
+	for _, profile := range p.Profiles {
+		if strings.EqualFold(profile.Name, name) {
+			return profile, true
+		}
+	}
+	return bundle.Profile{}, false
+}
+
+// AllowsServer reports whether host can be connected to.
+func (p *Policy) AllowsServer(host string) bool {
+	if len(p.AllowedServers) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range p.AllowedServers {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if suffix := strings.TrimPrefix(allowed, "*"); suffix != allowed {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+			continue
+		}
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply sets the forced settings on config, a pointer to the settings
+// struct of the user. A setting which is unknown or doesn't decode is
+// an error, the other settings are applied still.
+func (p *Policy) Apply(config interface{}) error {
+	names := make([]string, 0, len(p.Settings))
+	for name := range p.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []string
+	for _, name := range names {
+		if err := applySetting(config, name, p.Settings[name]); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error: applying policy settings: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func applySetting(config interface{}, name string, value json.RawMessage) error {
+	err := decodeSetting(config, name, value)
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+	// registry values carry booleans as dwords and strings without quotes
+	switch string(value) {
+	case "0":
+		value = json.RawMessage("false")
+	case "1":
+		value = json.RawMessage("true")
+	default:
+		if value, err = json.Marshal(string(value)); err != nil {
+			return err
+		}
+	}
+	return decodeSetting(config, name, value)
+}
+
+func decodeSetting(config interface{}, name string, value json.RawMessage) error {
+	data, err := json.Marshal(map[string]json.RawMessage{name: value})
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	return d.Decode(config)
+}
+
+// merge adds the settings and profiles of other to p, other wins where
+// both set the same.
+func (p *Policy) merge(other *Policy) {
+	if len(other.Settings) > 0 && p.Settings == nil {
+		p.Settings = make(map[string]json.RawMessage)
+	}
+	for name, value := range other.Settings {
+		for existing := range p.Settings {
+			if strings.EqualFold(existing, name) {
+				delete(p.Settings, existing)
+			}
+		}
+		p.Settings[name] = value
+	}
+	if len(other.AllowedServers) > 0 {
+		p.AllowedServers = other.AllowedServers
+	}
+	for _, profile := range other.Profiles {
+		kept := p.Profiles[:0]
+		for _, existing := range p.Profiles {
+			if !strings.EqualFold(existing.Name, profile.Name) {
+				kept = append(kept, existing)
+			}
+		}
+		p.Profiles = append(kept, profile)
+	}
+}
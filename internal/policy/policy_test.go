@@ -0,0 +1,91 @@
+package policy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type testSettings struct {
+	KillSwitch   bool
+	AutoConnect  bool
+	Profile      string
+	ReconnectMax int
+}
+
+func TestApply(t *testing.T) {
+	p := Policy{Settings: map[string]json.RawMessage{
+		"KillSwitch":   json.RawMessage("1"),
+		"AutoConnect":  json.RawMessage("false"),
+		"Profile":      json.RawMessage("2024"),
+		"ReconnectMax": json.RawMessage("5"),
+	}}
+	config := testSettings{AutoConnect: true, Profile: "Office"}
+	if err := p.Apply(&config); err != nil {
+		t.Fatal(err)
+	}
+	want := testSettings{KillSwitch: true, Profile: "2024", ReconnectMax: 5}
+	if config != want {
+		t.Errorf("got %+v, want %+v", config, want)
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	p := Policy{Settings: map[string]json.RawMessage{
+		"Unknown":      json.RawMessage("true"),
+		"ReconnectMax": json.RawMessage(`"many"`),
+		"KillSwitch":   json.RawMessage("true"),
+	}}
+	var config testSettings
+	err := p.Apply(&config)
+	if err == nil {
+		t.Fatal("invalid settings applied")
+	}
+	if msg := err.Error(); !strings.Contains(msg, "ReconnectMax: ") || !strings.Contains(msg, "Unknown: ") {
+		t.Errorf("error %q doesn't name the invalid settings", msg)
+	}
+	if !config.KillSwitch || config.ReconnectMax != 0 {
+		t.Errorf("got %+v, want only the valid setting applied", config)
+	}
+}
+
+func TestAllowsServer(t *testing.T) {
+	var open Policy
+	if !open.AllowsServer("vpn.example.org") {
+		t.Error("empty allow list refuses a server")
+	}
+
+	p := Policy{AllowedServers: []string{"vpn.example.com", " *.corp.example.com "}}
+	for host, want := range map[string]bool{
+		"vpn.example.com":         true,
+		"VPN.Example.com.":        true,
+		"eu.corp.example.com":     true,
+		"a.eu.corp.example.com":   true,
+		"corp.example.com":        false,
+		"evilcorp.example.com":    false,
+		"vpn.example.com.evil.io": false,
+		"example.com":             false,
+		"":                        false,
+	} {
+		if got := p.AllowsServer(host); got != want {
+			t.Errorf("AllowsServer(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	p := Policy{Settings: map[string]json.RawMessage{"killswitch": json.RawMessage("false")}}
+	p.merge(&Policy{
+		Settings:       map[string]json.RawMessage{"KillSwitch": json.RawMessage("true")},
+		AllowedServers: []string{"vpn.example.com"},
+	})
+	if len(p.Settings) != 1 || string(p.Settings["KillSwitch"]) != "true" {
+		t.Errorf("merged settings %s", p.Settings)
+	}
+	if !p.Locked("killSWITCH") || p.Locked("AutoConnect") {
+		t.Error("locked settings don't match the merged policy")
+	}
+	if p.AllowsServer("other.example.com") {
+		t.Error("allow list not merged")
+	}
+}
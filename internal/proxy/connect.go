@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+var errNoCredentials = errors.New("proxy requires authentication, set username and password in settings")
+
+// httpConnect asks the proxy to connect to addr, the returned reader
+// holds data read after the response and must be used for reading.
+func httpConnect(conn net.Conn, addr string, user *url.Userinfo) (*bufio.Reader, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user != nil {
+		password, _ := user.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired && user == nil:
+		return nil, errNoCredentials
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		return nil, errors.New("proxy authentication failed")
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("connect to %s refused: %s", addr, resp.Status)
+	}
+	return r, nil
+}
+
+const (
+	socksVersion      = 5
+	socksAuthNone     = 0
+	socksAuthPassword = 2
+	socksNoAcceptable = 0xff
+	socksCmdConnect   = 1
+	socksAtypIPv4     = 1
+	socksAtypDomain   = 3
+	socksAtypIPv6     = 4
+)
+
+var socksReplies = []string{
+	1: "general socks server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "ttl expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5Connect runs the rfc 1928 connect command, the host name is
+// resolved by the proxy. Username and password follow rfc 1929.
+func socks5Connect(conn net.Conn, addr string, user *url.Userinfo) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	methods := []byte{socksAuthNone}
+	if user != nil {
+		methods = append(methods, socksAuthPassword)
+	}
+	greeting := append([]byte{socksVersion, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return errors.New("proxy is not a socks5 server")
+	}
+
+	switch reply[1] {
+	case socksAuthNone:
+	case socksAuthPassword:
+		if user == nil {
+			return errNoCredentials
+		}
+		password, _ := user.Password()
+		if len(user.Username()) > 255 || len(password) > 255 {
+			return errors.New("socks username or password is too long")
+		}
+		auth := []byte{1, byte(len(user.Username()))}
+		auth = append(auth, user.Username()...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("proxy authentication failed")
+		}
+	case socksNoAcceptable:
+		if user == nil {
+			return errNoCredentials
+		}
+		return errors.New("proxy accepts none of the offered authentication methods")
+	default:
+		return fmt.Errorf("proxy selected unsupported authentication method %d", reply[1])
+	}
+
+	req := []byte{socksVersion, socksCmdConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("host name is too long")
+		}
+		req = append(req, socksAtypDomain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socksAtypIPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, socksAtypIPv6)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		msg := fmt.Sprintf("unknown error %d", head[1])
+		if int(head[1]) < len(socksReplies) {
+			msg = socksReplies[head[1]]
+		}
+		return fmt.Errorf("connect to %s refused: %s", addr, msg)
+	}
+
+	var skip int
+	switch head[3] {
+	case socksAtypIPv4:
+		skip = net.IPv4len
+	case socksAtypIPv6:
+		skip = net.IPv6len
+	case socksAtypDomain:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("unknown address type %d in socks reply", head[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
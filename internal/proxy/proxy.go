@@ -0,0 +1,280 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Mode string
+
+const (
+	ModeNone   Mode = ""
+	ModeSystem Mode = "system"
+	ModeHTTP   Mode = "http"
+	ModeSOCKS5 Mode = "socks5"
+)
+
+// Modes lists every mode in the order shown to the user.
+var Modes = []Mode{ModeNone, ModeSystem, ModeHTTP, ModeSOCKS5}
+
+func (m Mode) String() string {
+	switch m {
+	case ModeNone:
+		return "No Proxy"
+	case ModeSystem:
+		return "System (WinINet/WPAD)"
+	case ModeHTTP:
+		return "HTTP CONNECT"
+	case ModeSOCKS5:
+		return "SOCKS5"
+	}
+	return string(m)
+}
+
+const handshakeTimeout = 30 * time.Second
+
+// Config describes how the gateway is reached, Address is the host:port of
+// the proxy. In system mode Address may hold a pac file url which is used
+// instead of the windows settings, Username and Password are optional.
+type Config struct {
+	Mode     Mode
+	Address  string
+	Username string
+	Password string
+}
+
+func (c *Config) Validate() error {
+	switch c.Mode {
+	case ModeNone:
+		return nil
+	case ModeSystem:
+		if len(c.Address) == 0 {
+			return nil
+		}
+		u, err := url.Parse(c.Address)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "file") {
+			return fmt.Errorf("invalid pac file url %q", c.Address)
+		}
+		return nil
+	case ModeHTTP, ModeSOCKS5:
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return fmt.Errorf("invalid proxy address %q, use host:port", c.Address)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown proxy mode %q", string(c.Mode))
+}
+
+type Logger interface {
+	Printf(string, ...any)
+}
+
+// Conn is a connection relayed by Proxy, the remote address is the
+// one of the proxy and not of the destination.
+type Conn struct {
+	net.Conn
+	Proxy *url.URL
+	r     *bufio.Reader
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if c.r != nil {
+		return c.r.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Dialer opens tcp connections through the configured proxy, in system
+// mode the proxy is chosen per destination and remembered for the
+// lifetime of the dialer.
+type Dialer struct {
+	Config Config
+	Logger Logger
+
+	// Direct opens the connection to the proxy or the
+	// destination, it defaults to net.Dialer.
+	Direct DialFunc
+
+	mutex   sync.Mutex
+	proxies map[string]*url.URL
+}
+
+func NewDialer(config Config, logger Logger) *Dialer {
+	return &Dialer{Config: config, Logger: logger}
+}
+
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dial := d.Direct
+	if dial == nil {
+		dial = new(net.Dialer).DialContext
+	}
+
+	p, err := d.proxyFor(addr)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return dial(ctx, network, addr)
+	}
+
+	conn, err := dial(ctx, "tcp", p.Host)
+	if err != nil {
+		return nil, fmt.Errorf("can not connect to proxy %s: %v", p.Host, err)
+	}
+
+	deadline := time.Now().Add(handshakeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	tunnel := &Conn{Conn: conn, Proxy: p}
+	if p.Scheme == "socks5" {
+		err = socks5Connect(conn, addr, p.User)
+	} else {
+		tunnel.r, err = httpConnect(conn, addr, p.User)
+	}
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("proxy %s: %v", p.Host, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+// proxyFor returns the proxy for addr or nil for a direct connection.
+func (d *Dialer) proxyFor(addr string) (*url.URL, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if p, ok := d.proxies[host]; ok {
+		return p, nil
+	}
+
+	var p *url.URL
+	switch d.Config.Mode {
+	case ModeNone:
+	case ModeHTTP, ModeSOCKS5:
+		p = &url.URL{Scheme: string(d.Config.Mode), Host: d.Config.Address}
+	case ModeSystem:
+		target := &url.URL{Scheme: "https", Host: addr, Path: "/"}
+		if p, err = systemProxy(target, d.Config.Address); err != nil {
+			return nil, fmt.Errorf("can not find system proxy for %s: %v", host, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown proxy mode %q", string(d.Config.Mode))
+	}
+
+	if p != nil && len(d.Config.Username) > 0 {
+		p.User = url.UserPassword(d.Config.Username, d.Config.Password)
+	}
+	if d.Logger != nil {
+		if p == nil {
+			d.Logger.Printf("connecting to %s without proxy", host)
+		} else {
+			d.Logger.Printf("connecting to %s through %s proxy %s", host, p.Scheme, p.Host)
+		}
+	}
+	if d.proxies == nil {
+		d.proxies = make(map[string]*url.URL)
+	}
+	d.proxies[host] = p
+	return p, nil
+}
+
+// parseProxyList picks a proxy from a windows proxy string such as
+// "proxy:8080" or "http=proxy:80;https=proxy:443;socks=proxy:1080",
+// an empty list or DIRECT means no proxy.
+func parseProxyList(list string) (*url.URL, error) {
+	var plain, socks string
+	for _, entry := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ';' || r == ' ' || r == '\t'
+	}) {
+		scheme, addr, ok := strings.Cut(entry, "=")
+		if !ok {
+			addr, scheme = entry, ""
+		}
+		if strings.EqualFold(addr, "DIRECT") {
+			continue
+		}
+		addr = strings.TrimPrefix(strings.TrimPrefix(addr, "http://"), "https://")
+		switch strings.ToLower(scheme) {
+		case "https":
+			return &url.URL{Scheme: "http", Host: addr}, nil
+		case "":
+			if len(plain) == 0 {
+				plain = addr
+			}
+		case "socks":
+			socks = addr
+		}
+	}
+	switch {
+	case len(plain) > 0:
+		return &url.URL{Scheme: "http", Host: plain}, nil
+	case len(socks) > 0:
+		return &url.URL{Scheme: "socks5", Host: socks}, nil
+	}
+	return nil, nil
+}
+
+// bypassed reports whether host matches the windows bypass list,
+// <local> matches every name without a dot.
+func bypassed(host, list string) bool {
+	for _, pattern := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ';' || r == ' ' || r == ','
+	}) {
+		pattern = strings.ToLower(pattern)
+		if pattern == "<local>" {
+			if !strings.Contains(host, ".") {
+				return true
+			}
+			continue
+		}
+		if matchWildcard(pattern, strings.ToLower(host)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchWildcard(pattern, s string) bool {
+	head, tail, ok := strings.Cut(pattern, "*")
+	if !ok {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, head) {
+		return false
+	}
+	s = s[len(head):]
+	for i := 0; i <= len(s); i++ {
+		if matchWildcard(tail, s[i:]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"errors"
+	"net/url"
+)
+
+func systemProxy(target *url.URL, pacURL string) (*url.URL, error) {
+	return nil, errors.New("system proxy settings are only available on windows")
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"errors"
+	"net/url"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	winhttpAccessTypeNoProxy  = 1
+	winhttpAutoproxyDetect    = 0x1
+	winhttpAutoproxyConfigURL = 0x2
+	winhttpDetectTypeDHCP     = 0x1
+	winhttpDetectTypeDNSA     = 0x2
+)
+
+var (
+	winhttp                               = windows.NewLazySystemDLL("winhttp.dll")
+	winHttpOpen                           = winhttp.NewProc("WinHttpOpen")
+	winHttpCloseHandle                    = winhttp.NewProc("WinHttpCloseHandle")
+	winHttpGetProxyForUrl                 = winhttp.NewProc("WinHttpGetProxyForUrl")
+	winHttpGetIEProxyConfigForCurrentUser = winhttp.NewProc("WinHttpGetIEProxyConfigForCurrentUser")
+	advapi32                              = windows.NewLazySystemDLL("advapi32.dll")
+	impersonateLoggedOnUser               = advapi32.NewProc("ImpersonateLoggedOnUser")
+	kernel32                              = windows.NewLazySystemDLL("kernel32.dll")
+	globalFree                            = kernel32.NewProc("GlobalFree")
+)
+
+// WINHTTP_CURRENT_USER_IE_PROXY_CONFIG
+type ieProxyConfig struct {
+	AutoDetect    int32
+	AutoConfigURL *uint16
+	Proxy         *uint16
+	ProxyBypass   *uint16
+}
+
+// WINHTTP_AUTOPROXY_OPTIONS
+type autoProxyOptions struct {
+	Flags           uint32
+	AutoDetectFlags uint32
+	AutoConfigURL   *uint16
+	reserved        uintptr
+	reserved2       uint32
+	AutoLogon       int32
+}
+
+// WINHTTP_PROXY_INFO
+type proxyInfo struct {
+	AccessType  uint32
+	Proxy       *uint16
+	ProxyBypass *uint16
+}
+
+func freeString(s *uint16) string {
+	if s == nil {
+		return ""
+	}
+	defer globalFree.Call(uintptr(unsafe.Pointer(s)))
+	return windows.UTF16PtrToString(s)
+}
+
+// impersonateSessionUser makes the calling thread act as the user logged on
+// to the session of the process, the gui runs as system and the proxy
+// settings belong to the user. It returns nil when not possible.
+func impersonateSessionUser() (revert func()) {
+	var session uint32
+	if windows.ProcessIdToSessionId(windows.GetCurrentProcessId(), &session) != nil {
+		return nil
+	}
+	var token windows.Token
+	if windows.WTSQueryUserToken(session, &token) != nil {
+		return nil
+	}
+	defer token.Close()
+	if r, _, _ := impersonateLoggedOnUser.Call(uintptr(token)); r == 0 {
+		return nil
+	}
+	return func() { windows.RevertToSelf() }
+}
+
+// systemProxy returns the proxy windows uses for target, the pac file of
+// pacURL, the configured one or found through wpad is evaluated first and
+// the static proxy and its bypass list are used when there is none.
+func systemProxy(target *url.URL, pacURL string) (*url.URL, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if revert := impersonateSessionUser(); revert != nil {
+		defer revert()
+	}
+
+	var (
+		ie                   ieProxyConfig
+		static, bypass, auto string
+	)
+	if len(pacURL) == 0 {
+		r, _, err := winHttpGetIEProxyConfigForCurrentUser.Call(uintptr(unsafe.Pointer(&ie)))
+		if r == 0 && !errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+			return nil, err
+		}
+		auto = freeString(ie.AutoConfigURL)
+		static = freeString(ie.Proxy)
+		bypass = freeString(ie.ProxyBypass)
+	} else {
+		auto = pacURL
+	}
+
+	if len(auto) > 0 || ie.AutoDetect != 0 {
+		list, err := proxyForURL(target, auto, ie.AutoDetect != 0)
+		if err == nil {
+			return parseProxyList(list)
+		}
+		// wpad is enabled by default and fails on most networks
+		if len(pacURL) > 0 {
+			return nil, err
+		}
+	}
+
+	if bypassed(target.Hostname(), bypass) {
+		return nil, nil
+	}
+	return parseProxyList(static)
+}
+
+// proxyForURL evaluates the pac file of autoURL or found by wpad for target.
+func proxyForURL(target *url.URL, autoURL string, detect bool) (string, error) {
+	agent, _ := windows.UTF16PtrFromString("SnixConnect")
+	session, _, err := winHttpOpen.Call(uintptr(unsafe.Pointer(agent)),
+		winhttpAccessTypeNoProxy, 0, 0, 0)
+	if session == 0 {
+		return "", err
+	}
+	defer winHttpCloseHandle.Call(session)
+
+	opts := autoProxyOptions{AutoLogon: 1}
+	if len(autoURL) > 0 {
+		opts.Flags |= winhttpAutoproxyConfigURL
+		if opts.AutoConfigURL, err = windows.UTF16PtrFromString(autoURL); err != nil {
+			return "", err
+		}
+	}
+	if detect {
+		opts.Flags |= winhttpAutoproxyDetect
+		opts.AutoDetectFlags = winhttpDetectTypeDHCP | winhttpDetectTypeDNSA
+	}
+
+	u, err := windows.UTF16PtrFromString(target.String())
+	if err != nil {
+		return "", err
+	}
+	var info proxyInfo
+	r, _, err := winHttpGetProxyForUrl.Call(session, uintptr(unsafe.Pointer(u)),
+		uintptr(unsafe.Pointer(&opts)), uintptr(unsafe.Pointer(&info)))
+	if r == 0 {
+		return "", err
+	}
+	list := freeString(info.Proxy)
+	freeString(info.ProxyBypass)
+	if info.AccessType == winhttpAccessTypeNoProxy {
+		return "", nil
+	}
+	return list, nil
+}
@@ -0,0 +1,227 @@
+package quota
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Global is the scope counting the traffic to all servers, the other
+// scopes are server addresses.
+const Global = ""
+
+// DefaultThresholds are the percents warned at when none are set.
+var DefaultThresholds = []int{80, 95}
+
+// Limits caps the traffic of a day and of a month, received and
+// transmitted bytes count alike. Zero is no limit.
+type Limits struct {
+	Daily   uint64
+	Monthly uint64
+
+	// Thresholds are the percents of a limit to warn at.
+	Thresholds []int
+
+	// Disconnect ends the connection once a limit is reached and
+	// refuses to connect until the day or month is over.
+	Disconnect bool
+}
+
+func (l Limits) IsZero() bool {
+	return l.Daily == 0 && l.Monthly == 0 && len(l.Thresholds) == 0 && !l.Disconnect
+}
+
+func (l Limits) limit(p Period) uint64 {
+	if p == Day {
+		return l.Daily
+	}
+	return l.Monthly
+}
+
+func (l Limits) thresholds() []int {
+	if len(l.Thresholds) == 0 {
+		return DefaultThresholds
+	}
+	return l.Thresholds
+}
+
+// ParseThresholds parses a comma or space separated list of percents.
+func ParseThresholds(s string) ([]int, error) {
+	var result []int
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		p, err := strconv.Atoi(strings.TrimSuffix(f, "%"))
+		if err != nil || p < 1 || p > 100 {
+			return nil, fmt.Errorf("invalid quota threshold %q, expected a percent from 1 to 100", f)
+		}
+		result = append(result, p)
+	}
+	sort.Ints(result)
+	return result, nil
+}
+
+func FormatThresholds(thresholds []int) string {
+	s := make([]string, len(thresholds))
+	for i, t := range thresholds {
+		s[i] = strconv.Itoa(t)
+	}
+	return strings.Join(s, ", ")
+}
+
+type Period int
+
+const (
+	Day Period = iota
+	Month
+)
+
+func (p Period) String() string {
+	if p == Day {
+		return "daily"
+	}
+	return "monthly"
+}
+
+func (p Period) key(t time.Time) string {
+	if p == Day {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01")
+}
+
+// Counter is the traffic of one scope in the current day and month in
+// local time, a new period starts the count over.
+type Counter struct {
+	Day        string
+	DayBytes   uint64
+	Month      string
+	MonthBytes uint64
+
+	// DayWarned and MonthWarned are the highest thresholds warned
+	// about in the period, a restart does not warn about them again.
+	DayWarned   int
+	MonthWarned int
+}
+
+func (c *Counter) roll(now time.Time) {
+	if day := Day.key(now); c.Day != day {
+		c.Day, c.DayBytes, c.DayWarned = day, 0, 0
+	}
+	if month := Month.key(now); c.Month != month {
+		c.Month, c.MonthBytes, c.MonthWarned = month, 0, 0
+	}
+}
+
+func (c *Counter) Add(now time.Time, n uint64) {
+	c.roll(now)
+	c.DayBytes += n
+	c.MonthBytes += n
+}
+
+// Used returns the bytes of the period now is in.
+func (c *Counter) Used(now time.Time, p Period) uint64 {
+	c.roll(now)
+	if p == Day {
+		return c.DayBytes
+	}
+	return c.MonthBytes
+}
+
+func (c *Counter) warned(p Period) *int {
+	if p == Day {
+		return &c.DayWarned
+	}
+	return &c.MonthWarned
+}
+
+// Check returns an alert for every period whose usage has crossed a
+// threshold not warned about yet, reaching the limit is the last one.
+func (c *Counter) Check(now time.Time, scope string, l Limits) []Alert {
+	var alerts []Alert
+	for _, p := range []Period{Day, Month} {
+		limit := l.limit(p)
+		if limit == 0 {
+			continue
+		}
+		used := c.Used(now, p)
+		percent := int(used * 100 / limit)
+		warned := c.warned(p)
+		crossed := 0
+		for _, t := range l.thresholds() {
+			if percent >= t && t > *warned {
+				crossed = t
+			}
+		}
+		if percent >= 100 && *warned < 100 {
+			crossed = 100
+		}
+		if crossed == 0 {
+			continue
+		}
+		*warned = crossed
+		alerts = append(alerts, Alert{Scope: scope, Period: p, Percent: crossed, Used: used, Limit: limit})
+	}
+	return alerts
+}
+
+// Exceeded returns the alert of the first period whose limit has been
+// reached, it does not change what has been warned about.
+func (c *Counter) Exceeded(now time.Time, scope string, l Limits) (Alert, bool) {
+	for _, p := range []Period{Day, Month} {
+		limit, used := l.limit(p), c.Used(now, p)
+		if limit > 0 && used >= limit {
+			return Alert{Scope: scope, Period: p, Percent: 100, Used: used, Limit: limit}, true
+		}
+	}
+	return Alert{}, false
+}
+
+// Usage holds the counters by scope.
+type Usage map[string]*Counter
+
+// Counter returns the counter of scope, a new one is added if there is
+// none yet.
+func (u Usage) Counter(scope string) *Counter {
+	if _, ok := u[scope]; !ok {
+		u[scope] = new(Counter)
+	}
+	return u[scope]
+}
+
+// Alert is a threshold or limit of a quota reached.
+type Alert struct {
+	Scope   string
+	Period  Period
+	Percent int
+	Used    uint64
+	Limit   uint64
+}
+
+func (a Alert) Exceeded() bool { return a.Percent >= 100 }
+
+func (a Alert) String() string {
+	scope := "all servers"
+	if a.Scope != Global {
+		scope = a.Scope
+	}
+	if a.Exceeded() {
+		return fmt.Sprintf("%s data quota of %s reached, %s used of %s",
+			a.Period, scope, FormatBytes(a.Used), FormatBytes(a.Limit))
+	}
+	return fmt.Sprintf("%d%% of the %s data quota of %s used, %s of %s",
+		a.Percent, a.Period, scope, FormatBytes(a.Used), FormatBytes(a.Limit))
+}
+
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, suffix := float64(n)/unit, 0
+	for value >= unit && suffix < 4 {
+		value /= unit
+		suffix++
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64) + string("KMGTP"[suffix]) + "B"
+}
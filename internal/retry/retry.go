@@ -0,0 +1,70 @@
+package retry
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"snixconnect/internal/backend"
+	"snixconnect/internal/tlsconf"
+)
+
+// MaxDelay caps the delay between two attempts.
+const MaxDelay = 5 * time.Minute
+
+// Policy decides whether and when a failed connection is tried again,
+// the n-th retry waits InitialDelay * Factor^(n-1) varied by Jitter.
+type Policy struct {
+	// MaxAttempts is the number of retries, zero disables reconnecting.
+	MaxAttempts  int
+	InitialDelay time.Duration
+	Factor       float64
+
+	// Jitter is the fraction, between 0 and 1, by which a
+	// delay is randomly shortened or lengthened.
+	Jitter float64
+
+	// RetryAuthFailed retries after the server refused
+	// the credentials or the session.
+	RetryAuthFailed bool
+}
+
+func DefaultPolicy() Policy {
+	return Policy{MaxAttempts: 5, InitialDelay: 2 * time.Second, Factor: 2, Jitter: 0.2}
+}
+
+// Retry reports whether attempt, counted from 1, should be made after err.
+func (p Policy) Retry(attempt int, err error) bool {
+	if err == nil || attempt > p.MaxAttempts {
+		return false
+	}
+	var changed *tlsconf.PinMismatchError
+	if errors.As(err, &changed) {
+		return false
+	}
+	switch backend.KindOf(err) {
+	case backend.ErrCanceled:
+		return false
+	case backend.ErrAuthFailed, backend.ErrRejected:
+		return p.RetryAuthFailed
+	}
+	return true
+}
+
+// Delay returns how long to wait before attempt, counted from 1.
+func (p Policy) Delay(attempt int) time.Duration {
+	factor := p.Factor
+	if factor < 1 {
+		factor = 1
+	}
+	delay := float64(p.InitialDelay) * math.Pow(factor, float64(attempt-1))
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay *= 1 + jitter*(2*rand.Float64()-1)
+	}
+	if delay > float64(MaxDelay) {
+		return MaxDelay
+	}
+	return time.Duration(delay)
+}
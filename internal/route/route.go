@@ -0,0 +1,164 @@
+package route
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Options are the split tunnel settings of a server, Include and
+// Exclude are added to the split routes the server pushed.
+type Options struct {
+	Include []netip.Prefix
+	Exclude []netip.Prefix
+
+	// LocalLAN keeps the networks of the physical adapters out of
+	// the tunnel, even when the server routes them through it.
+	LocalLAN bool
+}
+
+func (o *Options) IsZero() bool {
+	return len(o.Include) == 0 && len(o.Exclude) == 0 && !o.LocalLAN
+}
+
+// Table is the effective routing of the tunnel, Include is sent through
+// the device and Exclude keeps the route it had before the tunnel.
+type Table struct {
+	Include []netip.Prefix
+	Exclude []netip.Prefix
+}
+
+// FullTunnel is used when neither the server nor the user set include
+// routes, the two halves win over the default route of the system.
+var FullTunnel = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/1"),
+	netip.MustParsePrefix("128.0.0.0/1"),
+}
+
+// FullTunnelIPv6 is FullTunnel of an ipv6 tunnel.
+var FullTunnelIPv6 = []netip.Prefix{
+	netip.MustParsePrefix("::/1"),
+	netip.MustParsePrefix("8000::/1"),
+}
+
+// Compile merges the server routes with opts, local are the networks of the
+// physical adapters and gateway the address of the vpn server which never
+// goes through the tunnel. Include routes inside an exclude route and
+// exclude routes outside every include route are dropped. Each address
+// family without include routes goes through the tunnel as a whole, ipv6
+// routes are only used when the tunnel has an ipv6 address.
+func Compile(opts Options, server Table, local []netip.Prefix, gateway netip.Addr, ipv6 bool) Table {
+	var include, include6 []netip.Prefix
+	for _, p := range merge(server.Include, opts.Include) {
+		if p.Addr().Is4() {
+			include = append(include, p)
+		} else if ipv6 {
+			include6 = append(include6, p)
+		}
+	}
+	if len(include) == 0 {
+		include = append(include, FullTunnel...)
+	}
+	if ipv6 && len(include6) == 0 {
+		include6 = append(include6, FullTunnelIPv6...)
+	}
+	include = append(include, include6...)
+	exclude := merge(server.Exclude, opts.Exclude)
+	if opts.LocalLAN {
+		exclude = merge(exclude, local)
+	}
+	if gateway.IsValid() {
+		gateway = gateway.Unmap()
+		exclude = merge(exclude, []netip.Prefix{netip.PrefixFrom(gateway, gateway.BitLen())})
+	}
+
+	var table Table
+	for _, p := range include {
+		if !covered(p, exclude) {
+			table.Include = append(table.Include, p)
+		}
+	}
+	for _, p := range exclude {
+		if overlaps(p, table.Include) {
+			table.Exclude = append(table.Exclude, p)
+		}
+	}
+	return table
+}
+
+// ParsePrefixes parses a list of cidr prefixes or single addresses
+// separated by commas, semicolons or white space.
+func ParsePrefixes(s string) ([]netip.Prefix, error) {
+	var result []netip.Prefix
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\r' || r == '\n'
+	}) {
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid route %q, use address/bits", field)
+			}
+			result = append(result, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %q, use address/bits", field)
+		}
+		result = append(result, p.Masked())
+	}
+	return result, nil
+}
+
+func Strings(prefixes []netip.Prefix) []string {
+	result := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		result[i] = p.String()
+	}
+	return result
+}
+
+// merge returns the masked prefixes of all lists sorted and without duplicates.
+func merge(lists ...[]netip.Prefix) []netip.Prefix {
+	var result []netip.Prefix
+	for _, list := range lists {
+		for _, p := range list {
+			if p.IsValid() {
+				result = append(result, p.Masked())
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if c := result[i].Addr().Compare(result[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return result[i].Bits() < result[j].Bits()
+	})
+	unique := result[:0]
+	for i, p := range result {
+		if i == 0 || p != result[i-1] {
+			unique = append(unique, p)
+		}
+	}
+	return unique
+}
+
+// covered reports whether p lies inside one of list.
+func covered(p netip.Prefix, list []netip.Prefix) bool {
+	for _, q := range list {
+		if q.Bits() <= p.Bits() && q.Contains(p.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(p netip.Prefix, list []netip.Prefix) bool {
+	for _, q := range list {
+		if p.Overlaps(q) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package route
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+)
+
+func prefixes(s ...string) []netip.Prefix {
+	var result []netip.Prefix
+	for _, p := range s {
+		result = append(result, netip.MustParsePrefix(p))
+	}
+	return result
+}
+
+func TestCompile(t *testing.T) {
+	gateway := netip.MustParseAddr("203.0.113.1")
+	for _, test := range []struct {
+		name    string
+		opts    Options
+		server  Table
+		local   []netip.Prefix
+		gateway netip.Addr
+		ipv6    bool
+		include string
+		exclude string
+	}{{
+		name:    "full tunnel",
+		include: "[0.0.0.0/1 128.0.0.0/1]",
+		exclude: "[]",
+	}, {
+		name:    "full tunnel ipv6",
+		ipv6:    true,
+		include: "[0.0.0.0/1 128.0.0.0/1 ::/1 8000::/1]",
+		exclude: "[]",
+	}, {
+		name:    "server and user include routes",
+		opts:    Options{Include: prefixes("10.30.0.0/16", "10.20.1.0/24")},
+		server:  Table{Include: prefixes("10.20.0.0/16", "2001:db8::/32")},
+		include: "[10.20.0.0/16 10.20.1.0/24 10.30.0.0/16]",
+		exclude: "[]",
+	}, {
+		name:    "include inside an exclude route",
+		opts:    Options{Exclude: prefixes("10.20.0.0/16")},
+		server:  Table{Include: prefixes("10.0.0.0/8", "10.20.5.0/24")},
+		include: "[10.0.0.0/8]",
+		exclude: "[10.20.0.0/16]",
+	}, {
+		name:    "exclude outside every include route",
+		server:  Table{Include: prefixes("10.0.0.0/8"), Exclude: prefixes("192.168.0.0/16", "10.1.2.3/32")},
+		include: "[10.0.0.0/8]",
+		exclude: "[10.1.2.3/32]",
+	}, {
+		name:    "local lan",
+		opts:    Options{LocalLAN: true},
+		local:   prefixes("192.168.1.0/24", "fe80::/64"),
+		include: "[0.0.0.0/1 128.0.0.0/1]",
+		exclude: "[192.168.1.0/24]",
+	}, {
+		name:    "local lan off",
+		local:   prefixes("192.168.1.0/24"),
+		include: "[0.0.0.0/1 128.0.0.0/1]",
+		exclude: "[]",
+	}, {
+		name:    "gateway excluded",
+		gateway: gateway,
+		include: "[0.0.0.0/1 128.0.0.0/1]",
+		exclude: "[203.0.113.1/32]",
+	}, {
+		name:    "gateway outside the split routes",
+		server:  Table{Include: prefixes("10.0.0.0/8")},
+		gateway: gateway,
+		include: "[10.0.0.0/8]",
+		exclude: "[]",
+	}, {
+		name:    "ipv4 mapped gateway",
+		gateway: netip.MustParseAddr("::ffff:203.0.113.1"),
+		include: "[0.0.0.0/1 128.0.0.0/1]",
+		exclude: "[203.0.113.1/32]",
+	}} {
+		table := Compile(test.opts, test.server, test.local, test.gateway, test.ipv6)
+		if include := fmt.Sprint(table.Include); include != test.include {
+			t.Errorf("%s: include %s, want %s", test.name, include, test.include)
+		}
+		if exclude := fmt.Sprint(table.Exclude); exclude != test.exclude {
+			t.Errorf("%s: exclude %s, want %s", test.name, exclude, test.exclude)
+		}
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := ParsePrefixes("10.1.2.3/16, 192.0.2.7;2001:db8::1/32\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[10.1.0.0/16 192.0.2.7/32 2001:db8::/32]" {
+		t.Errorf("got %v", got)
+	}
+	for _, s := range []string{"10.0.0.0/33", "example.com", "10.0.0.0/8,bad"} {
+		if _, err := ParsePrefixes(s); err == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Versions are the minimum tls versions which can be configured.
+var Versions = []string{"1.2", "1.3"}
+
+// Options are the tls settings of a single server, the zero
+// value keeps the defaults of crypto/tls and the system roots.
+type Options struct {
+	// CABundle holds pem certificates trusted for the server
+	// in addition to the system roots.
+	CABundle string
+
+	MinVersion      string
+	CipherSuites    []string
+	ServerName      string
+	CheckRevocation bool
+}
+
+func ParseVersion(s string) (uint16, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+	v, ok := versions[strings.TrimPrefix(strings.ToUpper(s), "TLS ")]
+	if !ok {
+		return 0, fmt.Errorf("unsupported minimum tls version %q", s)
+	}
+	return v, nil
+}
+
+// ParseCipherSuites returns the ids of the named tls 1.2 suites,
+// only suites without known security issues are accepted.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	var ids []uint16
+next:
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		for _, s := range tls.CipherSuites() {
+			if strings.EqualFold(s.Name, name) {
+				ids = append(ids, s.ID)
+				continue next
+			}
+		}
+		return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+	}
+	return ids, nil
+}
+
+// ParseCABundle returns the certificates of a pem bundle,
+// a bundle without any certificate is an error.
+func ParseCABundle(bundle string) (*x509.CertPool, int, error) {
+	pool := x509.NewCertPool()
+	rest, n := []byte(bundle), 0
+	for len(rest) > 0 {
+		block, r := pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		rest = r
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid certificate in ca bundle: %v", err)
+		}
+		pool.AddCert(cert)
+		n++
+	}
+	if n == 0 {
+		return nil, 0, errors.New("ca bundle has no pem certificate")
+	}
+	return pool, n, nil
+}
+
+func (o *Options) IsZero() bool {
+	return len(o.CABundle) == 0 && len(o.MinVersion) == 0 && len(o.CipherSuites) == 0 &&
+		len(o.ServerName) == 0 && !o.CheckRevocation
+}
+
+func (o *Options) Validate() error {
+	if _, err := ParseVersion(o.MinVersion); err != nil {
+		return err
+	}
+	if _, err := ParseCipherSuites(o.CipherSuites); err != nil {
+		return err
+	}
+	if len(o.CABundle) > 0 {
+		if _, _, err := ParseCABundle(o.CABundle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply sets the options on c and the verifier used by c.
+func (o *Options) Apply(c *tls.Config, v *Verifier) (err error) {
+	if c.MinVersion, err = ParseVersion(o.MinVersion); err != nil {
+		return err
+	}
+	if c.CipherSuites, err = ParseCipherSuites(o.CipherSuites); err != nil {
+		return err
+	}
+	if len(o.ServerName) > 0 {
+		c.ServerName = o.ServerName
+		v.SetHost(o.ServerName)
+	}
+	if len(o.CABundle) > 0 {
+		if v.ExtraRoots, _, err = ParseCABundle(o.CABundle); err != nil {
+			return err
+		}
+	}
+	v.CheckRevocation = o.CheckRevocation
+	return nil
+}
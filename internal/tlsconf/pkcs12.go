@@ -0,0 +1,90 @@
+package tlsconf
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ExpiryWarning is how long before expiry the user is warned
+// about an imported client certificate.
+const ExpiryWarning = 14 * 24 * time.Hour
+
+// LoadPKCS12 decodes a .p12/.pfx file into a client certificate,
+// passphrase may be empty for unprotected files.
+func LoadPKCS12(data []byte, passphrase string) (*tls.Certificate, error) {
+	key, leaf, chain, err := pkcs12.DecodeChain(data, passphrase)
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return nil, errors.New("incorrect passphrase for certificate file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can not decode certificate file: %v", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key in certificate file")
+	}
+	cert := &tls.Certificate{PrivateKey: signer, Leaf: leaf}
+	cert.Certificate = append(cert.Certificate, leaf.Raw)
+	for _, c := range chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return cert, nil
+}
+
+// EncodePEM returns the certificate chain and private key in pem form.
+func EncodePEM(cert *tls.Certificate) ([]byte, error) {
+	var out []byte
+	for _, der := range cert.Certificate {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})...)
+	return out, nil
+}
+
+// DecodePEM is the reverse of EncodePEM.
+func DecodePEM(data []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+type CertInfo struct {
+	Subject  string
+	Issuer   string
+	NotAfter time.Time
+}
+
+func Info(cert *tls.Certificate) CertInfo {
+	if cert.Leaf == nil {
+		return CertInfo{}
+	}
+	return CertInfo{
+		Subject:  cert.Leaf.Subject.String(),
+		Issuer:   cert.Leaf.Issuer.String(),
+		NotAfter: cert.Leaf.NotAfter,
+	}
+}
+
+func (c CertInfo) Expired(now time.Time) bool { return now.After(c.NotAfter) }
+
+// ExpiresSoon reports whether the certificate expires within ExpiryWarning.
+func (c CertInfo) ExpiresSoon(now time.Time) bool {
+	return now.Add(ExpiryWarning).After(c.NotAfter)
+}
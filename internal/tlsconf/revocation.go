@@ -0,0 +1,193 @@
+package tlsconf
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	revocationTimeout = 10 * time.Second
+	revocationMaxBody = 10 << 20
+
+	// revocationCacheTime is used when a response has no next update.
+	revocationCacheTime = time.Hour
+)
+
+// RevokedError is returned when a certificate of the server chain
+// has been revoked by its issuer.
+type RevokedError struct {
+	Subject   string
+	RevokedAt time.Time
+}
+
+func (e *RevokedError) Error() string {
+	return fmt.Sprintf("certificate %s has been revoked on %s", e.Subject,
+		e.RevokedAt.Format(time.RFC1123))
+}
+
+var errUnknownStatus = errors.New("responder doesn't know the certificate")
+
+// revocationCache holds the time until which a certificate,
+// keyed by its fingerprint, is known not to be revoked.
+type revocationCache struct {
+	mutex sync.Mutex
+	good  map[string]time.Time
+}
+
+func (c *revocationCache) valid(key string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return time.Now().Before(c.good[key])
+}
+
+func (c *revocationCache) store(key string, until time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.good == nil {
+		c.good = make(map[string]time.Time)
+	}
+	c.good[key] = until
+}
+
+var revocationClient = &http.Client{Timeout: revocationTimeout}
+
+// checkRevocation checks every certificate of a verified chain but the
+// root, the leaf status is taken from the stapled ocsp response if any.
+// Certificates without ocsp or crl information are accepted.
+func (v *Verifier) checkRevocation(chain []*x509.Certificate, staple []byte) error {
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		key := Fingerprint(cert)
+		if v.revoked.valid(key) {
+			continue
+		}
+		if i > 0 {
+			staple = nil
+		}
+		until, err := revocationStatus(cert, issuer, staple)
+		if err != nil {
+			return err
+		}
+		if !until.IsZero() {
+			v.revoked.store(key, until)
+		}
+	}
+	return nil
+}
+
+func revocationStatus(cert, issuer *x509.Certificate, staple []byte) (time.Time, error) {
+	if len(staple) > 0 {
+		until, err := ocspStatus(cert, issuer, staple)
+		if err == nil || isRevoked(err) {
+			return until, err
+		}
+	}
+
+	var errs []string
+	for _, server := range cert.OCSPServer {
+		until, err := fetchOCSP(server, cert, issuer)
+		if err == nil || isRevoked(err) {
+			return until, err
+		}
+		errs = append(errs, fmt.Sprintf("ocsp %s: %v", server, err))
+	}
+	for _, dp := range cert.CRLDistributionPoints {
+		until, err := fetchCRL(dp, cert, issuer)
+		if err == nil || isRevoked(err) {
+			return until, err
+		}
+		errs = append(errs, fmt.Sprintf("crl %s: %v", dp, err))
+	}
+	if len(errs) == 0 {
+		return time.Time{}, nil
+	}
+	return time.Time{}, fmt.Errorf("can not check revocation of certificate %s: %s",
+		cert.Subject, strings.Join(errs, ", "))
+}
+
+func isRevoked(err error) bool {
+	var revoked *RevokedError
+	return errors.As(err, &revoked)
+}
+
+func nextUpdate(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now().Add(revocationCacheTime)
+	}
+	return t
+}
+
+func ocspStatus(cert, issuer *x509.Certificate, der []byte) (time.Time, error) {
+	resp, err := ocsp.ParseResponseForCert(der, cert, issuer)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return nextUpdate(resp.NextUpdate), nil
+	case ocsp.Revoked:
+		return time.Time{}, &RevokedError{Subject: cert.Subject.String(), RevokedAt: resp.RevokedAt}
+	}
+	return time.Time{}, errUnknownStatus
+}
+
+func fetchOCSP(server string, cert, issuer *x509.Certificate) (time.Time, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := revocationClient.Post(server, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("unexpected http status %s", resp.Status)
+	}
+	der, err := io.ReadAll(io.LimitReader(resp.Body, revocationMaxBody))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ocspStatus(cert, issuer, der)
+}
+
+func fetchCRL(dp string, cert, issuer *x509.Certificate) (time.Time, error) {
+	resp, err := revocationClient.Get(dp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("unexpected http status %s", resp.Status)
+	}
+	der, err := io.ReadAll(io.LimitReader(resp.Body, revocationMaxBody))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return time.Time{}, err
+	}
+	if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+		return time.Time{}, errors.New("crl is out of date")
+	}
+	for _, rc := range crl.RevokedCertificates {
+		if rc.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return time.Time{}, &RevokedError{Subject: cert.Subject.String(), RevokedAt: rc.RevocationTime}
+		}
+	}
+	return nextUpdate(crl.NextUpdate), nil
+}
@@ -0,0 +1,200 @@
+package tlsconf
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type PinType string
+
+const (
+	PinCertificate PinType = "certificate"
+	PinPublicKey   PinType = "public-key"
+)
+
+// Pin trusts a single certificate or public key for Host, SHA256 is
+// the hex encoded digest of the certificate or its SubjectPublicKeyInfo.
+type Pin struct {
+	Host   string
+	Type   PinType
+	SHA256 string
+}
+
+func NewPin(host string, t PinType, cert *x509.Certificate) Pin {
+	pin := Pin{Host: strings.ToLower(host), Type: t, SHA256: Fingerprint(cert)}
+	if t == PinPublicKey {
+		pin.SHA256 = PublicKeyFingerprint(cert)
+	}
+	return pin
+}
+
+func (p Pin) Matches(cert *x509.Certificate) bool {
+	switch p.Type {
+	case PinCertificate:
+		return strings.EqualFold(p.SHA256, Fingerprint(cert))
+	case PinPublicKey:
+		return strings.EqualFold(p.SHA256, PublicKeyFingerprint(cert))
+	}
+	return false
+}
+
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func PublicKeyFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+// FormatFingerprint returns a hex digest as colon separated upper case pairs.
+func FormatFingerprint(s string) string {
+	s = strings.ToUpper(s)
+	pairs := make([]string, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		pairs = append(pairs, s[i:i+2])
+	}
+	return strings.Join(pairs, ":")
+}
+
+// UntrustedError is returned by the handshake when the server certificate
+// fails validation and no pin exists for the host, the user may pin it.
+type UntrustedError struct {
+	Host  string
+	Chain []*x509.Certificate
+	Err   error
+}
+
+func (e *UntrustedError) Error() string {
+	return fmt.Sprintf("certificate of %s is not trusted: %v", e.Host, e.Err)
+}
+
+func (e *UntrustedError) Unwrap() error { return e.Err }
+
+// PinMismatchError is returned when the certificate of a pinned host
+// has changed, it is never offered to the user for pinning.
+type PinMismatchError struct {
+	Host        string
+	Fingerprint string
+}
+
+func (e *PinMismatchError) Error() string {
+	return fmt.Sprintf("certificate of %s has changed and doesn't match the pinned "+
+		"certificate, the connection is refused (new fingerprint %s). If the change "+
+		"is expected forget the pinned certificate in settings",
+		e.Host, FormatFingerprint(e.Fingerprint))
+}
+
+// Verifier validates server certificates against the system roots, ExtraRoots and
+// the pins of the host, pinned hosts are checked against pins only.
+type Verifier struct {
+	SkipVerify      bool
+	ExtraRoots      *x509.CertPool
+	CheckRevocation bool
+
+	mutex   sync.RWMutex
+	host    string
+	pins    []Pin
+	revoked revocationCache
+}
+
+// NewVerifier returns a verifier for the certificates of host, a host
+// name or an ip address.
+func NewVerifier(host string, pins []Pin) *Verifier {
+	return &Verifier{host: host, pins: append([]Pin(nil), pins...)}
+}
+
+// SetHost changes the host the certificate is checked for, the server
+// name override or the host the login has been redirected to.
+func (v *Verifier) SetHost(host string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.host = host
+}
+
+// Host returns the host the certificate is checked for. The tls server
+// name can't be used, go leaves it empty when the server is an ip address.
+func (v *Verifier) Host() string {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return v.host
+}
+
+func (v *Verifier) AddPin(pin Pin) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.pins = append(v.pins, pin)
+}
+
+func (v *Verifier) hostPins(host string) []Pin {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	var pins []Pin
+	for _, p := range v.pins {
+		if strings.EqualFold(p.Host, host) {
+			pins = append(pins, p)
+		}
+	}
+	return pins
+}
+
+// Config returns a copy of base which verifies the server through v.
+func (v *Verifier) Config(base *tls.Config) *tls.Config {
+	c := new(tls.Config)
+	if base != nil {
+		c = base.Clone()
+	}
+	c.InsecureSkipVerify = true
+	c.VerifyConnection = v.VerifyConnection
+	return c
+}
+
+func (v *Verifier) VerifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server has not sent any certificate")
+	}
+	leaf := cs.PeerCertificates[0]
+	host := v.Host()
+	if len(host) == 0 {
+		return errors.New("no server host to verify the certificate for")
+	}
+
+	if pins := v.hostPins(host); len(pins) > 0 {
+		for _, p := range pins {
+			if p.Matches(leaf) {
+				return nil
+			}
+		}
+		return &PinMismatchError{Host: host, Fingerprint: Fingerprint(leaf)}
+	}
+
+	// an ip address is checked against the ip addresses of the certificate
+	opts := x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, c := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	chains, err := leaf.Verify(opts)
+	if err != nil && v.ExtraRoots != nil {
+		opts.Roots = v.ExtraRoots
+		if extra, extraErr := leaf.Verify(opts); extraErr == nil {
+			chains, err = extra, nil
+		}
+	}
+	switch {
+	case err == nil && v.CheckRevocation:
+		return v.checkRevocation(chains[0], cs.OCSPResponse)
+	case err == nil || v.SkipVerify:
+		return nil
+	}
+	return &UntrustedError{Host: host, Chain: cs.PeerCertificates, Err: err}
+}
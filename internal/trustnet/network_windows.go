@@ -0,0 +1,112 @@
+package trustnet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"net"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const ipUnicastIf = 31
+
+var (
+	iphlpapi = windows.NewLazySystemDLL("iphlpapi.dll")
+	sendARP  = iphlpapi.NewProc("SendARP")
+)
+
+// Current returns the network the machine is attached to, the adapter
+// with guid, the tunnel device, is left out.
+func Current(guid [16]byte) (*Network, error) {
+	size := uint32(15 * 1024)
+	var buf []byte
+	for {
+		buf = make([]byte, size)
+		first := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0]))
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, windows.GAA_FLAG_SKIP_ANYCAST|
+			windows.GAA_FLAG_SKIP_MULTICAST|windows.GAA_FLAG_INCLUDE_GATEWAYS, 0, first, &size)
+		if err == nil {
+			break
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW {
+			return nil, fmt.Errorf("GetAdaptersAddresses: %v", err)
+		}
+	}
+
+	tunnel := (*windows.GUID)(unsafe.Pointer(&guid)).String()
+	network := new(Network)
+	metric := ^uint32(0)
+	for a := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); a != nil; a = a.Next {
+		if a.OperStatus != windows.IfOperStatusUp || a.IfType == windows.IF_TYPE_SOFTWARE_LOOPBACK ||
+			strings.EqualFold(windows.BytePtrToString(a.AdapterName), tunnel) {
+			continue
+		}
+		if suffix := windows.UTF16PtrToString(a.DnsSuffix); len(suffix) > 0 {
+			network.DNSSuffixes = append(network.DNSSuffixes, suffix)
+		}
+		for s := a.FirstDnsSuffix; s != nil; s = s.Next {
+			if suffix := windows.UTF16ToString(s.String[:]); len(suffix) > 0 {
+				network.DNSSuffixes = append(network.DNSSuffixes, suffix)
+			}
+		}
+		if a.FirstGatewayAddress == nil {
+			continue
+		}
+		if a.Ipv4Metric < metric {
+			metric, network.Interface = a.Ipv4Metric, a.IfIndex
+		}
+		for gw := a.FirstGatewayAddress; gw != nil; gw = gw.Next {
+			if mac, ok := gatewayMAC(gw.Address.IP()); ok {
+				network.GatewayMACs = append(network.GatewayMACs, mac)
+			}
+		}
+	}
+	network.SSIDs = connectedSSIDs()
+	return network, nil
+}
+
+// gatewayMAC resolves the hardware address of an ipv4 gateway with arp.
+func gatewayMAC(ip net.IP) (string, bool) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return "", false
+	}
+	var mac [8]byte
+	size := uint32(len(mac))
+	r, _, _ := sendARP.Call(uintptr(binary.LittleEndian.Uint32(ip4)), 0,
+		uintptr(unsafe.Pointer(&mac[0])), uintptr(unsafe.Pointer(&size)))
+	if r != 0 || size != 6 {
+		return "", false
+	}
+	return net.HardwareAddr(mac[:size]).String(), true
+}
+
+// interfaceDialer returns a dialer whose connections leave through the
+// adapter with index iface, whatever the routes of the tunnel say.
+func interfaceDialer(iface uint32) *net.Dialer {
+	dialer := &net.Dialer{Timeout: probeTimeout}
+	if iface == 0 {
+		return dialer
+	}
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		var err error
+		cerr := c.Control(func(fd uintptr) {
+			if strings.HasSuffix(network, "6") {
+				err = windows.SetsockoptInt(windows.Handle(fd), windows.IPPROTO_IPV6, ipUnicastIf, int(iface))
+				return
+			}
+			// the ipv4 option takes the index in network byte order
+			err = windows.SetsockoptInt(windows.Handle(fd), windows.IPPROTO_IP, ipUnicastIf,
+				int(bits.ReverseBytes32(iface)))
+		})
+		if cerr != nil {
+			return cerr
+		}
+		return err
+	}
+	return dialer
+}
@@ -0,0 +1,256 @@
+package trustnet
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Kind string
+
+const (
+	KindDNSSuffix  Kind = "dns-suffix"
+	KindSSID       Kind = "ssid"
+	KindGatewayMAC Kind = "gateway-mac"
+	KindProbe      Kind = "probe"
+)
+
+// Rule classifies the network as trusted or untrusted when
+// it matches, Value is compared according to Kind.
+type Rule struct {
+	Trusted bool
+	Kind    Kind
+	Value   string
+}
+
+func (r Rule) String() string {
+	trust := "untrusted"
+	if r.Trusted {
+		trust = "trusted"
+	}
+	return fmt.Sprintf("%s %s %s", trust, r.Kind, r.Value)
+}
+
+type Action string
+
+const (
+	ActionNone       Action = ""
+	ActionConnect    Action = "connect"
+	ActionDisconnect Action = "disconnect"
+)
+
+// Actions lists every action in the order shown to the user.
+var Actions = []Action{ActionNone, ActionConnect, ActionDisconnect}
+
+func (a Action) String() string {
+	switch a {
+	case ActionNone:
+		return "Stay Idle"
+	case ActionConnect:
+		return "Connect"
+	case ActionDisconnect:
+		return "Disconnect"
+	}
+	return string(a)
+}
+
+// Options are the trusted network detection settings, the first
+// matching rule classifies the network and selects the action.
+type Options struct {
+	Rules     []Rule
+	Trusted   Action
+	Untrusted Action
+}
+
+func (o *Options) IsZero() bool {
+	return len(o.Rules) == 0 && o.Trusted == ActionNone && o.Untrusted == ActionNone
+}
+
+// Action returns the action for verdict.
+func (o *Options) Action(verdict Verdict) Action {
+	switch verdict {
+	case Trusted:
+		return o.Trusted
+	case Untrusted:
+		return o.Untrusted
+	}
+	return ActionNone
+}
+
+type Verdict int
+
+const (
+	Unknown Verdict = iota
+	Trusted
+	Untrusted
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Trusted:
+		return "trusted"
+	case Untrusted:
+		return "untrusted"
+	}
+	return "unknown"
+}
+
+// Network describes the physical networks the machine is attached
+// to, the adapter of the tunnel is left out.
+type Network struct {
+	DNSSuffixes []string
+	SSIDs       []string
+	GatewayMACs []string
+
+	// Interface is the index of the adapter with the default
+	// route, probes are sent through it.
+	Interface uint32
+}
+
+// String returns a stable summary of n, a changed summary
+// means the machine has moved to another network.
+func (n *Network) String() string {
+	list := func(s []string) string {
+		s = append([]string(nil), s...)
+		sort.Strings(s)
+		return strings.Join(s, ",")
+	}
+	return fmt.Sprintf("dns suffixes [%s] ssids [%s] gateway macs [%s]",
+		list(n.DNSSuffixes), list(n.SSIDs), list(n.GatewayMACs))
+}
+
+// ParseRules parses one rule per line in the form "trusted|untrusted
+// kind value", empty lines and lines starting with # are skipped.
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid rule %q, use trusted|untrusted kind value", line)
+		}
+		var rule Rule
+		switch strings.ToLower(fields[0]) {
+		case "trusted":
+			rule.Trusted = true
+		case "untrusted":
+		default:
+			return nil, fmt.Errorf("invalid rule %q, it must start with trusted or untrusted", line)
+		}
+		rule.Kind = Kind(strings.ToLower(fields[1]))
+		// ssids may contain spaces
+		value := strings.TrimSpace(line[len(fields[0]):])
+		value = strings.TrimSpace(value[len(fields[1]):])
+		switch rule.Kind {
+		case KindDNSSuffix:
+			rule.Value = strings.ToLower(strings.Trim(value, "."))
+		case KindSSID:
+			rule.Value = value
+		case KindGatewayMAC:
+			mac, err := net.ParseMAC(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid gateway mac address %q", value)
+			}
+			rule.Value = mac.String()
+		case KindProbe:
+			u, err := url.Parse(value)
+			if err != nil || u.Scheme != "https" || len(u.Host) == 0 {
+				return nil, fmt.Errorf("invalid probe url %q, use https://host/path", value)
+			}
+			rule.Value = u.String()
+		default:
+			return nil, fmt.Errorf("invalid rule kind %q, use %s, %s, %s or %s", fields[1],
+				KindDNSSuffix, KindSSID, KindGatewayMAC, KindProbe)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// FormatRules returns rules in the form read by ParseRules.
+func FormatRules(rules []Rule) string {
+	lines := make([]string, len(rules))
+	for i, r := range rules {
+		lines[i] = r.String()
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// Classify returns the verdict of the first rule matching n, ok is
+// false when no rule matches.
+func Classify(ctx context.Context, rules []Rule, n *Network) (verdict Verdict, rule Rule, ok bool) {
+	for _, r := range rules {
+		if r.matches(ctx, n) {
+			if r.Trusted {
+				return Trusted, r, true
+			}
+			return Untrusted, r, true
+		}
+	}
+	return Unknown, Rule{}, false
+}
+
+func (r Rule) matches(ctx context.Context, n *Network) bool {
+	switch r.Kind {
+	case KindDNSSuffix:
+		for _, s := range n.DNSSuffixes {
+			if strings.EqualFold(strings.Trim(s, "."), r.Value) {
+				return true
+			}
+		}
+	case KindSSID:
+		for _, s := range n.SSIDs {
+			if s == r.Value {
+				return true
+			}
+		}
+	case KindGatewayMAC:
+		for _, mac := range n.GatewayMACs {
+			if strings.EqualFold(mac, r.Value) {
+				return true
+			}
+		}
+	case KindProbe:
+		return Probe(ctx, r.Value, n.Interface) == nil
+	}
+	return false
+}
+
+const probeTimeout = 5 * time.Second
+
+// Probe reports whether the https url answers with a certificate trusted
+// by the system, any status code counts. The request goes out through
+// the adapter with index iface, not through the tunnel.
+func Probe(ctx context.Context, rawURL string, iface uint32) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:       interfaceDialer(iface).DialContext,
+			TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS12},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,91 @@
+package trustnet
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	wlanClientVersion          = 2
+	wlanInterfaceConnected     = 1
+	wlanOpcodeCurrentConnected = 7
+)
+
+var (
+	wlanapi            = windows.NewLazySystemDLL("wlanapi.dll")
+	wlanOpenHandle     = wlanapi.NewProc("WlanOpenHandle")
+	wlanCloseHandle    = wlanapi.NewProc("WlanCloseHandle")
+	wlanEnumInterfaces = wlanapi.NewProc("WlanEnumInterfaces")
+	wlanQueryInterface = wlanapi.NewProc("WlanQueryInterface")
+	wlanFreeMemory     = wlanapi.NewProc("WlanFreeMemory")
+)
+
+// wlanInterfaceInfo mirrors WLAN_INTERFACE_INFO.
+type wlanInterfaceInfo struct {
+	InterfaceGUID windows.GUID
+	Description   [256]uint16
+	State         uint32
+}
+
+// wlanInterfaceInfoList mirrors the header of WLAN_INTERFACE_INFO_LIST.
+type wlanInterfaceInfoList struct {
+	NumberOfItems uint32
+	Index         uint32
+}
+
+// wlanConnectionAttributes mirrors WLAN_CONNECTION_ATTRIBUTES
+// up to the ssid of the association.
+type wlanConnectionAttributes struct {
+	State       uint32
+	Mode        uint32
+	ProfileName [256]uint16
+	SSIDLength  uint32
+	SSID        [32]byte
+}
+
+// connectedSSIDs returns the ssids of the connected wireless adapters,
+// nil when the wlan service is not available.
+func connectedSSIDs() []string {
+	if wlanOpenHandle.Find() != nil {
+		return nil
+	}
+	var version uint32
+	var handle windows.Handle
+	r, _, _ := wlanOpenHandle.Call(wlanClientVersion, 0,
+		uintptr(unsafe.Pointer(&version)), uintptr(unsafe.Pointer(&handle)))
+	if r != 0 {
+		return nil
+	}
+	defer wlanCloseHandle.Call(uintptr(handle), 0)
+
+	var list *wlanInterfaceInfoList
+	r, _, _ = wlanEnumInterfaces.Call(uintptr(handle), 0, uintptr(unsafe.Pointer(&list)))
+	if r != 0 {
+		return nil
+	}
+	defer wlanFreeMemory.Call(uintptr(unsafe.Pointer(list)))
+
+	first := unsafe.Add(unsafe.Pointer(list), unsafe.Sizeof(*list))
+	infos := unsafe.Slice((*wlanInterfaceInfo)(first), list.NumberOfItems)
+
+	var ssids []string
+	for i := range infos {
+		if infos[i].State != wlanInterfaceConnected {
+			continue
+		}
+		var size, valueType uint32
+		var attrs *wlanConnectionAttributes
+		r, _, _ := wlanQueryInterface.Call(uintptr(handle), uintptr(unsafe.Pointer(&infos[i].InterfaceGUID)),
+			wlanOpcodeCurrentConnected, 0, uintptr(unsafe.Pointer(&size)),
+			uintptr(unsafe.Pointer(&attrs)), uintptr(unsafe.Pointer(&valueType)))
+		if r != 0 {
+			continue
+		}
+		if n := attrs.SSIDLength; n > 0 && n <= uint32(len(attrs.SSID)) {
+			ssids = append(ssids, string(attrs.SSID[:n]))
+		}
+		wlanFreeMemory.Call(uintptr(unsafe.Pointer(attrs)))
+	}
+	return ssids
+}
@@ -0,0 +1,290 @@
+package tun
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	routeProtocolNetMgmt  = 3
+	tunnelInterfaceMetric = 5
+	ipv6MinMTU            = 1280
+)
+
+var (
+	iphlpapi                        = windows.NewLazySystemDLL("iphlpapi.dll")
+	initializeUnicastIPAddressEntry = iphlpapi.NewProc("InitializeUnicastIpAddressEntry")
+	createUnicastIPAddressEntry     = iphlpapi.NewProc("CreateUnicastIpAddressEntry")
+	deleteUnicastIPAddressEntry     = iphlpapi.NewProc("DeleteUnicastIpAddressEntry")
+	initializeIPForwardEntry        = iphlpapi.NewProc("InitializeIpForwardEntry")
+	createIPForwardEntry2           = iphlpapi.NewProc("CreateIpForwardEntry2")
+	deleteIPForwardEntry2           = iphlpapi.NewProc("DeleteIpForwardEntry2")
+	getBestRoute2                   = iphlpapi.NewProc("GetBestRoute2")
+	getIPInterfaceEntry             = iphlpapi.NewProc("GetIpInterfaceEntry")
+	setIPInterfaceEntry             = iphlpapi.NewProc("SetIpInterfaceEntry")
+
+	dnsapi                = windows.NewLazySystemDLL("dnsapi.dll")
+	dnsFlushResolverCache = dnsapi.NewProc("DnsFlushResolverCache")
+)
+
+// rawSockaddrInet is SOCKADDR_INET, the union of sockaddr_in and sockaddr_in6.
+type rawSockaddrInet [28]byte
+
+func (s *rawSockaddrInet) set(addr netip.Addr) {
+	*s = rawSockaddrInet{}
+	if addr.Is4() {
+		binary.LittleEndian.PutUint16(s[0:], windows.AF_INET)
+		a := addr.As4()
+		copy(s[4:], a[:])
+		return
+	}
+	binary.LittleEndian.PutUint16(s[0:], windows.AF_INET6)
+	a := addr.As16()
+	copy(s[8:], a[:])
+}
+
+// The rows below mirror the netioapi.h structures, padding is spelled out
+// since 386 aligns 64 bit fields on 4 bytes while the windows abi does not.
+
+type mibUnicastIPAddressRow struct {
+	Address            rawSockaddrInet
+	_                  [4]byte
+	InterfaceLUID      uint64
+	InterfaceIndex     uint32
+	PrefixOrigin       uint32
+	SuffixOrigin       uint32
+	ValidLifetime      uint32
+	PreferredLifetime  uint32
+	OnLinkPrefixLength uint8
+	SkipAsSource       bool
+	_                  [2]byte
+	DadState           uint32
+	ScopeID            uint32
+	CreationTimeStamp  int64
+}
+
+type mibIPForwardRow2 struct {
+	InterfaceLUID     uint64
+	InterfaceIndex    uint32
+	DestinationPrefix rawSockaddrInet
+	PrefixLength      uint8
+	_                 [3]byte
+	NextHop           rawSockaddrInet
+	SitePrefixLength  uint8
+	_                 [3]byte
+	ValidLifetime     uint32
+	PreferredLifetime uint32
+	Metric            uint32
+	Protocol          uint32
+	Loopback          bool
+	AutoconfigureAddr bool
+	Publish           bool
+	Immortal          bool
+	Age               uint32
+	Origin            uint32
+}
+
+type mibIPInterfaceRow struct {
+	Family             uint16
+	_                  [6]byte
+	InterfaceLUID      uint64
+	InterfaceIndex     uint32
+	_                  [24]byte
+	UseAutomaticMetric bool
+	_                  [99]byte
+	SitePrefixLength   uint32
+	Metric             uint32
+	NlMtu              uint32
+	_                  [12]byte
+}
+
+func netioError(name string, r uintptr) error {
+	if r == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s: %v", name, windows.Errno(r))
+}
+
+func setInterfaceMTU(luid uint64, family uint16, mtu int) error {
+	row := &mibIPInterfaceRow{Family: family, InterfaceLUID: luid}
+	r, _, _ := getIPInterfaceEntry.Call(uintptr(unsafe.Pointer(row)))
+	if err := netioError("GetIpInterfaceEntry", r); err != nil {
+		return err
+	}
+
+	// SetIpInterfaceEntry refuses ipv4 rows with a site prefix length
+	if family == windows.AF_INET {
+		row.SitePrefixLength = 0
+	}
+	row.NlMtu = uint32(mtu)
+	row.UseAutomaticMetric = false
+	row.Metric = tunnelInterfaceMetric
+	r, _, _ = setIPInterfaceEntry.Call(uintptr(unsafe.Pointer(row)))
+	return netioError("SetIpInterfaceEntry", r)
+}
+
+func addInterfaceAddress(luid uint64, addr netip.Prefix) error {
+	row := new(mibUnicastIPAddressRow)
+	initializeUnicastIPAddressEntry.Call(uintptr(unsafe.Pointer(row)))
+	row.InterfaceLUID = luid
+	row.Address.set(addr.Addr())
+	row.OnLinkPrefixLength = uint8(addr.Bits())
+	row.DadState = 4 // IpDadStatePreferred
+
+	r, _, _ := createUnicastIPAddressEntry.Call(uintptr(unsafe.Pointer(row)))
+	if windows.Errno(r) == windows.ERROR_OBJECT_ALREADY_EXISTS {
+		return nil
+	}
+	return netioError("CreateUnicastIpAddressEntry", r)
+}
+
+func deleteInterfaceAddress(luid uint64, addr netip.Prefix) {
+	row := new(mibUnicastIPAddressRow)
+	initializeUnicastIPAddressEntry.Call(uintptr(unsafe.Pointer(row)))
+	row.InterfaceLUID = luid
+	row.Address.set(addr.Addr())
+	row.OnLinkPrefixLength = uint8(addr.Bits())
+	deleteUnicastIPAddressEntry.Call(uintptr(unsafe.Pointer(row)))
+}
+
+func newRouteRow(dst netip.Prefix) *mibIPForwardRow2 {
+	row := new(mibIPForwardRow2)
+	initializeIPForwardEntry.Call(uintptr(unsafe.Pointer(row)))
+	dst = dst.Masked()
+	row.DestinationPrefix.set(dst.Addr())
+	row.PrefixLength = uint8(dst.Bits())
+	row.Protocol = routeProtocolNetMgmt
+	if dst.Addr().Is4() {
+		row.NextHop.set(netip.IPv4Unspecified())
+	} else {
+		row.NextHop.set(netip.IPv6Unspecified())
+	}
+	return row
+}
+
+func createRoute(row *mibIPForwardRow2) error {
+	r, _, _ := createIPForwardEntry2.Call(uintptr(unsafe.Pointer(row)))
+	if windows.Errno(r) == windows.ERROR_OBJECT_ALREADY_EXISTS {
+		return nil
+	}
+	return netioError("CreateIpForwardEntry2", r)
+}
+
+func addInterfaceRoute(luid uint64, dst netip.Prefix) (*mibIPForwardRow2, error) {
+	row := newRouteRow(dst)
+	row.InterfaceLUID = luid
+	return row, createRoute(row)
+}
+
+// addBypassRoute routes dst over the interface and next hop windows
+// currently picks for it.
+func addBypassRoute(dst netip.Prefix) (*mibIPForwardRow2, error) {
+	var dest, source rawSockaddrInet
+	dest.set(dst.Addr())
+	best := new(mibIPForwardRow2)
+	r, _, _ := getBestRoute2.Call(0, 0, 0, uintptr(unsafe.Pointer(&dest)), 0,
+		uintptr(unsafe.Pointer(best)), uintptr(unsafe.Pointer(&source)))
+	if err := netioError("GetBestRoute2", r); err != nil {
+		return nil, fmt.Errorf("no route to %s: %v", dst, err)
+	}
+
+	row := newRouteRow(dst)
+	row.InterfaceLUID = best.InterfaceLUID
+	row.NextHop = best.NextHop
+	return row, createRoute(row)
+}
+
+func deleteRoute(row *mibIPForwardRow2) {
+	deleteIPForwardEntry2.Call(uintptr(unsafe.Pointer(row)))
+}
+
+// setInterfaceDNS writes the per interface tcpip settings, these work on
+// every windows release unlike SetInterfaceDnsSettings.
+func setInterfaceDNS(guid windows.GUID, servers []netip.Addr, domains []string) error {
+	var v4, v6 []string
+	for _, s := range servers {
+		if s.Is4() {
+			v4 = append(v4, s.String())
+			continue
+		}
+		v6 = append(v6, s.String())
+	}
+
+	var domain string
+	if len(domains) > 0 {
+		domain = domains[0]
+	}
+
+	settings := []struct {
+		service string
+		servers []string
+	}{{"Tcpip", v4}, {"Tcpip6", v6}}
+
+	for _, s := range settings {
+		path := `SYSTEM\CurrentControlSet\Services\` + s.service +
+			`\Parameters\Interfaces\` + strings.ToLower(guid.String())
+		key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, path, registry.SET_VALUE)
+		if err != nil {
+			return fmt.Errorf("can not open %s interface settings: %v", s.service, err)
+		}
+		for name, value := range map[string]string{
+			"NameServer": strings.Join(s.servers, ","),
+			"Domain":     domain,
+			"SearchList": strings.Join(domains, ","),
+		} {
+			if err = key.SetStringValue(name, value); err != nil {
+				break
+			}
+		}
+		key.Close()
+		if err != nil {
+			return fmt.Errorf("can not set %s interface settings: %v", s.service, err)
+		}
+	}
+
+	dnsFlushResolverCache.Call()
+	return nil
+}
+
+// LocalNetworks returns the on-link networks of the adapters which are up,
+// loopback and link-local networks are left out.
+func LocalNetworks() ([]netip.Prefix, error) {
+	size := uint32(15 * 1024)
+	var buf []byte
+	for {
+		buf = make([]byte, size)
+		first := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0]))
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, windows.GAA_FLAG_SKIP_ANYCAST|
+			windows.GAA_FLAG_SKIP_MULTICAST|windows.GAA_FLAG_SKIP_DNS_SERVER, 0, first, &size)
+		if err == nil {
+			break
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW {
+			return nil, fmt.Errorf("GetAdaptersAddresses: %v", err)
+		}
+	}
+
+	var result []netip.Prefix
+	for a := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); a != nil; a = a.Next {
+		if a.OperStatus != windows.IfOperStatusUp || a.IfType == windows.IF_TYPE_SOFTWARE_LOOPBACK {
+			continue
+		}
+		for u := a.FirstUnicastAddress; u != nil; u = u.Next {
+			ip, ok := netip.AddrFromSlice(u.Address.IP())
+			if !ok || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+				continue
+			}
+			ip = ip.Unmap()
+			if p, err := ip.Prefix(int(u.OnLinkPrefixLength)); err == nil {
+				result = append(result, p)
+			}
+		}
+	}
+	return result, nil
+}
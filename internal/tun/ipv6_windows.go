@@ -0,0 +1,164 @@
+package tun
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	ipv6StatePath  = `SOFTWARE\SnixConnect`
+	ipv6StateValue = "IPv6UnboundAdapters"
+	createNoWindow = 0x08000000
+)
+
+// DisableIPv6 unbinds ipv6 from the adapters with a default gateway, the
+// tunnel device with guid aside, so no ipv6 traffic can leave outside of the
+// tunnel. The adapters are recorded first so RestoreIPv6 binds ipv6 again,
+// after a crash too. The names of the adapters are returned.
+func DisableIPv6(guid [16]byte) ([]string, error) {
+	size := uint32(15 * 1024)
+	var buf []byte
+	for {
+		buf = make([]byte, size)
+		first := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0]))
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, windows.GAA_FLAG_SKIP_ANYCAST|
+			windows.GAA_FLAG_SKIP_MULTICAST|windows.GAA_FLAG_SKIP_DNS_SERVER|
+			windows.GAA_FLAG_INCLUDE_GATEWAYS, 0, first, &size)
+		if err == nil {
+			break
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW {
+			return nil, fmt.Errorf("GetAdaptersAddresses: %v", err)
+		}
+	}
+
+	tunnel := (*windows.GUID)(unsafe.Pointer(&guid)).String()
+	var adapters, names []string
+	for a := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); a != nil; a = a.Next {
+		id := windows.BytePtrToString(a.AdapterName)
+		if a.OperStatus != windows.IfOperStatusUp || a.IfType == windows.IF_TYPE_SOFTWARE_LOOPBACK ||
+			a.FirstGatewayAddress == nil || strings.EqualFold(id, tunnel) {
+			continue
+		}
+		// adapters without any ipv6 address have ipv6 unbound already
+		for u := a.FirstUnicastAddress; u != nil; u = u.Next {
+			if u.Address.IP().To4() == nil {
+				adapters = append(adapters, id)
+				names = append(names, windows.UTF16PtrToString(a.FriendlyName))
+				break
+			}
+		}
+	}
+	if len(adapters) == 0 {
+		return nil, nil
+	}
+
+	recorded, err := unboundAdapters()
+	if err != nil {
+		return nil, err
+	}
+	if err := setUnboundAdapters(append(recorded, adapters...)); err != nil {
+		return nil, err
+	}
+	if err := setIPv6Binding(adapters, false); err != nil {
+		RestoreIPv6()
+		return nil, err
+	}
+	return names, nil
+}
+
+// RestoreIPv6 binds ipv6 again to the adapters DisableIPv6 has unbound.
+func RestoreIPv6() error {
+	adapters, err := unboundAdapters()
+	if err != nil || len(adapters) == 0 {
+		return err
+	}
+	if err := setIPv6Binding(adapters, true); err != nil {
+		return err
+	}
+	return setUnboundAdapters(nil)
+}
+
+func unboundAdapters() ([]string, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, ipv6StatePath, registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can not read ipv6 adapter state: %v", err)
+	}
+	defer key.Close()
+	adapters, _, err := key.GetStringsValue(ipv6StateValue)
+	if err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return nil, fmt.Errorf("can not read ipv6 adapter state: %v", err)
+	}
+	return adapters, nil
+}
+
+func setUnboundAdapters(adapters []string) error {
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, ipv6StatePath, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("can not save ipv6 adapter state: %v", err)
+	}
+	defer key.Close()
+	if len(adapters) == 0 {
+		err = key.DeleteValue(ipv6StateValue)
+		if errors.Is(err, registry.ErrNotExist) {
+			return nil
+		}
+	} else {
+		seen := make(map[string]bool)
+		unique := adapters[:0]
+		for _, a := range adapters {
+			if !seen[strings.ToUpper(a)] {
+				seen[strings.ToUpper(a)] = true
+				unique = append(unique, a)
+			}
+		}
+		err = key.SetStringsValue(ipv6StateValue, unique)
+	}
+	if err != nil {
+		return fmt.Errorf("can not save ipv6 adapter state: %v", err)
+	}
+	return nil
+}
+
+// setIPv6Binding switches the ms_tcpip6 binding of the adapters with the
+// guids, there is no plain win32 api for it so powershell does the work.
+func setIPv6Binding(guids []string, enable bool) error {
+	quoted := make([]string, len(guids))
+	for i, g := range guids {
+		if _, err := windows.GUIDFromString(g); err != nil {
+			return fmt.Errorf("invalid adapter guid %q", g)
+		}
+		quoted[i] = "'" + g + "'"
+	}
+	verb := "Disable"
+	if enable {
+		verb = "Enable"
+	}
+	script := fmt.Sprintf("$ErrorActionPreference = 'Stop'; Get-NetAdapter -IncludeHidden | "+
+		"Where-Object { @(%s) -contains $_.InterfaceGuid } | %s-NetAdapterBinding -ComponentID ms_tcpip6",
+		strings.Join(quoted, ","), verb)
+
+	dir, err := windows.GetSystemDirectory()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(filepath.Join(dir, `WindowsPowerShell\v1.0\powershell.exe`),
+		"-NoProfile", "-NonInteractive", "-Command", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true, CreationFlags: createNoWindow}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("can not %s ipv6 on physical adapters: %v: %s",
+			strings.ToLower(verb), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
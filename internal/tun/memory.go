@@ -0,0 +1,124 @@
+package tun
+
+import (
+	"io"
+	"net/netip"
+	"sync"
+)
+
+const memoryQueueLen = 128
+
+// Memory is an in-memory device, packets written to one end of the
+// pipe are read from the other end. It needs no driver or privileges,
+// the configuration applied to it is recorded and can be inspected.
+type Memory struct {
+	mtu      int
+	inbound  chan []byte
+	peer     *Memory
+	closed   chan struct{}
+	closeOne sync.Once
+
+	mutex     sync.Mutex
+	addresses []netip.Prefix
+	include   []netip.Prefix
+	exclude   []netip.Prefix
+	servers   []netip.Addr
+	domains   []string
+
+	splitServers []netip.Addr
+	splitDomains []string
+}
+
+func NewMemoryPipe(mtu int) (*Memory, *Memory) {
+	a := &Memory{mtu: mtu, inbound: make(chan []byte, memoryQueueLen), closed: make(chan struct{})}
+	b := &Memory{mtu: mtu, inbound: make(chan []byte, memoryQueueLen), closed: make(chan struct{})}
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+func (m *Memory) Read(packet []byte) (int, error) {
+	select {
+	case p := <-m.inbound:
+		if len(p) > len(packet) {
+			return 0, io.ErrShortBuffer
+		}
+		return copy(packet, p), nil
+	case <-m.closed:
+		return 0, ErrClosed
+	}
+}
+
+func (m *Memory) Write(packet []byte) (int, error) {
+	p := make([]byte, len(packet))
+	copy(p, packet)
+	select {
+	case <-m.closed:
+		return 0, ErrClosed
+	case <-m.peer.closed:
+		return 0, ErrClosed
+	case m.peer.inbound <- p:
+		return len(packet), nil
+	}
+}
+
+func (m *Memory) MTU() int { return m.mtu }
+
+func (m *Memory) SetAddresses(addrs []netip.Prefix) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.addresses = append([]netip.Prefix(nil), addrs...)
+	return nil
+}
+
+func (m *Memory) SetRoutes(include, exclude []netip.Prefix) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.include = append([]netip.Prefix(nil), include...)
+	m.exclude = append([]netip.Prefix(nil), exclude...)
+	return nil
+}
+
+func (m *Memory) SetDNS(servers []netip.Addr, domains []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.servers = append([]netip.Addr(nil), servers...)
+	m.domains = append([]string(nil), domains...)
+	return nil
+}
+
+func (m *Memory) SetSplitDNS(servers []netip.Addr, domains []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.splitServers = append([]netip.Addr(nil), servers...)
+	m.splitDomains = append([]string(nil), domains...)
+	return nil
+}
+
+func (m *Memory) Addresses() []netip.Prefix {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]netip.Prefix(nil), m.addresses...)
+}
+
+func (m *Memory) Routes() (include, exclude []netip.Prefix) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]netip.Prefix(nil), m.include...), append([]netip.Prefix(nil), m.exclude...)
+}
+
+func (m *Memory) DNS() (servers []netip.Addr, domains []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]netip.Addr(nil), m.servers...), append([]string(nil), m.domains...)
+}
+
+func (m *Memory) Close() error {
+	m.closeOne.Do(func() { close(m.closed) })
+	return nil
+}
+
+func (m *Memory) SplitDNS() (servers []netip.Addr, domains []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]netip.Addr(nil), m.splitServers...), append([]string(nil), m.splitDomains...)
+}
@@ -0,0 +1,100 @@
+package tun
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	nrptPolicyPath       = `SYSTEM\CurrentControlSet\Services\Dnscache\Parameters\DnsPolicyConfig`
+	nrptRulePrefix       = "SnixConnect-"
+	nrptConfigGenericDNS = 0x8
+	nrptVersion          = 2
+)
+
+// setNRPTRule replaces the name resolution policy rule of the device with
+// guid, queries for domains and every name below them go to servers.
+func setNRPTRule(guid windows.GUID, servers []netip.Addr, domains []string) error {
+	if err := deleteNRPTRules(); err != nil {
+		return err
+	}
+	if len(domains) == 0 || len(servers) == 0 {
+		dnsFlushResolverCache.Call()
+		return nil
+	}
+
+	names := make([]string, 0, 2*len(domains))
+	for _, d := range domains {
+		names = append(names, d, "."+d)
+	}
+	addrs := make([]string, len(servers))
+	for i, s := range servers {
+		addrs[i] = s.String()
+	}
+
+	path := nrptPolicyPath + `\` + nrptRulePrefix + strings.ToLower(guid.String())
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, path, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("can not create split dns rule: %v", err)
+	}
+	defer key.Close()
+	if err = key.SetDWordValue("Version", nrptVersion); err == nil {
+		err = key.SetStringsValue("Name", names)
+	}
+	if err == nil {
+		err = key.SetStringValue("GenericDNSServers", strings.Join(addrs, ";"))
+	}
+	if err == nil {
+		err = key.SetDWordValue("ConfigOptions", nrptConfigGenericDNS)
+	}
+	if err == nil {
+		err = key.SetStringValue("IPSECCARestriction", "")
+	}
+	if err != nil {
+		deleteNRPTRules()
+		return fmt.Errorf("can not set split dns rule: %v", err)
+	}
+
+	dnsFlushResolverCache.Call()
+	return nil
+}
+
+// deleteNRPTRules removes every rule added by snixconnect, the ones
+// of other devices or left behind by a crash included.
+func deleteNRPTRules() error {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, nrptPolicyPath, registry.ENUMERATE_SUB_KEYS)
+	if err == registry.ErrNotExist {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can not open split dns rules: %v", err)
+	}
+	names, err := key.ReadSubKeyNames(-1)
+	key.Close()
+	if err != nil {
+		return fmt.Errorf("can not read split dns rules: %v", err)
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, nrptRulePrefix) {
+			continue
+		}
+		if err := registry.DeleteKey(registry.LOCAL_MACHINE, nrptPolicyPath+`\`+name); err != nil {
+			return fmt.Errorf("can not remove split dns rule %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// CleanupDNS removes the split dns rules and the nameservers of the device
+// with guid, e.g. left behind when the previous run has crashed.
+func CleanupDNS(guid [16]byte) error {
+	if err := deleteNRPTRules(); err != nil {
+		return err
+	}
+	return setInterfaceDNS(*(*windows.GUID)(unsafe.Pointer(&guid)), nil, nil)
+}
@@ -0,0 +1,35 @@
+package tun
+
+import (
+	"errors"
+	"net/netip"
+)
+
+var ErrClosed = errors.New("tunnel device is closed")
+
+// Device is a layer 3 packet device, every Read and Write
+// call transfers exactly one ip packet.
+type Device interface {
+	Read(packet []byte) (int, error)
+	Write(packet []byte) (int, error)
+	MTU() int
+
+	// SetAddresses replaces the addresses assigned to the device,
+	// at most one of each address family.
+	SetAddresses(addrs []netip.Prefix) error
+
+	// SetRoutes replaces the routes of the device, include routes are sent
+	// through the device and exclude routes are kept on the route they
+	// had before the tunnel was up, e.g. the vpn gateway itself.
+	SetRoutes(include, exclude []netip.Prefix) error
+
+	// SetDNS replaces the nameservers and search domains of the device.
+	SetDNS(servers []netip.Addr, domains []string) error
+
+	// SetSplitDNS sends the queries for names in domains and below to
+	// servers, whatever nameservers the other devices have. Empty
+	// domains removes the rule.
+	SetSplitDNS(servers []netip.Addr, domains []string) error
+
+	Close() error
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package tun
+
+import (
+	"errors"
+	"net/netip"
+)
+
+// Open creates the tunnel device of the running platform.
+func Open(name string, guid [16]byte, mtu int) (Device, error) {
+	return nil, errors.New("no tunnel device driver available on this platform")
+}
+
+// LocalNetworks returns the on-link networks of the adapters which are up.
+func LocalNetworks() ([]netip.Prefix, error) {
+	return nil, errors.New("local networks are not available on this platform")
+}
+
+// CleanupDNS removes the split dns rules and the nameservers of the device with guid.
+func CleanupDNS(guid [16]byte) error { return nil }
+
+// DisableIPv6 unbinds ipv6 from the adapters with a default gateway
+// but the tunnel device with guid.
+func DisableIPv6(guid [16]byte) ([]string, error) {
+	return nil, errors.New("disabling ipv6 is not available on this platform")
+}
+
+// RestoreIPv6 binds ipv6 again to the adapters DisableIPv6 has unbound.
+func RestoreIPv6() error { return nil }
@@ -0,0 +1,300 @@
+package tun
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	wintunDLL         = "wintun.dll"
+	wintunTunnelType  = "SnixConnect"
+	wintunRingSize    = 0x400000
+	wintunMaxIPPacket = 0xffff
+)
+
+var (
+	wintunLoad     sync.Once
+	wintunLoadErr  error
+	wintun         *windows.LazyDLL
+	wintunCreate   *windows.LazyProc
+	wintunClose    *windows.LazyProc
+	wintunLUID     *windows.LazyProc
+	wintunStart    *windows.LazyProc
+	wintunEnd      *windows.LazyProc
+	wintunWaitEvt  *windows.LazyProc
+	wintunReceive  *windows.LazyProc
+	wintunRelease  *windows.LazyProc
+	wintunAllocate *windows.LazyProc
+	wintunSend     *windows.LazyProc
+)
+
+// loadWintun loads wintun.dll from the directory of the executable,
+// the dll is shipped next to snixconnect by the installer.
+func loadWintun() error {
+	wintunLoad.Do(func() {
+		exe, err := os.Executable()
+		if err != nil {
+			wintunLoadErr = err
+			return
+		}
+		wintun = windows.NewLazyDLL(filepath.Join(filepath.Dir(exe), wintunDLL))
+		if err := wintun.Load(); err != nil {
+			wintunLoadErr = fmt.Errorf("can not load %s: %v", wintunDLL, err)
+			return
+		}
+
+		wintunCreate = wintun.NewProc("WintunCreateAdapter")
+		wintunClose = wintun.NewProc("WintunCloseAdapter")
+		wintunLUID = wintun.NewProc("WintunGetAdapterLUID")
+		wintunStart = wintun.NewProc("WintunStartSession")
+		wintunEnd = wintun.NewProc("WintunEndSession")
+		wintunWaitEvt = wintun.NewProc("WintunGetReadWaitEvent")
+		wintunReceive = wintun.NewProc("WintunReceivePacket")
+		wintunRelease = wintun.NewProc("WintunReleaseReceivePacket")
+		wintunAllocate = wintun.NewProc("WintunAllocateSendPacket")
+		wintunSend = wintun.NewProc("WintunSendPacket")
+	})
+	return wintunLoadErr
+}
+
+type wintunDevice struct {
+	mtu       int
+	guid      windows.GUID
+	luid      uint64
+	adapter   uintptr
+	session   uintptr
+	readWait  windows.Handle
+	closeWait windows.Handle
+
+	// mutex guards the session and closeWait against Close, reads and
+	// writes hold it shared so they never touch an ended session. A read
+	// keeps holding it while it waits, Close signals closeWait first.
+	mutex    sync.RWMutex
+	closed   atomic.Bool
+	closeOne sync.Once
+
+	config    sync.Mutex
+	addresses []netip.Prefix
+	routes    []*mibIPForwardRow2
+}
+
+// Open creates the tunnel device of the running platform.
+func Open(name string, guid [16]byte, mtu int) (Device, error) {
+	if err := loadWintun(); err != nil {
+		return nil, err
+	}
+
+	pname, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	ptype, err := windows.UTF16PtrFromString(wintunTunnelType)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &wintunDevice{mtu: mtu, guid: *(*windows.GUID)(unsafe.Pointer(&guid))}
+	d.adapter, _, err = wintunCreate.Call(uintptr(unsafe.Pointer(pname)),
+		uintptr(unsafe.Pointer(ptype)), uintptr(unsafe.Pointer(&d.guid)))
+	if d.adapter == 0 {
+		return nil, fmt.Errorf("WintunCreateAdapter: %v", err)
+	}
+	wintunLUID.Call(d.adapter, uintptr(unsafe.Pointer(&d.luid)))
+
+	if d.session, _, err = wintunStart.Call(d.adapter, wintunRingSize); d.session == 0 {
+		wintunClose.Call(d.adapter)
+		return nil, fmt.Errorf("WintunStartSession: %v", err)
+	}
+	r, _, _ := wintunWaitEvt.Call(d.session)
+	d.readWait = windows.Handle(r)
+
+	if d.closeWait, err = windows.CreateEvent(nil, 1, 0, nil); err != nil {
+		d.release()
+		return nil, fmt.Errorf("CreateEvent: %v", err)
+	}
+	if err := setInterfaceMTU(d.luid, windows.AF_INET, mtu); err != nil {
+		d.Close()
+		return nil, err
+	}
+	// ipv6 may be disabled on the machine, it also needs an mtu of 1280
+	if mtu >= ipv6MinMTU {
+		setInterfaceMTU(d.luid, windows.AF_INET6, mtu)
+	}
+	return d, nil
+}
+
+func (d *wintunDevice) Read(packet []byte) (int, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	for {
+		if d.closed.Load() {
+			return 0, ErrClosed
+		}
+		var size uint32
+		p, _, err := wintunReceive.Call(d.session, uintptr(unsafe.Pointer(&size)))
+		if p != 0 {
+			n := copy(packet, ringBytes(p, size))
+			wintunRelease.Call(d.session, p)
+			if n < int(size) {
+				return 0, io.ErrShortBuffer
+			}
+			return n, nil
+		}
+
+		switch err {
+		case windows.ERROR_NO_MORE_ITEMS:
+			handles := []windows.Handle{d.readWait, d.closeWait}
+			windows.WaitForMultipleObjects(handles, false, windows.INFINITE)
+		case windows.ERROR_HANDLE_EOF:
+			return 0, ErrClosed
+		default:
+			return 0, fmt.Errorf("WintunReceivePacket: %v", err)
+		}
+	}
+}
+
+func (d *wintunDevice) Write(packet []byte) (int, error) {
+	if len(packet) > wintunMaxIPPacket {
+		return 0, fmt.Errorf("packet of %d bytes is too large", len(packet))
+	}
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	p, _, err := wintunAllocate.Call(d.session, uintptr(len(packet)))
+	if p == 0 {
+		switch err {
+		case windows.ERROR_HANDLE_EOF:
+			return 0, ErrClosed
+		case windows.ERROR_BUFFER_OVERFLOW:
+			// the ring is full, drop the packet like a congested link would
+			return len(packet), nil
+		}
+		return 0, fmt.Errorf("WintunAllocateSendPacket: %v", err)
+	}
+	copy(ringBytes(p, uint32(len(packet))), packet)
+	wintunSend.Call(d.session, p)
+	return len(packet), nil
+}
+
+func (d *wintunDevice) MTU() int { return d.mtu }
+
+// LUID identifies the network interface of the device.
+func (d *wintunDevice) LUID() uint64 { return d.luid }
+
+func (d *wintunDevice) SetAddresses(addrs []netip.Prefix) error {
+	d.config.Lock()
+	defer d.config.Unlock()
+	contains := func(list []netip.Prefix, p netip.Prefix) bool {
+		for _, q := range list {
+			if q == p {
+				return true
+			}
+		}
+		return false
+	}
+
+	var kept []netip.Prefix
+	for _, addr := range d.addresses {
+		if !contains(addrs, addr) {
+			deleteInterfaceAddress(d.luid, addr)
+			continue
+		}
+		kept = append(kept, addr)
+	}
+	d.addresses = kept
+	for _, addr := range addrs {
+		if contains(kept, addr) {
+			continue
+		}
+		if err := addInterfaceAddress(d.luid, addr); err != nil {
+			return err
+		}
+		d.addresses = append(d.addresses, addr)
+	}
+	return nil
+}
+
+func (d *wintunDevice) SetRoutes(include, exclude []netip.Prefix) error {
+	d.config.Lock()
+	defer d.config.Unlock()
+	d.flushRoutes()
+
+	// exclude routes first, once include routes are in place the best
+	// route to the excluded networks would be the tunnel itself
+	for _, dst := range exclude {
+		row, err := addBypassRoute(dst)
+		if err != nil {
+			return err
+		}
+		d.routes = append(d.routes, row)
+	}
+	for _, dst := range include {
+		row, err := addInterfaceRoute(d.luid, dst)
+		if err != nil {
+			return err
+		}
+		d.routes = append(d.routes, row)
+	}
+	return nil
+}
+
+func (d *wintunDevice) SetDNS(servers []netip.Addr, domains []string) error {
+	return setInterfaceDNS(d.guid, servers, domains)
+}
+
+func (d *wintunDevice) SetSplitDNS(servers []netip.Addr, domains []string) error {
+	return setNRPTRule(d.guid, servers, domains)
+}
+
+func (d *wintunDevice) flushRoutes() {
+	for _, row := range d.routes {
+		deleteRoute(row)
+	}
+	d.routes = nil
+}
+
+func (d *wintunDevice) Close() error {
+	d.closeOne.Do(func() {
+		d.closed.Store(true)
+		windows.SetEvent(d.closeWait)
+
+		d.config.Lock()
+		d.flushRoutes()
+		d.config.Unlock()
+
+		// interface settings are kept in registry by guid, clear them so
+		// they don't show up on the next adapter with the same guid
+		setInterfaceDNS(d.guid, nil, nil)
+		deleteNRPTRules()
+
+		// blocked reads are woken by closeWait, they leave before the
+		// session is ended and the event is closed
+		d.mutex.Lock()
+		d.release()
+		windows.CloseHandle(d.closeWait)
+		d.mutex.Unlock()
+	})
+	return nil
+}
+
+func (d *wintunDevice) release() {
+	wintunEnd.Call(d.session)
+	wintunClose.Call(d.adapter)
+}
+
+// ringBytes returns the packet at p which is owned by the wintun ring.
+func ringBytes(p uintptr, size uint32) []byte {
+	return unsafe.Slice(*(**byte)(unsafe.Pointer(&p)), size)
+}